@@ -23,6 +23,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == operator.RaftStateCommand {
+		// Run by the jobs of the quorum recoveries on the store volume.
+		if err := operator.WriteRaftStates(os.Stdout, os.Args[2], os.Args[3:]); err != nil {
+			log.Errorf(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	if os.Getenv("DEBUG") == "true" {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -31,7 +40,14 @@ func main() {
 	}
 	log.SetFormatter(formatter)
 
-	controller := operator.NewController(nil)
+	metricsAddress := operator.DefaultMetricsAddress
+	if addr, ok := os.LookupEnv("METRICS_ADDRESS"); ok {
+		metricsAddress = addr
+	}
+	controller := operator.NewController(&operator.Options{
+		MetricsAddress: metricsAddress,
+		Image:          os.Getenv("OPERATOR_IMAGE"),
+	})
 	log.Infof("Starting NATS Streaming Operator v%s", operator.Version)
 	log.Infof("Go Version: %s", runtime.Version())
 
@@ -0,0 +1,445 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// scaleCooldowns returns how long to wait after the size of a
+// cluster changed before scaling it up and down.
+func scaleCooldowns(as *stanv1alpha1.AutoscalingConfig) (time.Duration, time.Duration) {
+	up, down := DefaultScaleUpCooldown, DefaultScaleDownCooldown
+	if d, err := time.ParseDuration(as.ScaleUpCooldown); err == nil {
+		up = d
+	}
+	if d, err := time.ParseDuration(as.ScaleDownCooldown); err == nil {
+		down = d
+	}
+	return up, down
+}
+
+func metricValue(stats *stanv1alpha1.ClusterStats, metric stanv1alpha1.AutoscalingMetricType) int64 {
+	switch metric {
+	case stanv1alpha1.AutoscalingClients:
+		return int64(stats.Clients)
+	case stanv1alpha1.AutoscalingSubscriptions:
+		return int64(stats.Subscriptions)
+	case stanv1alpha1.AutoscalingChannels:
+		return int64(stats.Channels)
+	case stanv1alpha1.AutoscalingMessages:
+		return stats.Messages
+	case stanv1alpha1.AutoscalingPendingMessages:
+		return stats.PendingMessages
+	}
+	return 0
+}
+
+// boundedSize returns the size of a cluster within the bounds of
+// its autoscaling and odd, and why it had to be changed if it was.
+func boundedSize(as *stanv1alpha1.AutoscalingConfig, size int32) (int32, string) {
+	switch {
+	case size < as.MinSize:
+		return as.MinSize, fmt.Sprintf("size %d is below the minimum of %d", size, as.MinSize)
+	case size > as.MaxSize:
+		return as.MaxSize, fmt.Sprintf("size %d is above the maximum of %d", size, as.MaxSize)
+	case size%2 == 0:
+		return size + 1, fmt.Sprintf("size %d is even", size)
+	}
+	return size, ""
+}
+
+// autoscaledSize returns the size to scale a cluster of an odd size
+// within its bounds to according to its stats, and why.  The size is
+// changed by two nodes at a time so that it stays odd, and it is only
+// scaled down when the stats would not scale it back up right away.
+func autoscaledSize(as *stanv1alpha1.AutoscalingConfig, size int32, stats *stanv1alpha1.ClusterStats) (int32, string) {
+	for _, m := range as.Metrics {
+		value := metricValue(stats, m.Type)
+		if m.ScaleUpAbove > 0 && value > m.ScaleUpAbove*int64(size) && size < as.MaxSize {
+			return size + 2, fmt.Sprintf("%s per node %d above %d", m.Type, value/int64(size), m.ScaleUpAbove)
+		}
+	}
+	if size <= as.MinSize {
+		return size, ""
+	}
+	var below []string
+	for _, m := range as.Metrics {
+		value := metricValue(stats, m.Type)
+		if m.ScaleUpAbove > 0 && value > m.ScaleUpAbove*int64(size-2) {
+			return size, ""
+		}
+		if m.ScaleDownBelow == 0 {
+			continue
+		}
+		if value >= m.ScaleDownBelow*int64(size) {
+			return size, ""
+		}
+		below = append(below, fmt.Sprintf("%s per node %d below %d", m.Type, value/int64(size), m.ScaleDownBelow))
+	}
+	if len(below) == 0 {
+		return size, ""
+	}
+	return size - 2, strings.Join(below, ", ")
+}
+
+// hasLeader returns whether the stats were scraped from a leader,
+// without which the totals of the cluster are unknown.
+func hasLeader(stats *stanv1alpha1.ClusterStats) bool {
+	for _, node := range stats.Nodes {
+		if node.Role == serverRoleLeader {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileAutoscaling adjusts the size of a clustered cluster to
+// the stats last scraped from its nodes, within the bounds of its
+// autoscaling.  It is only scaled when the cluster is settled, and
+// only scaled down once the departing nodes have been removed from
+// the Raft group, see startScaleDown.
+func (c *Controller) reconcileAutoscaling(o *stanv1alpha1.NatsStreamingCluster) error {
+	if last := o.Status.Autoscaling; last != nil && last.ScaleDown != nil {
+		return c.advanceScaleDown(o, last.ScaleDown.DeepCopy())
+	}
+	as := o.Spec.Autoscaling
+	if as == nil {
+		return nil
+	}
+	size := o.Spec.Size
+	if bounded, reason := boundedSize(as, size); bounded > size {
+		return c.scaleCluster(o, size, bounded, reason)
+	} else if bounded < size {
+		// Brought within the bounds regardless of the cooldown, but
+		// still only once the departing nodes have been removed, and
+		// by at most two nodes at a time like when autoscaled so that
+		// the nodes kept form a quorum of the voters.
+		if bounded < size-2 {
+			bounded = size - 2
+		}
+		pods, err := c.findRunningPods(o.Name, o.Namespace)
+		if err != nil {
+			return err
+		}
+		return c.startScaleDown(o, pods, size, bounded, reason)
+	}
+
+	stats := c.recentStats(o)
+	if stats == nil {
+		log.Debugf("Not autoscaling '%s/%s' cluster without recent stats", o.Namespace, o.Name)
+		return nil
+	}
+	if !hasLeader(stats) {
+		log.Debugf("Not autoscaling '%s/%s' cluster without a leader", o.Namespace, o.Name)
+		return nil
+	}
+	if len(o.Status.Updates) > 0 || (o.Status.RaftHealth != nil && len(o.Status.RaftHealth.Rejoining) > 0) {
+		log.Debugf("Not autoscaling '%s/%s' cluster while its nodes are updated", o.Namespace, o.Name)
+		return nil
+	}
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return err
+	}
+	if len(pods) != int(size) {
+		log.Debugf("Not autoscaling '%s/%s' cluster while it is resized (size=%d/%d)", o.Namespace, o.Name, len(pods), size)
+		return nil
+	}
+
+	desired, reason := autoscaledSize(as, size, stats)
+	if desired == size {
+		return nil
+	}
+	if last := o.Status.Autoscaling; last != nil && last.LastScaleTime != nil {
+		up, down := scaleCooldowns(as)
+		cooldown := up
+		if desired < size {
+			cooldown = down
+		}
+		if time.Since(last.LastScaleTime.Time) < cooldown {
+			log.Debugf("Not scaling '%s/%s' cluster to %d nodes within the cooldown of %s", o.Namespace, o.Name, desired, cooldown)
+			return nil
+		}
+	}
+	if desired < size {
+		return c.startScaleDown(o, pods, size, desired, reason)
+	}
+	return c.scaleCluster(o, size, desired, reason)
+}
+
+// allowsNodeRemoval returns whether the leader of the Raft group
+// accepts requests to remove nodes from it.
+func allowsNodeRemoval(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return o.Spec.Config != nil && o.Spec.Config.Cluster != nil && o.Spec.Config.Cluster.AllowAddRemoveNode
+}
+
+// departingPeers returns the voters of the Raft group that are not
+// part of a cluster of the desired size, including those whose pod
+// was deleted without removing them.
+func departingPeers(o *stanv1alpha1.NatsStreamingCluster, peers []string, desired int32) []string {
+	var departing []string
+	for _, name := range peers {
+		if nodeOrdinal(o, name) > int(desired) {
+			departing = append(departing, name)
+		}
+	}
+	return departing
+}
+
+// startScaleDown starts to scale a cluster down by removing the
+// departing nodes from the Raft group through its leader, since the
+// group keeps every voter it had even once its pod is deleted.  It
+// is refused unless the leader accepts the removal of nodes and the
+// nodes that are kept are healthy enough to form a quorum of all the
+// voters of the group.
+func (c *Controller) startScaleDown(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod, size, desired int32, reason string) error {
+	if !allowsNodeRemoval(o) {
+		return c.keepSize(o, fmt.Sprintf("Not scaling down to %d nodes, the nodes cannot be removed from the Raft group unless allowAddRemoveNode is set", desired))
+	}
+
+	nodes := raftNodes(o, pods, c.recentStats(o))
+	peers := raftPeers(o.Status.RaftPeers, nodes)
+	var healthy int32
+	var leader bool
+	for _, node := range nodes {
+		leader = leader || node.isLeader()
+		if podOrdinal(o, node.pod) > int(desired) {
+			continue
+		}
+		if podIsReady(node.pod) && node.joined() && !isUnhealthy(o.Status.RaftHealth, node.pod.Name) {
+			healthy++
+		}
+	}
+	quorum := quorumSize(int32(len(peers)))
+	if !leader || healthy < quorum {
+		return c.keepSize(o, fmt.Sprintf("Not scaling down to %d nodes, only %d of the nodes kept are healthy out of the %d required for quorum of the %d voters of the Raft group",
+			desired, healthy, quorum, len(peers)))
+	}
+
+	departing := departingPeers(o, peers, desired)
+	if len(departing) == 0 {
+		// None of the departing nodes ever joined the group.
+		return c.scaleCluster(o, size, desired, reason)
+	}
+	now := k8smetav1.Now()
+	sd := &stanv1alpha1.ScaleDown{
+		From:      size,
+		To:        desired,
+		Reason:    reason,
+		Nodes:     departing,
+		Job:       nodeRemovalJobName(o),
+		StartTime: &now,
+	}
+	log.Infof("Removing %s from the Raft group of '%s/%s' cluster to scale it down to %d nodes", strings.Join(departing, ", "), o.Namespace, o.Name, desired)
+	if err := c.createNodeRemovalJob(o, sd); err != nil {
+		return err
+	}
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		if status.Autoscaling == nil {
+			status.Autoscaling = &stanv1alpha1.AutoscalingStatus{}
+		}
+		status.Autoscaling.ScaleDown = sd.DeepCopy()
+		status.Autoscaling.Message = fmt.Sprintf("Removing %s from the Raft group to scale down to %d nodes", strings.Join(departing, ", "), desired)
+	})
+}
+
+// advanceScaleDown scales a cluster down once the leader of the Raft
+// group confirmed the removal of the departing nodes, so that their
+// pods are only deleted once they are no longer voters.  The cluster
+// keeps its size in case the removal fails.
+func (c *Controller) advanceScaleDown(o *stanv1alpha1.NatsStreamingCluster, sd *stanv1alpha1.ScaleDown) error {
+	job, err := c.kc.BatchV1().Jobs(o.Namespace).Get(sd.Job, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return c.createNodeRemovalJob(o, sd)
+	} else if err != nil {
+		return err
+	}
+	if job.DeletionTimestamp != nil {
+		// Wait for the job of a previous scale down to be gone.
+		return nil
+	}
+	nodes := strings.Join(sd.Nodes, ", ")
+	if failed, message := jobFailed(job); failed {
+		log.Errorf("Failed to remove %s from the Raft group of '%s/%s' cluster: %s", nodes, o.Namespace, o.Name, message)
+		c.event(o, k8scorev1.EventTypeWarning, "ScaleDownFailed", "Job %s failed to remove %s from the Raft group: %s", job.Name, nodes, message)
+		err := c.kc.BatchV1().Jobs(o.Namespace).Delete(job.Name, k8sDeleteInBackground())
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		// Retried after the cooldown, the nodes that were removed
+		// nonetheless remain voters until confirmed otherwise.
+		now := k8smetav1.Now()
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Autoscaling = &stanv1alpha1.AutoscalingStatus{
+				LastScaleTime: &now,
+				Message:       fmt.Sprintf("Not scaling down to %d nodes, the removal of %s from the Raft group failed: %s", sd.To, nodes, message),
+			}
+		})
+	}
+	if job.Status.Succeeded == 0 {
+		return nil
+	}
+
+	log.Infof("Removed %s from the Raft group of '%s/%s' cluster", nodes, o.Namespace, o.Name)
+	err = c.kc.BatchV1().Jobs(o.Namespace).Delete(job.Name, k8sDeleteInBackground())
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	peers := removeStrings(o.Status.RaftPeers, sd.Nodes)
+	if o.Spec.Size != sd.From {
+		log.Warnf("Not scaling '%s/%s' cluster down to %d nodes, its size was changed to %d while removing %s from the Raft group",
+			o.Namespace, o.Name, sd.To, o.Spec.Size, nodes)
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.RaftPeers = removeStrings(status.RaftPeers, sd.Nodes)
+			status.Autoscaling = &stanv1alpha1.AutoscalingStatus{
+				Message: fmt.Sprintf("Not scaling down to %d nodes, the size was changed to %d", sd.To, o.Spec.Size),
+			}
+		})
+	}
+	if err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.RaftPeers = removeStrings(status.RaftPeers, sd.Nodes)
+	}); err != nil {
+		return err
+	}
+	o.Status.RaftPeers = peers
+	return c.scaleCluster(o, sd.From, sd.To, sd.Reason)
+}
+
+// removeStrings returns the strings of a list that are not in another.
+func removeStrings(list, removed []string) []string {
+	var kept []string
+	for _, s := range list {
+		if !containsString(removed, s) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// keepSize records why a cluster is not scaled, unless it already was.
+func (c *Controller) keepSize(o *stanv1alpha1.NatsStreamingCluster, message string) error {
+	if last := o.Status.Autoscaling; last != nil && last.Message == message {
+		return nil
+	}
+	log.Warnf("%s for '%s/%s' cluster", message, o.Namespace, o.Name)
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		if status.Autoscaling == nil {
+			status.Autoscaling = &stanv1alpha1.AutoscalingStatus{}
+		}
+		status.Autoscaling.Message = message
+	})
+}
+
+func nodeRemovalJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-node-removal", o.Name)
+}
+
+func nodeRemovalLabels(o *stanv1alpha1.NatsStreamingCluster) map[string]string {
+	return map[string]string{
+		"app":          "nats-streaming-node-removal",
+		"stan_cluster": o.Name,
+	}
+}
+
+// nodeRemovalSubject is the subject on which the leader of a Raft
+// group with allowAddRemoveNode set accepts the ID of a node to
+// remove from it, answering with OK once it is removed.
+const nodeRemovalSubject = "_STAN.raft.%s.node.remove"
+
+// nodeRemovalScript sends the removal of each node to the leader of
+// the Raft group, failing unless the leader confirms it.  Removing a
+// node that is no longer a voter is confirmed as well, so that the
+// job can be retried.
+func nodeRemovalScript(o *stanv1alpha1.NatsStreamingCluster, nodes []string) string {
+	ids := make([]string, 0, len(nodes))
+	for _, name := range nodes {
+		ids = append(ids, clusterNodeID(name))
+	}
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("for node in %s; do", shellQuoteAll(ids)),
+		`  echo "Removing $node from the Raft group"`,
+		fmt.Sprintf(`  reply=$(nats req --server %s --timeout 10s --raw %s "$node")`,
+			shellQuote(fmt.Sprintf("nats://%s:4222", o.Spec.NatsService)), shellQuote(fmt.Sprintf(nodeRemovalSubject, stanClusterID(o)))),
+		`  if [ "$reply" != OK ]; then`,
+		`    echo "The leader did not confirm the removal of $node: $reply" >&2`,
+		"    exit 1",
+		"  fi",
+		"done",
+	}, "\n")
+}
+
+func newNodeRemovalJob(o *stanv1alpha1.NatsStreamingCluster, sd *stanv1alpha1.ScaleDown) *k8sbatchv1.Job {
+	job := newTargetJob(k8smetav1.ObjectMeta{
+		Name:            sd.Job,
+		Namespace:       o.Namespace,
+		Labels:          nodeRemovalLabels(o),
+		OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+	}, DefaultNodeRemovalImage, &stanv1alpha1.BackupTarget{}, nodeRemovalScript(o, sd.Nodes), nil, nil)
+	job.Spec.Template.Spec.ImagePullSecrets = o.Spec.ImagePullSecrets
+	return job
+}
+
+func (c *Controller) createNodeRemovalJob(o *stanv1alpha1.NatsStreamingCluster, sd *stanv1alpha1.ScaleDown) error {
+	job := newNodeRemovalJob(o, sd)
+	log.Infof("Creating job '%s/%s' to remove nodes from the Raft group of '%s/%s' cluster", job.Namespace, job.Name, o.Namespace, o.Name)
+	_, err := c.kc.BatchV1().Jobs(o.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// scaleCluster changes the size of a cluster, unless it was changed
+// in the meantime.
+func (c *Controller) scaleCluster(o *stanv1alpha1.NatsStreamingCluster, size, desired int32, reason string) error {
+	now := k8smetav1.Now()
+	message := fmt.Sprintf("Scaled from %d to %d nodes: %s", size, desired, reason)
+	scaled := false
+	err := c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		if cluster.Spec.Size != size {
+			return
+		}
+		cluster.Spec.Size = desired
+		cluster.Status.Autoscaling = &stanv1alpha1.AutoscalingStatus{
+			LastScaleTime: &now,
+			Message:       message,
+		}
+		scaled = true
+	})
+	if err != nil || !scaled {
+		return err
+	}
+	log.Infof("%s for '%s/%s' cluster", message, o.Namespace, o.Name)
+	eventReason := "ScaledUp"
+	if desired < size {
+		eventReason = "ScaledDown"
+	}
+	c.event(o, k8scorev1.EventTypeNormal, eventReason, "%s", message)
+
+	// Resize the cluster right away.
+	o.Spec.Size = desired
+	o.Status.Autoscaling = &stanv1alpha1.AutoscalingStatus{LastScaleTime: &now, Message: message}
+	return nil
+}
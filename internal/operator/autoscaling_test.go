@@ -0,0 +1,352 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8srecord "k8s.io/client-go/tools/record"
+)
+
+func TestValidateAutoscaling(t *testing.T) {
+	metrics := []stanv1alpha1.AutoscalingMetric{{Type: stanv1alpha1.AutoscalingClients, ScaleUpAbove: 100, ScaleDownBelow: 20}}
+	for _, tt := range []struct {
+		name   string
+		config *stanv1alpha1.ServerConfig
+		as     *stanv1alpha1.AutoscalingConfig
+		valid  bool
+	}{
+		{"bounds", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7, Metrics: metrics}, true},
+		{"not clustered", nil, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7, Metrics: metrics}, false},
+		{"single node", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 1, MaxSize: 7, Metrics: metrics}, false},
+		{"even maximum", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 6, Metrics: metrics}, false},
+		{"maximum below minimum", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 5, MaxSize: 3, Metrics: metrics}, false},
+		{"no metrics", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7}, false},
+		{"unknown metric", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7, Metrics: []stanv1alpha1.AutoscalingMetric{{Type: "CPU", ScaleUpAbove: 80}}}, false},
+		{"overlapping thresholds", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7, Metrics: []stanv1alpha1.AutoscalingMetric{{Type: stanv1alpha1.AutoscalingClients, ScaleUpAbove: 10, ScaleDownBelow: 10}}}, false},
+		{"bad cooldown", &stanv1alpha1.ServerConfig{}, &stanv1alpha1.AutoscalingConfig{MinSize: 3, MaxSize: 7, Metrics: metrics, ScaleDownCooldown: "later"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestCluster("stan", 3, tt.config)
+			o.Spec.Autoscaling = tt.as
+			if err := validateCluster(o); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got: %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestAutoscaledSize(t *testing.T) {
+	as := &stanv1alpha1.AutoscalingConfig{
+		MinSize: 3,
+		MaxSize: 7,
+		Metrics: []stanv1alpha1.AutoscalingMetric{
+			{Type: stanv1alpha1.AutoscalingClients, ScaleUpAbove: 100, ScaleDownBelow: 20},
+			{Type: stanv1alpha1.AutoscalingPendingMessages, ScaleUpAbove: 1000},
+		},
+	}
+	for _, tt := range []struct {
+		size     int32
+		clients  int32
+		pending  int64
+		expected int32
+	}{
+		{3, 200, 0, 3},
+		{3, 301, 0, 5},
+		{3, 0, 3001, 5},
+		{7, 1000, 0, 7},
+		{5, 60, 0, 3},
+		{5, 100, 0, 5},
+		{5, 60, 3001, 5},
+		{3, 0, 0, 3},
+	} {
+		stats := &stanv1alpha1.ClusterStats{Clients: tt.clients, PendingMessages: tt.pending}
+		if size, reason := autoscaledSize(as, tt.size, stats); size != tt.expected {
+			t.Errorf("Expected %d nodes with %d clients and %d pending messages to be scaled to %d, got: %d (%s)",
+				tt.size, tt.clients, tt.pending, tt.expected, size, reason)
+		}
+	}
+}
+
+func TestReconcileAutoscaling(t *testing.T) {
+	o := newTestStoreCluster("stan", 5)
+	o.Spec.Autoscaling = &stanv1alpha1.AutoscalingConfig{
+		MinSize: 3,
+		MaxSize: 5,
+		Metrics: []stanv1alpha1.AutoscalingMetric{{Type: stanv1alpha1.AutoscalingClients, ScaleUpAbove: 100, ScaleDownBelow: 20}},
+	}
+	now := k8smetav1.Now()
+	o.Status.Stats = &stanv1alpha1.ClusterStats{
+		Clients: 10,
+		Nodes: []stanv1alpha1.NodeStats{
+			{Name: "stan-1", State: "CLUSTERED", Role: "Leader"},
+			{Name: "stan-2", State: "CLUSTERED", Role: "Follower"},
+			{Name: "stan-3", State: "CLUSTERED", Role: "Follower"},
+			{Name: "stan-4", State: "CLUSTERED", Role: "Follower"},
+			{Name: "stan-5", State: "CLUSTERED", Role: "Follower"},
+		},
+		LastScrapeTime: &now,
+	}
+	c := newTestController([]k8sruntime.Object{o}, newTestStorePods(o)...)
+	c.recorder = k8srecord.NewFakeRecorder(10)
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		t.Helper()
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	refused := func(reason string) {
+		t.Helper()
+		if err := c.reconcileAutoscaling(o); err != nil {
+			t.Fatal(err)
+		}
+		result := getCluster()
+		if result.Spec.Size != 5 {
+			t.Fatalf("Expected the cluster not to be scaled down, got size %d", result.Spec.Size)
+		}
+		if result.Status.Autoscaling == nil || !strings.Contains(result.Status.Autoscaling.Message, reason) {
+			t.Errorf("Expected the status to explain why the cluster is not scaled down, got: %+v", result.Status.Autoscaling)
+		}
+		jobs, err := c.kc.BatchV1().Jobs("default").List(k8smetav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs.Items) != 0 {
+			t.Errorf("Expected no nodes to be removed, got: %d jobs", len(jobs.Items))
+		}
+		o = result
+	}
+
+	// Not scaled down unless the nodes can be removed from the Raft group.
+	update := func() {
+		t.Helper()
+		var err error
+		if o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Update(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refused("allowAddRemoveNode")
+	o.Spec.Config.Cluster = &stanv1alpha1.ClusterConfig{AllowAddRemoveNode: true}
+	update()
+
+	// Nor while the nodes kept would not form a quorum of all the
+	// voters of the Raft group, including those whose pod is gone.
+	o.Status.RaftPeers = []string{"stan-1", "stan-2", "stan-3", "stan-4", "stan-5", "stan-6", "stan-7"}
+	update()
+	refused("quorum of the 7 voters")
+	o.Status.RaftPeers = []string{"stan-1", "stan-2", "stan-3", "stan-4", "stan-5"}
+	update()
+	o.Status.Stats.Nodes[2] = stanv1alpha1.NodeStats{Name: "stan-3"}
+	update()
+	refused("quorum of the 5 voters")
+	o.Status.Stats.Nodes[2] = stanv1alpha1.NodeStats{Name: "stan-3", State: "CLUSTERED", Role: "Follower"}
+	update()
+
+	// The departing nodes are removed through the leader before
+	// their pods are deleted.
+	removal := func() *k8sbatchv1.Job {
+		t.Helper()
+		if err := c.reconcileAutoscaling(o); err != nil {
+			t.Fatal(err)
+		}
+		o = getCluster()
+		if o.Spec.Size != 5 {
+			t.Fatalf("Expected the cluster not to be scaled down before the nodes are removed, got size %d", o.Spec.Size)
+		}
+		sd := o.Status.Autoscaling.ScaleDown
+		if sd == nil || sd.To != 3 || !reflect.DeepEqual(sd.Nodes, []string{"stan-4", "stan-5"}) {
+			t.Fatalf("Expected stan-4 and stan-5 to be removed, got: %+v", sd)
+		}
+		job, err := c.kc.BatchV1().Jobs("default").Get(sd.Job, k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	job := removal()
+	script := job.Spec.Template.Spec.Containers[0].Command[2]
+	for _, expected := range []string{
+		`for node in '"stan-4"' '"stan-5"'; do`,
+		`nats req --server 'nats://example-nats:4222' --timeout 10s --raw '_STAN.raft.stan.node.remove' "$node"`,
+		`if [ "$reply" != OK ]; then`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script, got:\n%s", expected, script)
+		}
+	}
+
+	// The cluster keeps its size when the removal fails.
+	job.Status.Conditions = []k8sbatchv1.JobCondition{{Type: k8sbatchv1.JobFailed, Status: k8scorev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	refused("removal of stan-4, stan-5 from the Raft group failed")
+	if as := o.Status.Autoscaling; as.ScaleDown != nil || as.LastScaleTime == nil {
+		t.Errorf("Expected the scale down to be retried after the cooldown, got: %+v", as)
+	}
+
+	past := k8smetav1.NewTime(time.Now().Add(-DefaultScaleDownCooldown))
+	o.Status.Autoscaling.LastScaleTime = &past
+	job = removal()
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcileAutoscaling(o); err != nil {
+		t.Fatal(err)
+	}
+	result := getCluster()
+	if result.Spec.Size != 3 || o.Spec.Size != 3 {
+		t.Fatalf("Expected the cluster to be scaled down to 3 nodes, got size %d", result.Spec.Size)
+	}
+	if as := result.Status.Autoscaling; as == nil || as.LastScaleTime == nil || as.ScaleDown != nil {
+		t.Fatalf("Expected the scaling to be recorded, got: %+v", as)
+	}
+	if !reflect.DeepEqual(result.Status.RaftPeers, []string{"stan-1", "stan-2", "stan-3"}) {
+		t.Errorf("Expected the removed nodes not to be voters anymore, got: %v", result.Status.RaftPeers)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get(job.Name, k8smetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected job %s to be deleted", job.Name)
+	}
+
+	// The nodes with the highest ordinals are removed.
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	pods, err := c.findRunningPods("stan", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"stan-1", "stan-2", "stan-3"}) {
+		t.Errorf("Expected stan-4 and stan-5 to be removed, got: %v", names)
+	}
+
+	// Not scaled back up within the cooldown.
+	o = result
+	o.Status.Stats.Clients = 1000
+	if err := c.reconcileAutoscaling(o); err != nil {
+		t.Fatal(err)
+	}
+	if result := getCluster(); result.Spec.Size != 3 {
+		t.Errorf("Expected the cluster not to be scaled up within the cooldown, got size %d", result.Spec.Size)
+	}
+	past = k8smetav1.NewTime(time.Now().Add(-DefaultScaleUpCooldown))
+	o.Status.Autoscaling.LastScaleTime = &past
+	if err := c.reconcileAutoscaling(o); err != nil {
+		t.Fatal(err)
+	}
+	if result := getCluster(); result.Spec.Size != 5 {
+		t.Errorf("Expected the cluster to be scaled up to 5 nodes, got size %d", result.Spec.Size)
+	}
+}
+
+func TestReconcileAutoscalingAboveMaxSize(t *testing.T) {
+	o := newTestStoreCluster("stan", 7)
+	o.Spec.Config.Cluster = &stanv1alpha1.ClusterConfig{AllowAddRemoveNode: true}
+	o.Spec.Autoscaling = &stanv1alpha1.AutoscalingConfig{
+		MinSize: 3,
+		MaxSize: 3,
+		Metrics: []stanv1alpha1.AutoscalingMetric{{Type: stanv1alpha1.AutoscalingClients, ScaleUpAbove: 100, ScaleDownBelow: 20}},
+	}
+	now := k8smetav1.Now()
+	o.Status.Stats = &stanv1alpha1.ClusterStats{LastScrapeTime: &now}
+	for i := 1; i <= 7; i++ {
+		role := "Follower"
+		if i == 1 {
+			role = "Leader"
+		}
+		o.Status.Stats.Nodes = append(o.Status.Stats.Nodes, stanv1alpha1.NodeStats{Name: fmt.Sprintf("stan-%d", i), State: "CLUSTERED", Role: role})
+	}
+	// Within the cooldown, which does not apply to the bounds.
+	o.Status.Autoscaling = &stanv1alpha1.AutoscalingStatus{LastScaleTime: &now}
+	c := newTestController([]k8sruntime.Object{o}, newTestStorePods(o)...)
+	c.recorder = k8srecord.NewFakeRecorder(10)
+
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		t.Helper()
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// Scaled down two nodes at a time, each time only deleting the
+	// pods once the departing nodes are removed from the Raft group.
+	for _, step := range []struct {
+		from, to  int32
+		departing []string
+	}{
+		{7, 5, []string{"stan-6", "stan-7"}},
+		{5, 3, []string{"stan-4", "stan-5"}},
+	} {
+		if err := c.reconcileAutoscaling(o); err != nil {
+			t.Fatal(err)
+		}
+		o = getCluster()
+		if o.Spec.Size != step.from {
+			t.Fatalf("Expected the cluster not to be scaled down before the nodes are removed, got size %d", o.Spec.Size)
+		}
+		sd := o.Status.Autoscaling.ScaleDown
+		if sd == nil || sd.To != step.to || !reflect.DeepEqual(sd.Nodes, step.departing) {
+			t.Fatalf("Expected %v to be removed, got: %+v", step.departing, sd)
+		}
+		if err := c.reconcileSize(o); err != nil {
+			t.Fatal(err)
+		}
+		if pods, err := c.findRunningPods("stan", "default"); err != nil || len(pods) != int(step.from) {
+			t.Fatalf("Expected no pods to be deleted before the nodes are removed, got: %d %v", len(pods), err)
+		}
+
+		job, err := c.kc.BatchV1().Jobs("default").Get(sd.Job, k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Status.Succeeded = 1
+		if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.reconcileAutoscaling(o); err != nil {
+			t.Fatal(err)
+		}
+		o = getCluster()
+		if o.Spec.Size != step.to {
+			t.Fatalf("Expected the cluster to be scaled down to %d nodes, got size %d", step.to, o.Spec.Size)
+		}
+		if err := c.reconcileSize(o); err != nil {
+			t.Fatal(err)
+		}
+		if pods, err := c.findRunningPods("stan", "default"); err != nil || len(pods) != int(step.to) {
+			t.Fatalf("Expected the pods of the removed nodes to be deleted, got: %d %v", len(pods), err)
+		}
+	}
+}
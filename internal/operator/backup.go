@@ -0,0 +1,774 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfields "k8s.io/apimachinery/pkg/fields"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+	k8scache "k8s.io/client-go/tools/cache"
+	k8sretry "k8s.io/client-go/util/retry"
+)
+
+const (
+	// backupVolumeName is the volume of the backup job
+	// with the target PersistentVolumeClaim.
+	backupVolumeName = "stan-backup-target"
+
+	// backupMountPath is where the target PersistentVolumeClaim
+	// is mounted in the backup job.
+	backupMountPath = "/backup"
+
+	// backupJobBackoffLimit is how many times the backup job is
+	// retried before the backup is considered failed.
+	backupJobBackoffLimit = 2
+
+	// backupCopyAttempts is how many times the backup job copies
+	// a store that changed during the copy before giving up, and
+	// backupCopyRetrySeconds how long it waits in between.
+	backupCopyAttempts     = 3
+	backupCopyRetrySeconds = 10
+)
+
+var (
+	// errNoBackupNode is returned when there is no node of the
+	// cluster that can be backed up at the moment.
+	errNoBackupNode = errors.New("no follower available to back up")
+
+	// errBackupQuorum is returned when stopping the follower to
+	// back up would leave the rest of the cluster without quorum.
+	errBackupQuorum = errors.New("no follower can be stopped while keeping the quorum")
+
+	// errBackupBusy is returned while the nodes of the cluster are
+	// stopped or their stores changed by another operation.
+	errBackupBusy = errors.New("the nodes are being updated, repaired, switched to another mode or recovered")
+)
+
+// newResourceInformer returns an informer subscribed to the
+// changes of one of the other resources of the operator.
+func newResourceInformer(
+	c *Controller,
+	resource string,
+	objType k8sruntime.Object,
+	resourceFuncs k8scache.ResourceEventHandlerFuncs,
+	indexers k8scache.Indexers,
+	interval time.Duration,
+) (k8scache.Indexer, k8scache.Controller) {
+	listWatcher := k8scache.NewListWatchFromClient(
+		c.ncr.StreamingV1alpha1().RESTClient(),
+		resource,
+		c.opts.Namespace,
+		k8sfields.Everything(),
+	)
+	return k8scache.NewIndexerInformer(
+		listWatcher,
+		objType,
+		interval,
+		resourceFuncs,
+		indexers,
+	)
+}
+
+func (c *Controller) processBackup(ctx context.Context, v interface{}) error {
+	b := v.(*stanv1alpha1.NatsStreamingBackup)
+	if b.DeletionTimestamp != nil {
+		return nil
+	}
+	return c.reconcileBackup(b)
+}
+
+func backupJobName(b *stanv1alpha1.NatsStreamingBackup) string {
+	return fmt.Sprintf("%s-backup", b.Name)
+}
+
+func backupLabels(name string) map[string]string {
+	return map[string]string{
+		"app":         "nats-streaming-backup",
+		"stan_backup": name,
+	}
+}
+
+func backupOwnerRef(b *stanv1alpha1.NatsStreamingBackup) k8smetav1.OwnerReference {
+	return *k8smetav1.NewControllerRef(b, k8sschema.GroupVersionKind{
+		Group:   stanv1alpha1.SchemeGroupVersion.Group,
+		Version: stanv1alpha1.SchemeGroupVersion.Version,
+		Kind:    "NatsStreamingBackup",
+	})
+}
+
+// backupArchiveName is the name of the archive of a backup.
+func backupArchiveName(b *stanv1alpha1.NatsStreamingBackup) string {
+	return fmt.Sprintf("%s.tar.gz", b.Name)
+}
+
+// backupLocation is the URL where the archive of a backup is stored.
+func backupLocation(b *stanv1alpha1.NatsStreamingBackup) string {
+	target := b.Spec.Target
+	if target.S3 != nil {
+		return fmt.Sprintf("s3://%s/%s%s", target.S3.Bucket, target.S3.Prefix, backupArchiveName(b))
+	}
+	return fmt.Sprintf("pvc://%s", path.Join(target.PersistentVolumeClaim.ClaimName, target.PersistentVolumeClaim.Path, backupArchiveName(b)))
+}
+
+func validateBackup(b *stanv1alpha1.NatsStreamingBackup) error {
+	if b.Spec.ClusterName == "" {
+		return fmt.Errorf("clusterName is required")
+	}
+	return validateBackupTarget(&b.Spec.Target)
+}
+
+func validateBackupTarget(target *stanv1alpha1.BackupTarget) error {
+	if (target.PersistentVolumeClaim == nil) == (target.S3 == nil) {
+		return fmt.Errorf("exactly one of persistentVolumeClaim or s3 has to be set")
+	}
+	if pvc := target.PersistentVolumeClaim; pvc != nil {
+		if pvc.ClaimName == "" {
+			return fmt.Errorf("persistentVolumeClaim.claimName is required")
+		}
+		if path.IsAbs(pvc.Path) || strings.HasPrefix(path.Clean(pvc.Path), "..") {
+			return fmt.Errorf("persistentVolumeClaim.path has to be relative to the volume, got %q", pvc.Path)
+		}
+	}
+	if s3 := target.S3; s3 != nil {
+		if !strings.HasPrefix(s3.Endpoint, "http://") && !strings.HasPrefix(s3.Endpoint, "https://") {
+			return fmt.Errorf("s3.endpoint has to be an http or https URL, got %q", s3.Endpoint)
+		}
+		if s3.Bucket == "" {
+			return fmt.Errorf("s3.bucket is required")
+		}
+		if s3.CredentialsSecret == "" {
+			return fmt.Errorf("s3.credentialsSecret is required")
+		}
+	}
+	return nil
+}
+
+// storePaths returns the directory with the stores of the
+// cluster and the paths within it that belong to a node,
+// following the layout set in stanContainerCmd.
+func storePaths(o *stanv1alpha1.NatsStreamingCluster, node string) (string, []string, error) {
+	if o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" {
+		return "", nil, fmt.Errorf("only the file store can be backed up")
+	}
+	if o.Spec.Config == nil || o.Spec.Config.StoreDir == "" {
+		return "", nil, fmt.Errorf("the store of the cluster is not on a volume, config.storeDir has to be set")
+	}
+	storeDir := o.Spec.Config.StoreDir
+	if isFTMode(o) {
+		return storeDir, []string{fmt.Sprintf("%s-1", o.Name)}, nil
+	}
+	if isClustered(o) {
+		return storeDir, []string{node, path.Join("raft", node)}, nil
+	}
+	return storeDir, []string{node}, nil
+}
+
+// storeVolumes returns the volumes of the pod with the store
+// directory and how they are mounted.
+func storeVolumes(pod *k8scorev1.Pod, storeDir string) ([]k8scorev1.Volume, []k8scorev1.VolumeMount) {
+	volumes := make(map[string]k8scorev1.Volume)
+	for _, volume := range pod.Spec.Volumes {
+		volumes[volume.Name] = volume
+	}
+
+	var podVolumes []k8scorev1.Volume
+	var mounts []k8scorev1.VolumeMount
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "stan" {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			volume, ok := volumes[mount.Name]
+			if !ok {
+				continue
+			}
+			mountPath := strings.TrimSuffix(mount.MountPath, "/")
+			if storeDir != mountPath && !strings.HasPrefix(storeDir, mountPath+"/") {
+				continue
+			}
+			mounts = append(mounts, mount)
+			podVolumes = append(podVolumes, volume)
+		}
+	}
+	return podVolumes, mounts
+}
+
+// shellQuote quotes a word for the backup scripts.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+func shellQuoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// mcCommand is the MinIO client command for an S3 target.
+func mcCommand(s3 *stanv1alpha1.S3BackupTarget) string {
+	if s3.Insecure {
+		return "mc --insecure"
+	}
+	return "mc"
+}
+
+// s3EnvVars are the environment variables with the endpoint and
+// credentials of an S3 target used by the scripts.
+func s3EnvVars(s3 *stanv1alpha1.S3BackupTarget) []k8scorev1.EnvVar {
+	secretKey := func(key string) *k8scorev1.EnvVarSource {
+		return &k8scorev1.EnvVarSource{
+			SecretKeyRef: &k8scorev1.SecretKeySelector{
+				LocalObjectReference: k8scorev1.LocalObjectReference{Name: s3.CredentialsSecret},
+				Key:                  key,
+			},
+		}
+	}
+	return []k8scorev1.EnvVar{
+		{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+		{Name: "S3_ACCESS_KEY", ValueFrom: secretKey("accessKey")},
+		{Name: "S3_SECRET_KEY", ValueFrom: secretKey("secretKey")},
+	}
+}
+
+// backupScript archives the store of a node to the target and
+// writes the size of the archive as the termination message of
+// the container, from where it is recorded in the status.
+//
+// The store is first copied next to the archive, and the copy is
+// only archived when the checksums of its files match the ones of
+// the store before and after the copy, so that a store that is
+// written to while it is copied is not archived half way.  The
+// checksums are part of the archive as SHA256SUMS, which is
+// verified when the archive is restored.
+func backupScript(b *stanv1alpha1.NatsStreamingBackup, storeDir string, paths []string) string {
+	archive := path.Join("/tmp", backupArchiveName(b))
+	if pvc := b.Spec.Target.PersistentVolumeClaim; pvc != nil {
+		archive = path.Join(backupMountPath, pvc.Path, backupArchiveName(b))
+	}
+	store, files := shellQuote(storeDir), shellQuoteAll(paths)
+
+	lines := []string{
+		"set -e",
+		"work=$(mktemp -d)",
+		fmt.Sprintf(`sums() { (cd "$1" && find %s -type f -exec sha256sum {} + | sort -k 2); }`, files),
+		fmt.Sprintf("(cd %s && ls -d %s) > /dev/null", store, files),
+		fmt.Sprintf("for attempt in $(seq %d); do", backupCopyAttempts),
+		`  rm -rf "$work/store" && mkdir "$work/store"`,
+		fmt.Sprintf(`  sums %s > "$work/before"`, store),
+		fmt.Sprintf(`  tar -cf - -C %s %s | tar -xf - -C "$work/store"`, store, files),
+		`  sums "$work/store" > "$work/copied"`,
+		fmt.Sprintf(`  sums %s > "$work/after"`, store),
+		`  if cmp -s "$work/before" "$work/copied" && cmp -s "$work/before" "$work/after"; then break; fi`,
+		`  rm -f "$work/copied"`,
+		fmt.Sprintf("  sleep %d", backupCopyRetrySeconds),
+		"done",
+		`if [ ! -f "$work/copied" ]; then echo "The store kept changing while it was copied" >&2; exit 1; fi`,
+		`mv "$work/copied" "$work/store/SHA256SUMS"`,
+		fmt.Sprintf("mkdir -p %s", shellQuote(path.Dir(archive))),
+		fmt.Sprintf(`tar -czf %s -C "$work/store" SHA256SUMS %s`, shellQuote(archive), files),
+		`rm -rf "$work"`,
+	}
+	if s3 := b.Spec.Target.S3; s3 != nil {
+		mc := mcCommand(s3)
+		key := path.Join(s3.Bucket, s3.Prefix+backupArchiveName(b))
+		lines = append(lines,
+			fmt.Sprintf(`%s alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY"`, mc),
+			fmt.Sprintf("%s cp %s %s", mc, shellQuote(archive), shellQuote("target/"+key)),
+		)
+	}
+	lines = append(lines, fmt.Sprintf("stat -c %%s %s > /dev/termination-log", shellQuote(archive)))
+	return strings.Join(lines, "\n")
+}
+
+// newBackupJob returns the job that backs up the store of a node.
+func newBackupJob(
+	o *stanv1alpha1.NatsStreamingCluster,
+	b *stanv1alpha1.NatsStreamingBackup,
+	node *k8scorev1.Pod,
+) (*k8sbatchv1.Job, error) {
+	storeDir, paths, err := storePaths(o, node.Name)
+	if err != nil {
+		return nil, err
+	}
+	volumes, mounts := storeVolumes(node, storeDir)
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no volume of pod %s has the store directory %s", node.Name, storeDir)
+	}
+	for i := range mounts {
+		mounts[i].ReadOnly = true
+	}
+
+	job := newTargetJob(k8smetav1.ObjectMeta{
+		Name:            backupJobName(b),
+		Namespace:       b.Namespace,
+		Labels:          backupLabels(b.Name),
+		OwnerReferences: []k8smetav1.OwnerReference{backupOwnerRef(b)},
+	}, b.Spec.Image, &b.Spec.Target, backupScript(b, storeDir, paths), volumes, mounts)
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.ImagePullSecrets = o.Spec.ImagePullSecrets
+
+	// Volumes that can only be attached to a single node are
+	// still shared with the pod being backed up on its node.
+	// The hostname label of a node may differ from its name, so the
+	// job is bound to the node directly.
+	podSpec.NodeName = node.Spec.NodeName
+	return job, nil
+}
+
+// newTargetJob returns a job that runs a script with access to a
+// backup target, which is mounted at backupMountPath in case of a
+// PersistentVolumeClaim.
+func newTargetJob(
+	meta k8smetav1.ObjectMeta,
+	image string,
+	target *stanv1alpha1.BackupTarget,
+	script string,
+	volumes []k8scorev1.Volume,
+	mounts []k8scorev1.VolumeMount,
+) *k8sbatchv1.Job {
+	if image == "" {
+		image = DefaultBackupImage
+	}
+	container := k8scorev1.Container{
+		Name:    "backup",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", script},
+		Env: []k8scorev1.EnvVar{
+			// The MinIO client keeps its configuration in the home directory.
+			{Name: "HOME", Value: "/tmp"},
+		},
+		VolumeMounts: mounts,
+	}
+
+	if pvc := target.PersistentVolumeClaim; pvc != nil {
+		volumes = append(volumes, k8scorev1.Volume{
+			Name: backupVolumeName,
+			VolumeSource: k8scorev1.VolumeSource{
+				PersistentVolumeClaim: &k8scorev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvc.ClaimName,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, k8scorev1.VolumeMount{
+			Name:      backupVolumeName,
+			MountPath: backupMountPath,
+		})
+	}
+	if s3 := target.S3; s3 != nil {
+		container.Env = append(container.Env, s3EnvVars(s3)...)
+	}
+
+	backoffLimit := int32(backupJobBackoffLimit)
+	return &k8sbatchv1.Job{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: meta,
+		Spec: k8sbatchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: k8scorev1.PodTemplateSpec{
+				ObjectMeta: k8smetav1.ObjectMeta{Labels: meta.Labels},
+				Spec: k8scorev1.PodSpec{
+					RestartPolicy: k8scorev1.RestartPolicyNever,
+					Containers:    []k8scorev1.Container{container},
+					Volumes:       volumes,
+				},
+			},
+		},
+	}
+}
+
+// backupNode returns the pod whose store is backed up.  Followers
+// are preferred so that the leader is not slowed down, and in case
+// of a Raft cluster only followers are backed up, which are stopped
+// during the backup so only while the other nodes keep the quorum.
+func (c *Controller) backupNode(o *stanv1alpha1.NatsStreamingCluster) (*k8scorev1.Pod, error) {
+	if busy := storeOperation(&o.Status); busy != "" {
+		log.Debugf("Not backing up '%s/%s' cluster while %s", o.Namespace, o.Name, busy)
+		return nil, errBackupBusy
+	}
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var ready []*k8scorev1.Pod
+	for _, pod := range pods {
+		if podIsReady(pod) {
+			ready = append(ready, pod)
+		}
+	}
+	if !isClustered(o) {
+		if len(ready) == 0 {
+			return nil, errNoBackupNode
+		}
+		return ready[0], nil
+	}
+
+	var follower *k8scorev1.Pod
+	var members int32
+	for _, pod := range ready {
+		info, err := c.serverInfo(pod)
+		if err != nil {
+			log.Debugf("Could not get the role of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		switch info.Role {
+		case serverRoleLeader:
+			members++
+		case serverRoleFollower:
+			members++
+			if follower == nil {
+				follower = pod
+			}
+		}
+	}
+	if follower == nil {
+		return nil, errNoBackupNode
+	}
+	if members-1 < quorumSize(o.Spec.Size) {
+		return nil, errBackupQuorum
+	}
+	return follower, nil
+}
+
+// storeOperation describes the operation in progress that stops the
+// nodes of a cluster or changes their stores, which backups wait for.
+func storeOperation(status *stanv1alpha1.NatsStreamingClusterStatus) string {
+	switch {
+	case status.ModeTransition != nil:
+		return fmt.Sprintf("it is switched to %s mode", status.ModeTransition.To)
+	case status.QuorumRecovery != nil:
+		return "its Raft group is recovered"
+	case len(status.Updates) > 0:
+		return "its pods are updated"
+	case status.RaftHealth != nil && len(status.RaftHealth.Rejoining) > 0:
+		return "its nodes rejoin the Raft group"
+	}
+	return ""
+}
+
+// isBackupNode returns whether a node is kept stopped by a backup.
+func isBackupNode(o *stanv1alpha1.NatsStreamingCluster, name string) bool {
+	for _, node := range o.Status.BackupNodes {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stoppedBackupNodes returns how many of the nodes kept stopped by
+// backups no longer have a pod.
+func stoppedBackupNodes(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod) int {
+	stopped := len(o.Status.BackupNodes)
+	for _, pod := range pods {
+		if isBackupNode(o, pod.Name) {
+			stopped--
+		}
+	}
+	return stopped
+}
+
+// releaseBackupNodes releases the nodes of a cluster that were kept
+// stopped by backups which are done or gone, so that they are
+// recreated.
+func (c *Controller) releaseBackupNodes(o *stanv1alpha1.NatsStreamingCluster) error {
+	var released []string
+	for _, node := range o.Status.BackupNodes {
+		b, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups(o.Namespace).Get(node.Backup, k8smetav1.GetOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && b.Status.Phase != stanv1alpha1.BackupCompleted && b.Status.Phase != stanv1alpha1.BackupFailed {
+			continue
+		}
+		log.Infof("Releasing node %s of '%s/%s' cluster stopped by backup %s", node.Name, o.Namespace, o.Name, node.Backup)
+		released = append(released, node.Name)
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	release := func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		var nodes []stanv1alpha1.BackupNode
+		for _, node := range status.BackupNodes {
+			if !containsString(released, node.Name) {
+				nodes = append(nodes, node)
+			}
+		}
+		status.BackupNodes = nodes
+	}
+	if err := c.updateStatus(o, release); err != nil {
+		return err
+	}
+	release(&o.Status)
+	return nil
+}
+
+// backupSize returns the size of the archive written by the
+// backup job to the termination message of its container.
+func (c *Controller) backupSize(b *stanv1alpha1.NatsStreamingBackup) (int64, error) {
+	message, err := c.jobTerminationMessage(b.Namespace, backupJobName(b))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+}
+
+// jobTerminationMessage returns what the container of a completed
+// job wrote to its termination message.
+func (c *Controller) jobTerminationMessage(namespace, name string) (string, error) {
+	pods, err := c.kc.CoreV1().Pods(namespace).List(k8smetav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(map[string]string{"job-name": name}).String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			term := status.State.Terminated
+			if term == nil || term.ExitCode != 0 {
+				continue
+			}
+			return term.Message, nil
+		}
+	}
+	return "", fmt.Errorf("no completed pod of job %s", name)
+}
+
+func jobFailed(job *k8sbatchv1.Job) (bool, string) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == k8sbatchv1.JobFailed && cond.Status == k8scorev1.ConditionTrue {
+			return true, cond.Message
+		}
+	}
+	return false, ""
+}
+
+// reconcileBackup advances a backup by one step: picking the
+// node and starting the job, then recording its result.
+func (c *Controller) reconcileBackup(b *stanv1alpha1.NatsStreamingBackup) error {
+	switch b.Status.Phase {
+	case stanv1alpha1.BackupCompleted, stanv1alpha1.BackupFailed:
+		return nil
+	}
+
+	fail := func(err error) error {
+		log.Errorf("Backup '%s/%s' failed: %s", b.Namespace, b.Name, err)
+		now := k8smetav1.Now()
+		return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+			status.Phase = stanv1alpha1.BackupFailed
+			status.Message = err.Error()
+			status.CompletionTime = &now
+		})
+	}
+	if err := validateBackup(b); err != nil {
+		return fail(fmt.Errorf("invalid spec: %s", err))
+	}
+
+	if b.Status.Job == "" {
+		return c.startBackup(b, fail)
+	}
+
+	job, err := c.kc.BatchV1().Jobs(b.Namespace).Get(b.Status.Job, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fail(fmt.Errorf("job %s was deleted", b.Status.Job))
+	} else if err != nil {
+		return err
+	}
+	if failed, message := jobFailed(job); failed {
+		return fail(fmt.Errorf("job %s failed: %s", job.Name, message))
+	}
+	if job.Status.Succeeded == 0 {
+		return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+			status.Message = fmt.Sprintf("Archiving the store of %s (active=%d, failed=%d)", status.Node, job.Status.Active, job.Status.Failed)
+		})
+	}
+
+	size, err := c.backupSize(b)
+	if err != nil {
+		log.Warnf("Could not get the size of backup '%s/%s': %s", b.Namespace, b.Name, err)
+	}
+	log.Infof("Backup '%s/%s' completed (location=%s, size=%d)", b.Namespace, b.Name, b.Status.Location, size)
+	completionTime := k8smetav1.Now()
+	if job.Status.CompletionTime != nil {
+		completionTime = *job.Status.CompletionTime
+	}
+	return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+		status.Phase = stanv1alpha1.BackupCompleted
+		status.Message = ""
+		status.Size = size
+		status.CompletionTime = &completionTime
+	})
+}
+
+func (c *Controller) startBackup(b *stanv1alpha1.NatsStreamingBackup, fail func(error) error) error {
+	o, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters(b.Namespace).Get(b.Spec.ClusterName, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fail(fmt.Errorf("cluster %s not found", b.Spec.ClusterName))
+	} else if err != nil {
+		return err
+	}
+	if b.Status.Node != "" {
+		return c.stopBackupNode(o, b, fail)
+	}
+
+	node, err := c.backupNode(o)
+	if err == errNoBackupNode || err == errBackupQuorum || err == errBackupBusy {
+		return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+			status.Phase = stanv1alpha1.BackupPending
+			status.Message = fmt.Sprintf("Waiting for a node of %s to back up: %s", o.Name, err)
+		})
+	} else if err != nil {
+		return err
+	}
+
+	now := k8smetav1.Now()
+	if isClustered(o) {
+		// The store of the follower is archived once it stopped.
+		log.Infof("Stopping pod '%s/%s' to back up its store", node.Namespace, node.Name)
+		err := c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+			status.Phase = stanv1alpha1.BackupRunning
+			status.Message = fmt.Sprintf("Stopping %s to archive its store", node.Name)
+			status.Node = node.Name
+			status.Location = backupLocation(b)
+			status.StartTime = &now
+		})
+		if err != nil {
+			return err
+		}
+		b.Status.Node = node.Name
+		return c.stopBackupNode(o, b, fail)
+	}
+
+	job, err := newBackupJob(o, b, node)
+	if err != nil {
+		return fail(err)
+	}
+	log.Infof("Creating backup job '%s/%s' for pod %s", job.Namespace, job.Name, node.Name)
+	_, err = c.kc.BatchV1().Jobs(b.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+		status.Phase = stanv1alpha1.BackupRunning
+		status.Message = fmt.Sprintf("Archiving the store of %s", node.Name)
+		status.Node = node.Name
+		status.Job = job.Name
+		status.Location = backupLocation(b)
+		status.StartTime = &now
+	})
+}
+
+// stopBackupNode keeps the node of a backup of a Raft cluster
+// stopped, and starts the job once its pod is gone.
+func (c *Controller) stopBackupNode(
+	o *stanv1alpha1.NatsStreamingCluster,
+	b *stanv1alpha1.NatsStreamingBackup,
+	fail func(error) error,
+) error {
+	name := b.Status.Node
+	// Checked again against the latest status when the node is
+	// recorded, since the cluster is reconciled at the same time.
+	var busy string
+	err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		busy = ""
+		for _, node := range status.BackupNodes {
+			if node.Name == name {
+				return
+			}
+		}
+		if busy = storeOperation(status); busy != "" {
+			return
+		}
+		status.BackupNodes = append(status.BackupNodes, stanv1alpha1.BackupNode{Name: name, Backup: b.Name})
+	})
+	if err != nil {
+		return err
+	}
+	if busy != "" {
+		return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+			status.Message = fmt.Sprintf("Waiting to stop %s while %s", name, busy)
+		})
+	}
+
+	pod, err := c.kc.CoreV1().Pods(b.Namespace).Get(name, k8smetav1.GetOptions{})
+	if err == nil {
+		if pod.DeletionTimestamp == nil {
+			err = c.kc.CoreV1().Pods(b.Namespace).Delete(name, &k8smetav1.DeleteOptions{})
+			if err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	// The job mounts the volumes the pod of the node would have.
+	job, err := newBackupJob(o, b, newStanNodePod(o, name))
+	if err != nil {
+		return fail(err)
+	}
+	log.Infof("Creating backup job '%s/%s' for stopped pod %s", job.Namespace, job.Name, name)
+	_, err = c.kc.BatchV1().Jobs(b.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return c.updateBackupStatus(b, func(status *stanv1alpha1.NatsStreamingBackupStatus) {
+		status.Message = fmt.Sprintf("Archiving the store of stopped %s", name)
+		status.Job = job.Name
+	})
+}
+
+// updateBackupStatus applies the changes to the latest status of
+// the backup, only sending an update in case there was any change.
+func (c *Controller) updateBackupStatus(
+	b *stanv1alpha1.NatsStreamingBackup,
+	update func(status *stanv1alpha1.NatsStreamingBackupStatus),
+) error {
+	backups := c.ncr.StreamingV1alpha1().NatsStreamingBackups(b.Namespace)
+	return k8sretry.RetryOnConflict(k8sretry.DefaultRetry, func() error {
+		current, err := backups.Get(b.Name, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := current.DeepCopy()
+		update(&updated.Status)
+		if reflect.DeepEqual(current, updated) {
+			return nil
+		}
+		_, err = backups.Update(updated)
+		return err
+	})
+}
@@ -0,0 +1,464 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileBackup(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-backup", Namespace: "default"},
+		Spec: stanv1alpha1.NatsStreamingBackupSpec{
+			ClusterName: "stan",
+			Target: stanv1alpha1.BackupTarget{
+				S3: &stanv1alpha1.S3BackupTarget{
+					Endpoint:          "http://minio:9000",
+					Bucket:            "backups",
+					Prefix:            "stan/",
+					CredentialsSecret: "minio-credentials",
+				},
+			},
+		},
+	}
+	c := newTestController([]k8sruntime.Object{o, b}, newTestStorePods(o)...)
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader"}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+		"10.0.0.3:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+	}
+	getBackup := func() *stanv1alpha1.NatsStreamingBackup {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Get("stan-backup", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// The follower is stopped first.
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	b = getBackup()
+	if b.Status.Phase != stanv1alpha1.BackupRunning || b.Status.Node != "stan-2" || b.Status.Job != "" || b.Status.Location != "s3://backups/stan/stan-backup.tar.gz" {
+		t.Fatalf("Expected the follower to be stopped, got: %+v", b.Status)
+	}
+	if _, err := c.kc.CoreV1().Pods("default").Get("stan-2", k8smetav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("Expected pod of the follower to be deleted, got: %v", err)
+	}
+	o = getCluster()
+	if len(o.Status.BackupNodes) != 1 || o.Status.BackupNodes[0] != (stanv1alpha1.BackupNode{Name: "stan-2", Backup: "stan-backup"}) {
+		t.Fatalf("Expected the follower to be kept stopped, got: %+v", o.Status.BackupNodes)
+	}
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kc.CoreV1().Pods("default").Get("stan-2", k8smetav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("Expected pod of the follower not to be recreated during the backup, got: %v", err)
+	}
+
+	// The job is started once the pod is gone.
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	b = getBackup()
+	if b.Status.Phase != stanv1alpha1.BackupRunning || b.Status.Job == "" {
+		t.Fatalf("Expected backup of the follower to be running, got: %+v", b.Status)
+	}
+	job, err := c.kc.BatchV1().Jobs("default").Get(b.Status.Job, k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	script := spec.Containers[0].Command[2]
+	for _, expected := range []string{
+		`tar -cf - -C '/pv/stan' 'stan-2' 'raft/stan-2' | tar -xf - -C "$work/store"`,
+		`tar -czf '/tmp/stan-backup.tar.gz' -C "$work/store" SHA256SUMS 'stan-2' 'raft/stan-2'`,
+		`mc alias set target "$S3_ENDPOINT"`,
+		`mc cp '/tmp/stan-backup.tar.gz' 'target/backups/stan/stan-backup.tar.gz'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script, got:\n%s", expected, script)
+		}
+	}
+	if spec.Containers[0].Image != DefaultBackupImage {
+		t.Errorf("Expected the default backup image, got: %s", spec.Containers[0].Image)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].PersistentVolumeClaim.ClaimName != "stan-pvc" || !spec.Containers[0].VolumeMounts[0].ReadOnly {
+		t.Errorf("Expected the store volume to be mounted read only, got: %+v", spec.Volumes)
+	}
+
+	// Still running.
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	if b = getBackup(); b.Status.Phase != stanv1alpha1.BackupRunning {
+		t.Fatalf("Expected backup to be running, got: %+v", b.Status)
+	}
+
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	pod := newTestPod("stan-backup-backup-abcde")
+	pod.Labels = map[string]string{"job-name": job.Name}
+	pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{
+		Name: "backup",
+		State: k8scorev1.ContainerState{
+			Terminated: &k8scorev1.ContainerStateTerminated{Message: "1048576\n"},
+		},
+	}}
+	if _, err := c.kc.CoreV1().Pods("default").Create(pod); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	b = getBackup()
+	if b.Status.Phase != stanv1alpha1.BackupCompleted || b.Status.Size != 1048576 || b.Status.CompletionTime == nil {
+		t.Errorf("Expected backup to be completed, got: %+v", b.Status)
+	}
+
+	// The follower is recreated after the backup.
+	o = getCluster()
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(getCluster().Status.BackupNodes) != 0 {
+		t.Errorf("Expected the follower to be released, got: %+v", getCluster().Status.BackupNodes)
+	}
+	if _, err := c.kc.CoreV1().Pods("default").Get("stan-2", k8smetav1.GetOptions{}); err != nil {
+		t.Errorf("Expected pod of the follower to be recreated, got: %v", err)
+	}
+}
+
+func TestReconcileBackupWithoutFollower(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-backup", Namespace: "default"},
+		Spec: stanv1alpha1.NatsStreamingBackupSpec{
+			ClusterName: "stan",
+			Target: stanv1alpha1.BackupTarget{
+				PersistentVolumeClaim: &stanv1alpha1.PVCBackupTarget{ClaimName: "backups"},
+			},
+		},
+	}
+	c := newTestController([]k8sruntime.Object{o, b}, newTestStorePods(o)...)
+	c.hc = fakeHTTPClient{}
+
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Get("stan-backup", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status.Phase != stanv1alpha1.BackupPending || b.Status.Job != "" {
+		t.Errorf("Expected backup to wait for a follower, got: %+v", b.Status)
+	}
+
+	// Stopping the only follower would leave the leader alone.
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader"}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+	}
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	b, err = c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Get("stan-backup", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status.Phase != stanv1alpha1.BackupPending || b.Status.Node != "" || !strings.Contains(b.Status.Message, errBackupQuorum.Error()) {
+		t.Errorf("Expected backup to wait for the quorum, got: %+v", b.Status)
+	}
+	if _, err := c.kc.CoreV1().Pods("default").Get("stan-2", k8smetav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the follower to keep running, got: %v", err)
+	}
+}
+
+func TestBackupWaitsForStoreOperations(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Status.ModeTransition = &stanv1alpha1.ModeTransition{
+		From:  stanv1alpha1.ModeClustered,
+		To:    stanv1alpha1.ModeFaultTolerance,
+		Phase: stanv1alpha1.ModeTransitionStopping,
+	}
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-backup", Namespace: "default"},
+		Spec: stanv1alpha1.NatsStreamingBackupSpec{
+			ClusterName: "stan",
+			Target: stanv1alpha1.BackupTarget{
+				PersistentVolumeClaim: &stanv1alpha1.PVCBackupTarget{ClaimName: "backups"},
+			},
+		},
+	}
+	c := newTestController([]k8sruntime.Object{o, b}, newTestStorePods(o)...)
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader"}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+		"10.0.0.3:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+	}
+	getBackup := func() *stanv1alpha1.NatsStreamingBackup {
+		t.Helper()
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Get("stan-backup", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	if b = getBackup(); b.Status.Phase != stanv1alpha1.BackupPending || !strings.Contains(b.Status.Message, errBackupBusy.Error()) {
+		t.Errorf("Expected backup to wait for the mode switch, got: %+v", b.Status)
+	}
+
+	// A node picked before the recovery started is not stopped.
+	o, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Status.ModeTransition = nil
+	o.Status.QuorumRecovery = &stanv1alpha1.QuorumRecovery{Phase: stanv1alpha1.QuorumRecoveryStopping}
+	if _, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Update(o); err != nil {
+		t.Fatal(err)
+	}
+	b.Status.Phase = stanv1alpha1.BackupRunning
+	b.Status.Node = "stan-2"
+	if b, err = c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Update(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcileBackup(b); err != nil {
+		t.Fatal(err)
+	}
+	if b = getBackup(); !strings.Contains(b.Status.Message, "Waiting to stop stan-2") || b.Status.Job != "" {
+		t.Errorf("Expected backup to wait for the recovery, got: %+v", b.Status)
+	}
+	if _, err := c.kc.CoreV1().Pods("default").Get("stan-2", k8smetav1.GetOptions{}); err != nil {
+		t.Errorf("Expected stan-2 to keep running, got: %v", err)
+	}
+	if o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{}); err != nil || len(o.Status.BackupNodes) != 0 {
+		t.Errorf("Expected stan-2 not to be kept stopped, got: %+v %v", o.Status.BackupNodes, err)
+	}
+}
+
+func TestBackupJobOnNodeOfPod(t *testing.T) {
+	o := newTestStoreCluster("stan", 1)
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-backup", Namespace: "default"},
+		Spec: stanv1alpha1.NatsStreamingBackupSpec{
+			ClusterName: "stan",
+			Target: stanv1alpha1.BackupTarget{
+				PersistentVolumeClaim: &stanv1alpha1.PVCBackupTarget{ClaimName: "backups"},
+			},
+		},
+	}
+	node := newTestStorePods(o)[0].(*k8scorev1.Pod)
+	job, err := newBackupJob(o, b, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hostname label of the node may differ from its name.
+	if spec := job.Spec.Template.Spec; spec.NodeName != "node-1" || len(spec.NodeSelector) != 0 {
+		t.Errorf("Expected the job to run on the node of the pod, got: %q %v", spec.NodeName, spec.NodeSelector)
+	}
+}
+
+func TestBackupScriptUpload(t *testing.T) {
+	for _, tool := range []string{"sh", "tar", "sha256sum", "curl", "cmp", "find", "stat", "seq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to run the backup script", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "stan-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storeDir := filepath.Join(dir, "store")
+	files := map[string]string{
+		"stan-2/clients.dat":         "clients",
+		"stan-2/foo/msgs.1.dat":      "messages",
+		"raft/stan-2/raft.log":       "log",
+		"stan-1/clients.dat":         "not backed up",
+		"raft/stan-2/snapshots/1.sn": "snapshot",
+	}
+	for name, content := range files {
+		file := filepath.Join(storeDir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The S3 endpoint records the uploaded objects.
+	uploads := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPut || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		uploads[r.URL.Path] = body
+	}))
+	defer server.Close()
+
+	// The MinIO client is replaced by a script that uploads with
+	// a plain PUT to the endpoint set with its alias.
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mc := `#!/bin/sh
+set -e
+case "$1" in
+alias) echo "$4" > "$HOME/endpoint" ;;
+cp) curl -sf -T "$2" "$(cat "$HOME/endpoint")/${3#target/}" ;;
+*) exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(bin, "mc"), []byte(mc), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: filepath.Base(dir), Namespace: "default"},
+		Spec: stanv1alpha1.NatsStreamingBackupSpec{
+			ClusterName: "stan",
+			Target: stanv1alpha1.BackupTarget{
+				S3: &stanv1alpha1.S3BackupTarget{
+					Endpoint:          server.URL,
+					Bucket:            "backups",
+					Prefix:            "stan/",
+					CredentialsSecret: "minio-credentials",
+				},
+			},
+		},
+	}
+	defer os.Remove(filepath.Join("/tmp", backupArchiveName(b)))
+	terminationLog := filepath.Join(dir, "termination-log")
+	script := strings.Replace(backupScript(b, storeDir, []string{"stan-2", "raft/stan-2"}), "/dev/termination-log", terminationLog, -1)
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(os.Environ(),
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"HOME="+dir,
+		"S3_ENDPOINT="+server.URL,
+		"S3_ACCESS_KEY=minio",
+		"S3_SECRET_KEY=minio123",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Backup script failed: %v\n%s", err, out)
+	}
+
+	archive, ok := uploads["/backups/stan/"+backupArchiveName(b)]
+	if !ok {
+		t.Fatalf("Expected the archive to be uploaded, got: %v", uploads)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archived[strings.TrimPrefix(hdr.Name, "./")] = string(content)
+	}
+	for name, content := range files {
+		if strings.HasPrefix(name, "stan-1/") {
+			if _, ok := archived[name]; ok {
+				t.Errorf("Expected %s not to be archived", name)
+			}
+			continue
+		}
+		if archived[name] != content {
+			t.Errorf("Expected %s to be archived with %q, got: %q", name, content, archived[name])
+		}
+		sum := sha256.Sum256([]byte(content))
+		if line := fmt.Sprintf("%x  %s\n", sum, name); !strings.Contains(archived["SHA256SUMS"], line) {
+			t.Errorf("Expected %q in the checksums, got:\n%s", line, archived["SHA256SUMS"])
+		}
+	}
+
+	// The size of the upload is reported through the termination
+	// message of the job and recorded in the status.
+	message, err := ioutil.ReadFile(terminationLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newTestStoreCluster("stan", 3)
+	c := newTestController([]k8sruntime.Object{o, b})
+	pod := newTestPod(backupJobName(b) + "-abcde")
+	pod.Labels = map[string]string{"job-name": backupJobName(b)}
+	pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{
+		Name: "backup",
+		State: k8scorev1.ContainerState{
+			Terminated: &k8scorev1.ContainerStateTerminated{Message: string(message)},
+		},
+	}}
+	if _, err := c.kc.CoreV1().Pods("default").Create(pod); err != nil {
+		t.Fatal(err)
+	}
+	size, err := c.backupSize(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(archive)) {
+		t.Errorf("Expected size of the upload %d, got: %d", len(archive), size)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func wantsForceBootstrap(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return o.Annotations[ForceBootstrapAnnotation] == "true"
+}
+
+// shouldBootstrap returns whether the Raft group of the cluster has
+// to be bootstrapped.  A cluster is only bootstrapped once, since
+// bootstrapping a node again over existing Raft state would make it
+// form a new group, so the decision is taken from the status of the
+// cluster and from the Raft logs on the store volume, never from
+// what the operator has seen since it started.  It also returns
+// whether the pods have to wait for the Raft logs to be looked for.
+func (c *Controller) shouldBootstrap(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod) (bool, bool, error) {
+	// The status may have been updated earlier during this same
+	// reconciliation, so always get the latest one.
+	current, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters(o.Namespace).Get(o.Name, k8smetav1.GetOptions{})
+	if err != nil {
+		return false, false, err
+	}
+
+	if wantsForceBootstrap(current) {
+		if len(pods) > 0 {
+			log.Warnf("Refusing to bootstrap '%s/%s' cluster again while it has %d pods running", o.Namespace, o.Name, len(pods))
+			return false, false, nil
+		}
+		log.Warnf("Bootstrapping '%s/%s' cluster again as requested by the %s annotation", o.Namespace, o.Name, ForceBootstrapAnnotation)
+		return true, false, nil
+	}
+
+	if current.Status.Bootstrapped {
+		if len(pods) == 0 {
+			log.Warnf("Recreating the pods of '%s/%s' cluster without bootstrapping it again, annotate it with %s=true in case its Raft state was lost",
+				o.Namespace, o.Name, ForceBootstrapAnnotation)
+		}
+		return false, false, nil
+	}
+
+	if len(pods) > 0 {
+		// The cluster was formed before its bootstrap was
+		// recorded, so only record it from now on.
+		log.Infof("Recording '%s/%s' cluster as bootstrapped", o.Namespace, o.Name)
+		err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Bootstrapped = true
+		})
+		return false, false, err
+	}
+
+	// The recovery of a quorum removes all the Raft logs before
+	// bootstrapping the first node alone.
+	if r := current.Status.QuorumRecovery; r != nil && r.Phase == stanv1alpha1.QuorumRecoveryStarting {
+		return true, false, nil
+	}
+
+	// All the pods of a cluster formed before its bootstrap was
+	// recorded may be gone, leaving only its Raft logs behind.
+	nodes, checked, err := c.existingRaftLogs(o)
+	if err != nil || !checked {
+		return false, true, err
+	}
+	if len(nodes) > 0 {
+		log.Warnf("Not bootstrapping '%s/%s' cluster, %s already have a Raft log, annotate it with %s=true in case it has to be bootstrapped again",
+			o.Namespace, o.Name, strings.Join(nodes, ", "), ForceBootstrapAnnotation)
+		c.event(o, k8scorev1.EventTypeWarning, "BootstrapRefused",
+			"Not bootstrapping the Raft group, %s already have a Raft log, recording it as bootstrapped", strings.Join(nodes, ", "))
+		err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Bootstrapped = true
+		})
+		return false, false, err
+	}
+	return true, false, nil
+}
+
+func raftLogsJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-raft-logs", o.Name)
+}
+
+func raftLogsLabels(o *stanv1alpha1.NatsStreamingCluster) map[string]string {
+	return map[string]string{
+		"app":          "nats-streaming-raft-logs",
+		"stan_cluster": o.Name,
+	}
+}
+
+// raftLogsScript writes the names of the nodes with a Raft log in
+// the store directory to the termination message, one per line.
+func raftLogsScript(storeDir string) string {
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("for dir in %s/*; do", shellQuote(path.Join(storeDir, "raft"))),
+		`  if [ -d "$dir" ] && [ -n "$(ls -A "$dir")" ]; then basename "$dir"; fi`,
+		"done > /dev/termination-log",
+	}, "\n")
+}
+
+// newRaftLogsJob returns the job that lists the Raft logs on the
+// store volume, nil when the store is not on a volume.
+func newRaftLogsJob(o *stanv1alpha1.NatsStreamingCluster) *k8sbatchv1.Job {
+	return newStoreReaderJob(o, k8smetav1.ObjectMeta{
+		Name:            raftLogsJobName(o),
+		Namespace:       o.Namespace,
+		Labels:          raftLogsLabels(o),
+		OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+	}, DefaultRejoinImage, raftLogsScript(storeDir(o)))
+}
+
+// newStoreReaderJob returns a job running the script in the image with
+// the store volume of the nodes mounted read-only, nil when the store
+// is not on a volume.
+func newStoreReaderJob(o *stanv1alpha1.NatsStreamingCluster, meta k8smetav1.ObjectMeta, image, script string) *k8sbatchv1.Job {
+	node := newStanNodePod(o, fmt.Sprintf("%s-1", o.Name))
+	volumes, mounts := storeVolumes(node, storeDir(o))
+	if storeDir(o) == "" || len(mounts) == 0 {
+		return nil
+	}
+	for i := range mounts {
+		mounts[i].ReadOnly = true
+	}
+
+	job := newTargetJob(meta, image, &stanv1alpha1.BackupTarget{}, script, volumes, mounts)
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.ImagePullSecrets = o.Spec.ImagePullSecrets
+	podSpec.SecurityContext = node.Spec.SecurityContext
+	return job
+}
+
+// existingRaftLogs returns the nodes with a Raft log on the store
+// volume, and whether the job listing them is done.  The job is
+// only deleted once done, so that it is not run again on every
+// reconciliation, and has to be deleted to be retried once failed.
+// Without a store volume there cannot be any Raft log left.
+func (c *Controller) existingRaftLogs(o *stanv1alpha1.NatsStreamingCluster) ([]string, bool, error) {
+	desired := newRaftLogsJob(o)
+	if desired == nil {
+		return nil, true, nil
+	}
+	job, err := c.kc.BatchV1().Jobs(o.Namespace).Get(desired.Name, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		log.Infof("Creating job '%s/%s' to look for the Raft logs of '%s/%s' cluster before bootstrapping it", desired.Namespace, desired.Name, o.Namespace, o.Name)
+		_, err := c.kc.BatchV1().Jobs(o.Namespace).Create(desired)
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			return nil, false, err
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if job.DeletionTimestamp != nil {
+		return nil, false, nil
+	}
+	if failed, message := jobFailed(job); failed {
+		return nil, false, fmt.Errorf("job %s failed to look for the Raft logs of '%s/%s' cluster, delete it to retry: %s", job.Name, o.Namespace, o.Name, message)
+	}
+	if job.Status.Succeeded == 0 {
+		return nil, false, nil
+	}
+	message, err := c.jobTerminationMessage(o.Namespace, job.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	err = c.kc.BatchV1().Jobs(o.Namespace).Delete(job.Name, k8sDeleteInBackground())
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, false, err
+	}
+	return strings.Fields(message), true, nil
+}
+
+// recordInitialPeers records once the nodes that form the Raft group
+// with explicit peers, before any of them is created.  The list is
+// never changed afterwards, so that resizing the cluster neither
+// changes the command of the existing nodes nor makes the new ones
+// form a group of their own.  It is recorded as bootstrapped once
+// the nodes have been created, in case the formation mode is changed
+// later on.
+func (c *Controller) recordInitialPeers(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod) error {
+	if o.Status.Bootstrapped && len(o.Status.InitialPeers) > 0 {
+		return nil
+	}
+	peers := o.Status.InitialPeers
+	if len(peers) == 0 && len(pods) > 0 {
+		// The cluster was formed before its peers were recorded.
+		sort.Slice(pods, func(i, j int) bool {
+			return podOrdinal(o, pods[i]) < podOrdinal(o, pods[j])
+		})
+		for _, pod := range pods {
+			peers = append(peers, pod.Name)
+		}
+	} else if len(peers) == 0 {
+		for i := 1; i <= int(o.Spec.Size); i++ {
+			peers = append(peers, fmt.Sprintf("%s-%d", o.Name, i))
+		}
+	}
+	bootstrapped := len(pods) > 0
+
+	var recorded []string
+	err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		if len(status.InitialPeers) == 0 {
+			status.InitialPeers = peers
+		}
+		status.Bootstrapped = status.Bootstrapped || bootstrapped
+		recorded = status.InitialPeers
+	})
+	if err != nil {
+		return err
+	}
+	o.Status.Bootstrapped = o.Status.Bootstrapped || bootstrapped
+	o.Status.InitialPeers = recorded
+	return nil
+}
+
+// bootstrapCluster creates the pod that bootstraps the Raft group
+// and records it in the status of the cluster, which forgets the
+// voters of any group it had before.
+func (c *Controller) bootstrapCluster(o *stanv1alpha1.NatsStreamingCluster) error {
+	pod, err := c.createBootstrapPod(o)
+	if err != nil {
+		return err
+	}
+
+	now := k8smetav1.Now()
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		delete(cluster.Annotations, ForceBootstrapAnnotation)
+		cluster.Status.Bootstrapped = true
+		cluster.Status.BootstrapNode = pod.Name
+		cluster.Status.BootstrapTime = &now
+		cluster.Status.RaftPeers = nil
+	})
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	stanfake "github.com/nats-io/nats-streaming-operator/pkg/client/v1alpha1/fake"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileSizeBootstrapsOnce(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	c := newTestController([]k8sruntime.Object{o})
+	clusters := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default")
+	pods := c.kc.CoreV1().Pods("default")
+
+	bootstrapped := func() []string {
+		list, err := pods.List(k8smetav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, pod := range list.Items {
+			if strings.Contains(strings.Join(pod.Spec.Containers[0].Command, " "), "-cluster_bootstrap") {
+				names = append(names, pod.Name)
+			}
+		}
+		return names
+	}
+	deletePods := func() {
+		list, err := pods.List(k8smetav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pod := range list.Items {
+			if err := pods.Delete(pod.Name, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	if got := bootstrapped(); !reflect.DeepEqual(got, []string{"stan-1"}) {
+		t.Fatalf("Expected stan-1 to bootstrap the cluster, got: %v", got)
+	}
+	o, err := clusters.Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.Status.Bootstrapped || o.Status.BootstrapNode != "stan-1" || o.Status.BootstrapTime == nil {
+		t.Fatalf("Expected bootstrap to be recorded, got: %+v", o.Status)
+	}
+
+	// After a restart of the operator with all the pods gone the
+	// cluster is not bootstrapped again.
+	deletePods()
+	c = newTestController(nil)
+	c.ncr = stanfake.NewSimpleClientset(o)
+	clusters = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default")
+	pods = c.kc.CoreV1().Pods("default")
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	if got := bootstrapped(); len(got) != 0 {
+		t.Fatalf("Expected no bootstrap pods, got: %v", got)
+	}
+	list, err := pods.List(k8smetav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 3 {
+		t.Fatalf("Expected pods to be recreated, got %d", len(list.Items))
+	}
+
+	// The bootstrap can be forced once there are no pods.
+	o.Annotations = map[string]string{ForceBootstrapAnnotation: "true"}
+	if o, err = clusters.Update(o); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	deletePods()
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	if got := bootstrapped(); !reflect.DeepEqual(got, []string{"stan-1"}) {
+		t.Fatalf("Expected forced bootstrap, got: %v", got)
+	}
+	o, err = clusters.Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantsForceBootstrap(o) {
+		t.Errorf("Expected annotation to be removed, got: %v", o.Annotations)
+	}
+}
+
+func TestReconcileSizeLooksForRaftLogs(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		message   string
+		bootstrap bool
+	}{
+		{"raft logs left", "stan-1\nstan-2\n", false},
+		{"no raft logs", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestStoreCluster("stan", 3)
+			c := newTestController([]k8sruntime.Object{o})
+			pods := c.kc.CoreV1().Pods("default")
+			jobs := c.kc.BatchV1().Jobs("default")
+
+			// The pods are only created once the job is done.
+			if err := c.reconcileSize(o); err != nil {
+				t.Fatal(err)
+			}
+			if list, err := pods.List(k8smetav1.ListOptions{}); err != nil || len(list.Items) != 0 {
+				t.Fatalf("Expected no pods before looking for Raft logs, got: %v %v", list, err)
+			}
+			job, err := jobs.Get("stan-raft-logs", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec := job.Spec.Template.Spec
+			if script := spec.Containers[0].Command[2]; !strings.Contains(script, `for dir in '/pv/stan/raft'/*; do`) {
+				t.Errorf("Expected the Raft logs of the store volume to be listed, got:\n%s", script)
+			}
+			if len(spec.Volumes) != 1 || spec.Volumes[0].PersistentVolumeClaim.ClaimName != "stan-pvc" || !spec.Containers[0].VolumeMounts[0].ReadOnly {
+				t.Errorf("Expected the store volume to be mounted read only, got: %+v", spec.Volumes)
+			}
+
+			job.Status.Succeeded = 1
+			if _, err := jobs.Update(job); err != nil {
+				t.Fatal(err)
+			}
+			pod := newTestPod("stan-raft-logs-abcde")
+			pod.Labels = map[string]string{"job-name": job.Name}
+			pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{
+				Name: "backup",
+				State: k8scorev1.ContainerState{
+					Terminated: &k8scorev1.ContainerStateTerminated{Message: tc.message},
+				},
+			}}
+			if _, err := pods.Create(pod); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.reconcileSize(o); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jobs.Get(job.Name, k8smetav1.GetOptions{}); err == nil {
+				t.Errorf("Expected job to be deleted once done")
+			}
+			if err := pods.Delete(pod.Name, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.bootstrap {
+				// The pods are recreated with their Raft logs instead.
+				if err := c.reconcileSize(o); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			list, err := pods.List(k8smetav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bootstrapped []string
+			for _, pod := range list.Items {
+				if strings.Contains(strings.Join(pod.Spec.Containers[0].Command, " "), "-cluster_bootstrap") {
+					bootstrapped = append(bootstrapped, pod.Name)
+				}
+			}
+			if tc.bootstrap && !reflect.DeepEqual(bootstrapped, []string{"stan-1"}) {
+				t.Errorf("Expected stan-1 to bootstrap the cluster, got: %v", bootstrapped)
+			}
+			if !tc.bootstrap && (len(bootstrapped) != 0 || len(list.Items) != 3) {
+				t.Errorf("Expected the pods to be created without bootstrapping, got %d pods and %v bootstrapping", len(list.Items), bootstrapped)
+			}
+			result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Status.Bootstrapped {
+				t.Errorf("Expected cluster to be recorded as bootstrapped, got: %+v", result.Status)
+			}
+		})
+	}
+}
+
+func TestReconcileSizeExplicitPeers(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{
+		Cluster: &stanv1alpha1.ClusterConfig{ExplicitPeers: true},
+	})
+	c := newTestController([]k8sruntime.Object{o})
+
+	// All the nodes are created at once with the same peers.
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	pods, err := c.kc.CoreV1().Pods("default").List(k8smetav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 3 {
+		t.Fatalf("Expected all pods to be created, got %d", len(pods.Items))
+	}
+	peers := `--cluster_peers="stan-1","stan-2","stan-3"`
+	for _, pod := range pods.Items {
+		cmd := strings.Join(pod.Spec.Containers[0].Command, " ")
+		if strings.Contains(cmd, "-cluster_bootstrap") || !strings.Contains(cmd, peers) {
+			t.Errorf("Expected %s to have the peers and no bootstrap flag, got: %s", pod.Name, cmd)
+		}
+	}
+	o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Status.Bootstrapped || o.Status.BootstrapNode != "" {
+		t.Errorf("Expected cluster to be recorded as formed once its peers are created, got: %+v", o.Status)
+	}
+	if !reflect.DeepEqual(o.Status.InitialPeers, []string{"stan-1", "stan-2", "stan-3"}) {
+		t.Errorf("Expected the peers that formed the cluster to be recorded, got: %v", o.Status.InitialPeers)
+	}
+
+	// Scaling neither changes the existing nodes nor gives the peers
+	// to the new ones, which join the group through the leader.
+	o.Spec.Size = 5
+	for _, existing := range pods.Items {
+		if newStanNodePod(o, existing.Name).Annotations[PodSpecHashAnnotation] != existing.Annotations[PodSpecHashAnnotation] {
+			t.Errorf("Expected %s not to be outdated after scaling", existing.Name)
+		}
+	}
+	if err := c.reconcileSize(o); err != nil {
+		t.Fatal(err)
+	}
+	pod, err := c.kc.CoreV1().Pods("default").Get("stan-5", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := strings.Join(pod.Spec.Containers[0].Command, " "); strings.Contains(cmd, "-cluster_peers") || strings.Contains(cmd, "-cluster_bootstrap") {
+		t.Errorf("Expected a node added later to join through the leader, got: %s", cmd)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Status.InitialPeers, o.Status.InitialPeers) {
+		t.Errorf("Expected the initial peers not to change, got: %v", result.Status.InitialPeers)
+	}
+	if !result.Status.Bootstrapped || result.Status.BootstrapNode != "" {
+		t.Errorf("Expected cluster formed by its peers to be recorded, got: %+v", result.Status)
+	}
+}
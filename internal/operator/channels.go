@@ -0,0 +1,266 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8scache "k8s.io/client-go/tools/cache"
+	k8sretry "k8s.io/client-go/util/retry"
+)
+
+// Same default store limits as the server.
+const (
+	defaultMaxChannels = 100
+	defaultMaxMsgs     = 1000000
+	defaultMaxBytes    = 1000000 * 1024
+	defaultMaxSubs     = 1000
+)
+
+// storeLimits are the parsed limits of the store or of a channel,
+// where zero is unlimited for the store and unset for a channel.
+type storeLimits struct {
+	maxChannels int64
+	maxMsgs     int64
+	maxBytes    int64
+	maxAge      time.Duration
+	maxSubs     int64
+}
+
+// globalStoreLimits returns the limits of the store of a cluster
+// with a valid spec, including the defaults of the server.
+func globalStoreLimits(o *stanv1alpha1.NatsStreamingCluster) storeLimits {
+	limits := storeLimits{
+		maxChannels: defaultMaxChannels,
+		maxMsgs:     defaultMaxMsgs,
+		maxBytes:    defaultMaxBytes,
+		maxSubs:     defaultMaxSubs,
+	}
+	if o.Spec.Config == nil || o.Spec.Config.StoreLimits == nil {
+		return limits
+	}
+	sl := o.Spec.Config.StoreLimits
+	if sl.MaxChannels > 0 {
+		limits.maxChannels = int64(sl.MaxChannels)
+	}
+	if sl.MaxMsgs > 0 {
+		limits.maxMsgs = sl.MaxMsgs
+	}
+	if sl.MaxBytes != "" {
+		limits.maxBytes, _ = parseSize(sl.MaxBytes)
+	}
+	if sl.MaxAge != "" {
+		limits.maxAge, _ = time.ParseDuration(sl.MaxAge)
+	}
+	if sl.MaxSubs > 0 {
+		limits.maxSubs = int64(sl.MaxSubs)
+	}
+	return limits
+}
+
+func parseChannelLimits(cl *stanv1alpha1.ChannelLimits) (storeLimits, error) {
+	limits := storeLimits{maxMsgs: cl.MaxMsgs, maxSubs: int64(cl.MaxSubs)}
+	if cl.MaxMsgs < 0 {
+		return limits, fmt.Errorf("maxMsgs must not be negative, got %d", cl.MaxMsgs)
+	}
+	if cl.MaxSubs < 0 {
+		return limits, fmt.Errorf("maxSubs must not be negative, got %d", cl.MaxSubs)
+	}
+	if cl.MaxBytes != "" {
+		n, err := parseSize(cl.MaxBytes)
+		if err != nil {
+			return limits, fmt.Errorf("maxBytes has an invalid size %q", cl.MaxBytes)
+		}
+		limits.maxBytes = n
+	}
+	if cl.MaxAge != "" {
+		d, err := time.ParseDuration(cl.MaxAge)
+		if err != nil || d < 0 {
+			return limits, fmt.Errorf("maxAge has an invalid duration %q", cl.MaxAge)
+		}
+		limits.maxAge = d
+	}
+	return limits, nil
+}
+
+// validateChannelLimits checks that the limits of a channel are
+// valid for the cluster and do not exceed its global limits, which
+// the server refuses.
+func validateChannelLimits(o *stanv1alpha1.NatsStreamingCluster, cl *stanv1alpha1.ChannelLimits) error {
+	if !validChannel(cl.Channel) {
+		return fmt.Errorf("invalid channel %q", cl.Channel)
+	}
+	if isPartitioned(o) {
+		owned := false
+		for _, pattern := range o.Spec.Config.Partitioning.Channels {
+			owned = owned || channelCovers(pattern, cl.Channel)
+		}
+		if !owned {
+			return fmt.Errorf("channel %q is not part of the partition of the cluster", cl.Channel)
+		}
+	}
+	limits, err := parseChannelLimits(cl)
+	if err != nil {
+		return err
+	}
+	global := globalStoreLimits(o)
+	for _, limit := range []struct {
+		name           string
+		value, maximum int64
+	}{
+		{"maxMsgs", limits.maxMsgs, global.maxMsgs},
+		{"maxBytes", limits.maxBytes, global.maxBytes},
+		{"maxSubs", limits.maxSubs, global.maxSubs},
+	} {
+		if limit.maximum > 0 && limit.value > limit.maximum {
+			return fmt.Errorf("%s %d exceeds the global limit of %d", limit.name, limit.value, limit.maximum)
+		}
+	}
+	if global.maxAge > 0 && limits.maxAge > global.maxAge {
+		return fmt.Errorf("maxAge %s exceeds the global limit of %s", limits.maxAge, global.maxAge)
+	}
+	return nil
+}
+
+// channelClusterIndex is the index of the cache of the
+// NatsStreamingChannels by the namespace and name of their cluster.
+const channelClusterIndex = "cluster"
+
+var channelIndexers = k8scache.Indexers{
+	channelClusterIndex: func(obj interface{}) ([]string, error) {
+		channel, ok := obj.(*stanv1alpha1.NatsStreamingChannel)
+		if !ok {
+			return nil, nil
+		}
+		return []string{channel.Namespace + "/" + channel.Spec.ClusterName}, nil
+	},
+}
+
+// clusterChannels returns the NatsStreamingChannels of a cluster
+// from the cache, oldest first.
+func (c *Controller) clusterChannels(o *stanv1alpha1.NatsStreamingCluster) ([]stanv1alpha1.NatsStreamingChannel, error) {
+	objs, err := c.channels.ByIndex(channelClusterIndex, o.Namespace+"/"+o.Name)
+	if err != nil {
+		return nil, err
+	}
+	var channels []stanv1alpha1.NatsStreamingChannel
+	for _, obj := range objs {
+		// The cached objects are shared, so they are copied.
+		channels = append(channels, *obj.(*stanv1alpha1.NatsStreamingChannel).DeepCopy())
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		a, b := channels[i].CreationTimestamp, channels[j].CreationTimestamp
+		if !a.Equal(&b) {
+			return a.Before(&b)
+		}
+		return channels[i].Name < channels[j].Name
+	})
+	return channels, nil
+}
+
+// reconcileChannels records the limits of the NatsStreamingChannels
+// of the cluster in its status, from which they are rendered in the
+// generated configuration file so that the nodes are rolled out with
+// them.  The limits that cannot be applied are refused in the status
+// of their NatsStreamingChannel instead.
+func (c *Controller) reconcileChannels(o *stanv1alpha1.NatsStreamingCluster) error {
+	channels, err := c.clusterChannels(o)
+	if err != nil {
+		return err
+	}
+
+	var applied []stanv1alpha1.ChannelLimits
+	owners := make(map[string]string)
+	declared := 0
+	if isPartitioned(o) {
+		for _, pattern := range o.Spec.Config.Partitioning.Channels {
+			owners[pattern] = ""
+		}
+		declared = len(owners)
+	}
+	maxChannels := globalStoreLimits(o).maxChannels
+	for i := range channels {
+		channel := &channels[i]
+		cl := channel.Spec.ChannelLimits
+		var refused error
+		owner, exists := owners[cl.Channel]
+		switch {
+		case o.Spec.ConfigFile != "":
+			refused = fmt.Errorf("cluster %s uses its own configuration file", o.Name)
+		case exists && owner != "":
+			refused = fmt.Errorf("channel %q already has limits from %s", cl.Channel, owner)
+		case !exists && maxChannels > 0 && int64(declared) >= maxChannels:
+			refused = fmt.Errorf("cluster %s already declares the maximum of %d channels", o.Name, maxChannels)
+		default:
+			refused = validateChannelLimits(o, &cl)
+		}
+
+		status := stanv1alpha1.NatsStreamingChannelStatus{Applied: true}
+		if refused != nil {
+			status = stanv1alpha1.NatsStreamingChannelStatus{Message: refused.Error()}
+		} else {
+			applied = append(applied, cl)
+			owners[cl.Channel] = channel.Name
+			if !exists {
+				declared++
+			}
+		}
+		if reflect.DeepEqual(channel.Status, status) {
+			continue
+		}
+		if refused != nil {
+			log.Warnf("Refusing limits of channel '%s/%s': %s", channel.Namespace, channel.Name, refused)
+		} else {
+			log.Infof("Applying limits of channel '%s/%s' to '%s/%s' cluster", channel.Namespace, channel.Name, o.Namespace, o.Name)
+		}
+		if err := c.updateChannelStatus(channel, status); err != nil {
+			return err
+		}
+	}
+
+	if reflect.DeepEqual(o.Status.ChannelLimits, applied) {
+		return nil
+	}
+	err = c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.ChannelLimits = applied
+	})
+	if err != nil {
+		return err
+	}
+	// Also used to render the configuration file.
+	o.Status.ChannelLimits = applied
+	return nil
+}
+
+func (c *Controller) updateChannelStatus(channel *stanv1alpha1.NatsStreamingChannel, status stanv1alpha1.NatsStreamingChannelStatus) error {
+	channels := c.ncr.StreamingV1alpha1().NatsStreamingChannels(channel.Namespace)
+	return k8sretry.RetryOnConflict(k8sretry.DefaultRetry, func() error {
+		current, err := channels.Get(channel.Name, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(current.Status, status) {
+			return nil
+		}
+		current.Status = status
+		_, err = channels.Update(current)
+		return err
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileChannels(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{
+		StoreLimits: &stanv1alpha1.StoreLimitsConfig{MaxMsgs: 100000, MaxAge: "48h"},
+	})
+	newChannel := func(name string, age time.Duration, limits stanv1alpha1.ChannelLimits) *stanv1alpha1.NatsStreamingChannel {
+		return &stanv1alpha1.NatsStreamingChannel{
+			ObjectMeta: k8smetav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: k8smetav1.NewTime(time.Now().Add(-age)),
+			},
+			Spec: stanv1alpha1.NatsStreamingChannelSpec{ClusterName: "stan", ChannelLimits: limits},
+		}
+	}
+	otherCluster := newChannel("audit", 3*time.Hour, stanv1alpha1.ChannelLimits{Channel: "audit", MaxMsgs: 10})
+	otherCluster.Spec.ClusterName = "stan-other"
+	otherNamespace := newChannel("audit", 3*time.Hour, stanv1alpha1.ChannelLimits{Channel: "audit", MaxMsgs: 10})
+	otherNamespace.Namespace = "other"
+	c := newTestController([]k8sruntime.Object{
+		o,
+		otherCluster,
+		otherNamespace,
+		newChannel("orders", 2*time.Hour, stanv1alpha1.ChannelLimits{Channel: "orders", MaxMsgs: 5000, MaxBytes: "64MB", MaxAge: "24h"}),
+		newChannel("orders-copy", time.Hour, stanv1alpha1.ChannelLimits{Channel: "orders", MaxMsgs: 10}),
+		newChannel("events", time.Hour, stanv1alpha1.ChannelLimits{Channel: "events.>", MaxMsgs: 200000}),
+		newChannel("logs", time.Hour, stanv1alpha1.ChannelLimits{Channel: "logs.*", MaxAge: "72h"}),
+	})
+	hash := podSpecHash(o, newStanPod(o))
+
+	if err := c.reconcileChannels(o); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"orders":      "",
+		"orders-copy": `channel "orders" already has limits from orders`,
+		"events":      "maxMsgs 200000 exceeds the global limit of 100000",
+		"logs":        "maxAge 72h0m0s exceeds the global limit of 48h0m0s",
+	} {
+		channel, err := c.ncr.StreamingV1alpha1().NatsStreamingChannels("default").Get(name, k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if channel.Status.Applied != (expected == "") || channel.Status.Message != expected {
+			t.Errorf("Expected status of %s to be refused with %q, got: %+v", name, expected, channel.Status)
+		}
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Status.ChannelLimits) != 1 || result.Status.ChannelLimits[0].Channel != "orders" {
+		t.Fatalf("Expected only the limits of orders to be applied, got: %+v", result.Status.ChannelLimits)
+	}
+
+	conf := stanConfigFile(o)
+	for _, expected := range []string{
+		"store_limits {\n  max_msgs: 100000\n  max_age: \"48h\"\n",
+		"    \"orders\": {\n      max_msgs: 5000\n      max_bytes: 67108864\n      max_age: \"24h\"\n    }\n",
+	} {
+		if !strings.Contains(conf, expected) {
+			t.Errorf("Expected %q in configuration file, got:\n%s", expected, conf)
+		}
+	}
+	if podSpecHash(o, newStanPod(o)) == hash {
+		t.Errorf("Expected the pods to be rolled out with the limits of the channels")
+	}
+
+	// Partitioned clusters only accept limits of their own channels.
+	o.Spec.Config.Partitioning = &stanv1alpha1.PartitioningConfig{Channels: []string{"orders", "users.*"}}
+	for channel, owned := range map[string]bool{"orders": true, "users.eu": true, "users.>": false, "payments": false} {
+		err := validateChannelLimits(o, &stanv1alpha1.ChannelLimits{Channel: channel})
+		if owned != (err == nil) {
+			t.Errorf("Expected channel %s to be owned=%v, got: %v", channel, owned, err)
+		}
+	}
+	if conf := stanConfigFile(o); strings.Count(conf, `"orders"`) != 1 || !strings.Contains(conf, `"users.*": {}`) {
+		t.Errorf("Expected the limits to be merged with the partition channels, got:\n%s", conf)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// configVolumeName is the name of the volume with the
+	// configuration file generated by the operator.
+	configVolumeName = "stan-operator-config"
+
+	// configMountPath is where the generated configuration
+	// file is mounted in the NATS Streaming container.
+	configMountPath = "/etc/stan-operator"
+
+	// configFileName is the key of the generated configuration
+	// file in the ConfigMap.
+	configFileName = "stan.conf"
+)
+
+func configMapName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-config", o.Name)
+}
+
+// stanConfigFile renders the options that the server only accepts
+// from a configuration file. It is empty when none are in use.
+func stanConfigFile(o *stanv1alpha1.NatsStreamingCluster) string {
+	var buf bytes.Buffer
+	if o.Spec.Config != nil && o.Spec.Config.Cluster != nil && isClustered(o) {
+		cc := o.Spec.Config.Cluster
+		var cluster bytes.Buffer
+		if cc.HeartbeatTimeout != "" {
+			fmt.Fprintf(&cluster, "  raft_heartbeat_timeout: %q\n", cc.HeartbeatTimeout)
+		}
+		if cc.ElectionTimeout != "" {
+			fmt.Fprintf(&cluster, "  raft_election_timeout: %q\n", cc.ElectionTimeout)
+		}
+		if cc.LeaseTimeout != "" {
+			fmt.Fprintf(&cluster, "  raft_lease_timeout: %q\n", cc.LeaseTimeout)
+		}
+		if cc.CommitTimeout != "" {
+			fmt.Fprintf(&cluster, "  raft_commit_timeout: %q\n", cc.CommitTimeout)
+		}
+		if cc.ProceedOnRestoreFailure {
+			fmt.Fprintf(&cluster, "  proceed_on_restore_failure: true\n")
+		}
+		if cluster.Len() > 0 {
+			fmt.Fprintf(&buf, "cluster {\n%s}\n", cluster.String())
+		}
+	}
+
+	if isPartitioned(o) {
+		fmt.Fprintf(&buf, "partitioning: true\n")
+	}
+	writeStoreLimits(&buf, o)
+
+	return buf.String()
+}
+
+// writeStoreLimits renders the global limits of the store and the
+// limits of the channels, which in case of partitioning also lists
+// the channels owned by the cluster.
+func writeStoreLimits(buf *bytes.Buffer, o *stanv1alpha1.NatsStreamingCluster) {
+	var limits bytes.Buffer
+	if o.Spec.Config != nil && o.Spec.Config.StoreLimits != nil {
+		sl := o.Spec.Config.StoreLimits
+		if sl.MaxChannels > 0 {
+			fmt.Fprintf(&limits, "  max_channels: %d\n", sl.MaxChannels)
+		}
+		writeLimits(&limits, "  ", sl.MaxMsgs, sl.MaxBytes, sl.MaxAge, sl.MaxSubs)
+	}
+
+	var names []string
+	channels := make(map[string]*stanv1alpha1.ChannelLimits)
+	if isPartitioned(o) {
+		names = append(names, o.Spec.Config.Partitioning.Channels...)
+	}
+	// The limits of the NatsStreamingChannels are refused when the
+	// cluster uses its own configuration file.
+	if o.Spec.ConfigFile == "" {
+		for i, cl := range o.Status.ChannelLimits {
+			if _, ok := channels[cl.Channel]; !ok && !containsString(names, cl.Channel) {
+				names = append(names, cl.Channel)
+			}
+			channels[cl.Channel] = &o.Status.ChannelLimits[i]
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&limits, "  channels {\n")
+		for _, name := range names {
+			var channel bytes.Buffer
+			if cl := channels[name]; cl != nil {
+				writeLimits(&channel, "      ", cl.MaxMsgs, cl.MaxBytes, cl.MaxAge, cl.MaxSubs)
+			}
+			if channel.Len() == 0 {
+				fmt.Fprintf(&limits, "    %q: {}\n", name)
+			} else {
+				fmt.Fprintf(&limits, "    %q: {\n%s    }\n", name, channel.String())
+			}
+		}
+		fmt.Fprintf(&limits, "  }\n")
+	}
+
+	if limits.Len() > 0 {
+		fmt.Fprintf(buf, "store_limits {\n%s}\n", limits.String())
+	}
+}
+
+func writeLimits(buf *bytes.Buffer, indent string, maxMsgs int64, maxBytes, maxAge string, maxSubs int32) {
+	if maxMsgs > 0 {
+		fmt.Fprintf(buf, "%smax_msgs: %d\n", indent, maxMsgs)
+	}
+	if maxBytes != "" {
+		// Rendered as a number of bytes, as the server expects an integer.
+		if n, err := parseSize(maxBytes); err == nil {
+			fmt.Fprintf(buf, "%smax_bytes: %d\n", indent, n)
+		}
+	}
+	if maxAge != "" {
+		fmt.Fprintf(buf, "%smax_age: %q\n", indent, maxAge)
+	}
+	if maxSubs > 0 {
+		fmt.Fprintf(buf, "%smax_subs: %d\n", indent, maxSubs)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newStanConfigMap(o *stanv1alpha1.NatsStreamingCluster, conf string) *k8scorev1.ConfigMap {
+	return &k8scorev1.ConfigMap{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:            configMapName(o),
+			Namespace:       o.Namespace,
+			OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+			Labels:          clusterLabels(o.Name),
+		},
+		Data: map[string]string{
+			configFileName: conf,
+		},
+	}
+}
+
+// reconcileConfigMap keeps the ConfigMap with the generated
+// configuration file in sync with the spec of the cluster.
+func (c *Controller) reconcileConfigMap(o *stanv1alpha1.NatsStreamingCluster) error {
+	cms := c.kc.CoreV1().ConfigMaps(o.Namespace)
+	name := configMapName(o)
+
+	conf := stanConfigFile(o)
+	current, err := cms.Get(name, k8smetav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	switch {
+	case conf == "" && exists:
+		log.Infof("Removing config map '%s/%s'", o.Namespace, name)
+		err := cms.Delete(name, &k8smetav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	case conf != "" && !exists:
+		log.Infof("Creating config map '%s/%s'", o.Namespace, name)
+		_, err := cms.Create(newStanConfigMap(o, conf))
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	case conf != "" && exists:
+		desired := newStanConfigMap(o, conf)
+		if reflect.DeepEqual(current.Data, desired.Data) {
+			return nil
+		}
+		log.Infof("Updating config map '%s/%s'", o.Namespace, name)
+		current.Data = desired.Data
+		if _, err := cms.Update(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
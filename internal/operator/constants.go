@@ -24,6 +24,22 @@ const (
 	// the latest release available.
 	DefaultNATSStreamingImage = "nats-streaming:0.18.0"
 
+	// DefaultBackupImage is the default image of the backup jobs,
+	// which has a shell, tar, sha256sum and the MinIO client for
+	// S3 targets.  It is pinned so that the jobs of all the backups
+	// and restores of a cluster run the same client.
+	DefaultBackupImage = "minio/mc:RELEASE.2020-10-03T02-54-56Z"
+
+	// DefaultRejoinImage is the image of the init container that
+	// wipes the store of a node rejoining its Raft group, which
+	// only needs a shell.
+	DefaultRejoinImage = "busybox:1.32.0"
+
+	// DefaultNodeRemovalImage is the image of the jobs that send
+	// the removal of nodes to the leader of a Raft group, which has
+	// a shell and the nats command line client.
+	DefaultNodeRemovalImage = "natsio/nats-box:0.4.0"
+
 	// DefaultNATSStreamingClusterSize is the default size
 	// for the cluster.  Clustering is done via Raft so
 	// an odd number of pods is recommended.
@@ -32,6 +48,75 @@ const (
 	// ResyncPeriod is how often the operator will be checking the resources.
 	ResyncPeriod = 5 * time.Second
 
+	// StatsScrapeInterval is how often the stats of the clusters
+	// are recorded from the monitoring endpoints of the nodes.
+	StatsScrapeInterval = 30 * time.Second
+
+	// DefaultRaftMaxLag is how many messages a follower can be
+	// behind the leader before it is considered to be lagging.
+	DefaultRaftMaxLag = 1000
+
+	// DefaultRaftHealthGracePeriod is how long a node of a Raft
+	// group has to be unhealthy before it is remediated.
+	DefaultRaftHealthGracePeriod = 5 * time.Minute
+
+	// DefaultScaleUpCooldown is how long to wait after the size of
+	// an autoscaled cluster changed before scaling it up.
+	DefaultScaleUpCooldown = 3 * time.Minute
+
+	// DefaultScaleDownCooldown is how long to wait after the size
+	// of an autoscaled cluster changed before scaling it down.
+	DefaultScaleDownCooldown = 15 * time.Minute
+
+	// DefaultMetricsAddress is the default address on which the
+	// operator serves its metrics, it can be set with the
+	// METRICS_ADDRESS environment variable, empty to disable them.
+	DefaultMetricsAddress = ":8080"
+
 	// MonitoringPort is the port for the server monitoring endpoint.
 	MonitoringPort = 8222
+
+	// EncryptionMigrationAnnotation has to be set to "true" on a
+	// cluster to allow enabling or disabling the encryption of an
+	// existing store.  It is removed once the change is accepted.
+	EncryptionMigrationAnnotation = "streaming.nats.io/encryption-migration"
+
+	// EncryptionKeyEnvVar is the environment variable from which
+	// the server reads the encryption key.
+	EncryptionKeyEnvVar = "NATS_STREAMING_ENCRYPTION_KEY"
+
+	// PodSpecHashAnnotation is the annotation of the pods with the
+	// hash of their desired spec, a mismatch makes them be recreated.
+	PodSpecHashAnnotation = "streaming.nats.io/pod-spec-hash"
+
+	// PausedAnnotation set to "true" on a cluster pauses its
+	// reconciliation, same as the paused field of the spec.
+	PausedAnnotation = "streaming.nats.io/paused"
+
+	// Finalizer is the finalizer of the clusters, which holds the
+	// deletion of a cluster until its resources are cleaned up.
+	Finalizer = "streaming.nats.io/finalizer"
+
+	// RetainedLabel is set on the PersistentVolumeClaims released
+	// by a deleted cluster, with the name of the cluster.  They are
+	// adopted again by a later cluster with the same name.
+	RetainedLabel = "streaming.nats.io/retained"
+
+	// ForceBootstrapAnnotation set to "true" on a cluster without
+	// running pods bootstraps its Raft group again, even though it
+	// was bootstrapped before.  It is removed once done.
+	ForceBootstrapAnnotation = "streaming.nats.io/force-bootstrap"
+
+	// RecoverQuorumAnnotation set on a clustered cluster that lost
+	// its quorum to the name of a node recovers its Raft group from
+	// the store of that node.  Set to "true" the node with the last
+	// entry of the most recent Raft log is selected once the nodes
+	// are stopped, which is refused when it cannot be told apart.
+	// It is removed once the recovery starts.
+	RecoverQuorumAnnotation = "streaming.nats.io/recover-quorum"
+
+	// RaftStateCommand is the command of the operator that writes
+	// the last entry of the Raft log of each node, run by the jobs
+	// selecting the survivor of a quorum recovery.
+	RaftStateCommand = "raft-state"
 )
@@ -15,10 +15,15 @@ package operator
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -26,6 +31,7 @@ import (
 
 	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
 	stancrdclient "github.com/nats-io/nats-streaming-operator/pkg/client/v1alpha1"
+	stanscheme "github.com/nats-io/nats-streaming-operator/pkg/client/v1alpha1/scheme"
 	log "github.com/sirupsen/logrus"
 	k8scorev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -34,11 +40,12 @@ import (
 	k8slabels "k8s.io/apimachinery/pkg/labels"
 	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
 	k8stypes "k8s.io/apimachinery/pkg/types"
-	k8sutilwait "k8s.io/apimachinery/pkg/util/wait"
 	k8sclient "k8s.io/client-go/kubernetes"
+	k8stypedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	k8srestapi "k8s.io/client-go/rest"
 	k8scache "k8s.io/client-go/tools/cache"
 	k8sclientcmd "k8s.io/client-go/tools/clientcmd"
+	k8srecord "k8s.io/client-go/tools/record"
 )
 
 // Options for the operator.
@@ -49,6 +56,23 @@ type Options struct {
 
 	// NoSignals marks whether to enable the signal handler.
 	NoSignals bool
+
+	// MetricsAddress is the address on which the metrics of the
+	// operator are served, they are not served in case it is empty.
+	MetricsAddress string
+
+	// HTTPClient is the client for the monitoring endpoints of the
+	// servers, by default an http.Client with a short timeout.
+	HTTPClient HTTPClient
+
+	// StatsScrapeInterval is how often the stats of the clusters
+	// are recorded, by default StatsScrapeInterval.
+	StatsScrapeInterval time.Duration
+
+	// Image is the image of the operator, run by the jobs that read
+	// the Raft logs of the nodes with RaftStateCommand.  Without it
+	// the survivor of a quorum recovery has to be named.
+	Image string
 }
 
 // Controller manages NATS Clusters running in Kubernetes.
@@ -61,9 +85,27 @@ type Controller struct {
 	// Client to interact with NATS Streaming Operator Kubernetes resources.
 	ncr stancrdclient.Interface
 
+	// hc is the client for the monitoring endpoints of the servers.
+	hc HTTPClient
+
+	// recorder of the events of the clusters, none are recorded
+	// until the clients are set up.
+	recorder k8srecord.EventRecorder
+
+	// metrics exported by the operator.
+	metrics *metrics
+
 	// clusters that the Operator is controlling.
 	clusters map[k8stypes.UID]*stanv1alpha1.NatsStreamingCluster
 
+	// sharedStores are the store volumes of the clusters in FT mode
+	// last checked to be shared by the nodes.
+	sharedStores map[k8stypes.UID]string
+
+	// channels is the cache of the NatsStreamingChannels, indexed
+	// by their cluster.
+	channels k8scache.Indexer
+
 	// opts is the set of options.
 	opts *Options
 
@@ -75,9 +117,16 @@ func NewController(opts *Options) *Controller {
 	if opts == nil {
 		opts = &Options{}
 	}
+	var hc HTTPClient = &http.Client{Timeout: monitoringTimeout}
+	if opts.HTTPClient != nil {
+		hc = opts.HTTPClient
+	}
 	return &Controller{
-		opts:     opts,
-		clusters: make(map[k8stypes.UID]*stanv1alpha1.NatsStreamingCluster),
+		opts:         opts,
+		hc:           hc,
+		metrics:      newMetrics(),
+		clusters:     make(map[k8stypes.UID]*stanv1alpha1.NatsStreamingCluster),
+		sharedStores: make(map[k8stypes.UID]string),
 	}
 }
 
@@ -100,9 +149,20 @@ func (c *Controller) SetupClients(cfg *k8srestapi.Config) error {
 		return err
 	}
 	c.ncr = ncr
+
+	broadcaster := k8srecord.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&k8stypedcorev1.EventSinkImpl{Interface: kc.CoreV1().Events("")})
+	c.recorder = broadcaster.NewRecorder(stanscheme.Scheme, k8scorev1.EventSource{Component: "nats-streaming-operator"})
 	return nil
 }
 
+// event records an event of the cluster, in addition to the logs.
+func (c *Controller) event(o *stanv1alpha1.NatsStreamingCluster, eventType, reason, format string, args ...interface{}) {
+	if c.recorder != nil {
+		c.recorder.Eventf(o, eventType, reason, format, args...)
+	}
+}
+
 // SetupSignalHandler enables handling process signals.
 func (c *Controller) SetupSignalHandler(ctx context.Context) {
 	sigCh := make(chan os.Signal, 1)
@@ -219,6 +279,68 @@ func (c *Controller) Run(ctx context.Context) error {
 		},
 	}, ResyncPeriod)
 
+	// Subscribe to changes on NatsStreamingBackup resources.
+	_, backupInformer := newResourceInformer(c, "natsstreamingbackups", &stanv1alpha1.NatsStreamingBackup{}, k8scache.ResourceEventHandlerFuncs{
+		AddFunc: func(o interface{}) {
+			err := c.processBackup(ctx, o)
+			if err != nil {
+				log.Errorf("Error on backup add: %v", err)
+			}
+		},
+		UpdateFunc: func(o interface{}, n interface{}) {
+			err := c.processBackup(ctx, n)
+			if err != nil {
+				log.Errorf("Error on backup update: %v", err)
+			}
+		},
+	}, k8scache.Indexers{}, ResyncPeriod)
+	go backupInformer.Run(ctx.Done())
+
+	// Subscribe to changes on NatsStreamingBackupSchedule resources,
+	// which are checked for due backups on every resync.
+	_, scheduleInformer := newResourceInformer(c, "natsstreamingbackupschedules", &stanv1alpha1.NatsStreamingBackupSchedule{}, k8scache.ResourceEventHandlerFuncs{
+		AddFunc: func(o interface{}) {
+			err := c.processBackupSchedule(ctx, o)
+			if err != nil {
+				log.Errorf("Error on backup schedule add: %v", err)
+			}
+		},
+		UpdateFunc: func(o interface{}, n interface{}) {
+			err := c.processBackupSchedule(ctx, n)
+			if err != nil {
+				log.Errorf("Error on backup schedule update: %v", err)
+			}
+		},
+		DeleteFunc: func(o interface{}) {
+			err := c.processBackupScheduleDelete(ctx, o)
+			if err != nil {
+				log.Errorf("Error on backup schedule delete: %v", err)
+			}
+		},
+	}, k8scache.Indexers{}, ResyncPeriod)
+	go scheduleInformer.Run(ctx.Done())
+
+	// Cache the NatsStreamingChannel resources, whose limits are
+	// applied on every reconciliation of their cluster.  They are
+	// only read once all of them are known, so that the limits of
+	// a cluster are not dropped while the cache is filled.
+	var channelInformer k8scache.Controller
+	c.channels, channelInformer = newResourceInformer(c, "natsstreamingchannels", &stanv1alpha1.NatsStreamingChannel{},
+		k8scache.ResourceEventHandlerFuncs{}, channelIndexers, ResyncPeriod)
+	go channelInformer.Run(ctx.Done())
+	if !k8scache.WaitForCacheSync(ctx.Done(), channelInformer.HasSynced) {
+		cancelFn()
+		return ctx.Err()
+	}
+
+	// Record the stats of the clusters from the monitoring
+	// endpoints of their nodes.
+	go c.runScraper(ctx, c.scrapeInterval())
+
+	if c.opts.MetricsAddress != "" {
+		go c.serveMetrics(ctx)
+	}
+
 	c.quit = func() {
 		// Signal cancellation of the main context.
 		cancelFn()
@@ -244,12 +366,13 @@ func (c *Controller) processAdd(ctx context.Context, v interface{}) error {
 
 	if o.DeletionTimestamp != nil {
 		// Throwaway cluster and let garbage collection remove
-		// the pods via ownership cascade delete.
+		// the pods via ownership cascade delete, once the
+		// finalizer has cleaned up the rest.
 		log.Debugf("Removing %v cluster", o.Name)
 		c.mu.Lock()
 		delete(c.clusters, o.UID)
 		c.mu.Unlock()
-		return nil
+		return c.finalize(o)
 	}
 
 	// Collect metadata from latest perceived version.
@@ -267,15 +390,14 @@ func (c *Controller) processUpdate(ctx context.Context, o interface{}, n interfa
 	log.Debugf("Syncing cluster '%s/%s' (uid=%s)", newc.Namespace, newc.Name, newc.UID)
 
 	if newc.DeletionTimestamp != nil {
-		_, ok := c.clusters[newc.UID]
-		if !ok {
-			return nil
-		}
 		c.mu.Lock()
+		_, ok := c.clusters[newc.UID]
 		delete(c.clusters, newc.UID)
 		c.mu.Unlock()
-		log.Debugf("Deleting '%s/%s' cluster (uid=%s)", newc.Namespace, newc.Name, newc.UID)
-		return nil
+		if ok {
+			log.Debugf("Deleting '%s/%s' cluster (uid=%s)", newc.Namespace, newc.Name, newc.UID)
+		}
+		return c.finalize(newc)
 	}
 
 	defer func() {
@@ -291,16 +413,100 @@ func (c *Controller) processDelete(ctx context.Context, v interface{}) error {
 	o := v.(*stanv1alpha1.NatsStreamingCluster)
 	log.Infof("Deleted '%s/%s' cluster (uid=%s)", o.Namespace, o.Name, o.UID)
 
+	// Not forgotten by the update of its deletion timestamp in case
+	// it was deleted without the finalizer.
+	c.mu.Lock()
+	delete(c.clusters, o.UID)
+	delete(c.sharedStores, o.UID)
+	c.mu.Unlock()
+
 	return nil
 }
 
 func (c *Controller) reconcile(o *stanv1alpha1.NatsStreamingCluster) error {
+	if isPaused(o) {
+		log.Debugf("Skipping reconciliation of paused '%s/%s' cluster", o.Namespace, o.Name)
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			setCondition(status, stanv1alpha1.ClusterPaused, k8scorev1.ConditionTrue, "Paused", "Reconciliation is paused, no changes are made to the cluster")
+		})
+	}
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterPaused); cond != nil && cond.Status == k8scorev1.ConditionTrue {
+		log.Infof("Resuming reconciliation of '%s/%s' cluster", o.Namespace, o.Name)
+		err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			setCondition(status, stanv1alpha1.ClusterPaused, k8scorev1.ConditionFalse, "Resumed", "")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := validateCluster(o); err != nil {
+		return fmt.Errorf("invalid spec for '%s/%s' cluster: %s", o.Namespace, o.Name, err)
+	}
+	if err := c.ensureFinalizer(o); err != nil {
+		return err
+	}
+	if err := c.adoptDataClaims(o); err != nil {
+		return err
+	}
+	if err := c.reconcileSharedStore(o); err != nil {
+		return err
+	}
+	switching, err := c.reconcileMode(o)
+	if err != nil {
+		return err
+	}
+	if switching {
+		// The nodes are kept stopped until the store has been
+		// moved to the layout of the new mode.
+		return nil
+	}
+	recovering, err := c.reconcileQuorumRecovery(o)
+	if err != nil {
+		return err
+	}
+	if recovering {
+		return nil
+	}
+	if err := c.reconcileEncryption(o); err != nil {
+		return err
+	}
+	if err := c.reconcileChannels(o); err != nil {
+		return err
+	}
+	if err := c.reconcileConfigMap(o); err != nil {
+		return err
+	}
+	if err := c.reconcilePartitions(o); err != nil {
+		return err
+	}
+	if err := c.reconcileServices(o); err != nil {
+		return err
+	}
+	if err := c.reconcileAutoscaling(o); err != nil {
+		return err
+	}
 	if err := c.reconcileSize(o); err != nil {
 		return err
 	}
+	if err := c.reconcileFaultTolerance(o); err != nil {
+		return err
+	}
+	if err := c.reconcileRaftHealth(o); err != nil {
+		return err
+	}
+	if err := c.reconcilePodDisruptionBudget(o); err != nil {
+		return err
+	}
 	return c.reconcilePodTemplate(o)
 }
 
+// isPaused returns whether the reconciliation of the cluster
+// has been paused, for example during incident response.
+func isPaused(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return o.Spec.Paused || o.Annotations[PausedAnnotation] == "true"
+}
+
 func (c *Controller) reconcileSize(o *stanv1alpha1.NatsStreamingCluster) error {
 	pods, err := c.findRunningPods(o.Name, o.Namespace)
 	if err != nil {
@@ -309,35 +515,55 @@ func (c *Controller) reconcileSize(o *stanv1alpha1.NatsStreamingCluster) error {
 	if o.Spec.StoreType == "SQL" || o.Spec.Size < 1 {
 		o.Spec.Size = 1
 	}
+	if hasExplicitPeers(o) {
+		if err := c.recordInitialPeers(o, pods); err != nil {
+			return err
+		}
+	}
+	if err := c.releaseBackupNodes(o); err != nil {
+		return err
+	}
+	if !isClustered(o) && !o.Status.Bootstrapped && len(pods) > 0 {
+		// Only the nodes created first restore the snapshot.
+		if err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Bootstrapped = true
+		}); err != nil {
+			return err
+		}
+		o.Status.Bootstrapped = true
+	}
 
-	n := len(pods) - int(o.Spec.Size)
+	// The nodes stopped by a backup are recreated once it is done.
+	n := len(pods) + stoppedBackupNodes(o, pods) - int(o.Spec.Size)
 	if n == 0 {
 		log.Debugf("Reconciled '%s/%s' cluster (size=%d/%d)", o.Namespace, o.Name, o.Spec.Size, o.Spec.Size)
 		return nil
 	} else if n > 0 {
 		log.Infof("Too many pods for '%s/%s' cluster (size=%d/%d), removing %d pods...", o.Namespace, o.Name, len(pods), o.Spec.Size, n)
+		// Remove the nodes with the highest ordinals, which are
+		// no longer part of the peers of the cluster.
+		sort.Slice(pods, func(i, j int) bool {
+			return podOrdinal(o, pods[i]) < podOrdinal(o, pods[j])
+		})
 		return c.shrinkCluster(pods, n)
 	} else if n < 0 {
 		log.Infof("Missing pods for '%s/%s' cluster (size=%d/%d), creating %d pods...", o.Namespace, o.Name, len(pods), o.Spec.Size, n*-1)
 
-		if o.Spec.StoreType == "SQL" || (o.Spec.Config != nil && o.Spec.Config.FTGroup != "") {
+		// With explicit peers all the nodes form the cluster together
+		// from the peers recorded beforehand, so none of them is special.
+		if !isClustered(o) || hasExplicitPeers(o) {
 			return c.createMissingPods(o, n*-1)
 		}
 
-		// If this is the first time we have perceived the pod,
-		// then try to create the first node to bootstrap the
-		// cluster.
-		c.mu.Lock()
-		if _, ok := c.clusters[o.UID]; !ok {
-			c.mu.Unlock()
-			return c.createBootstrapPod(o)
+		// Only bootstrap the Raft group once, based on the persisted
+		// state of the cluster rather than on what this operator
+		// has perceived since it started.
+		bootstrap, wait, err := c.shouldBootstrap(o, pods)
+		if err != nil || wait {
+			return err
 		}
-		c.mu.Unlock()
-
-		// If no other nodes are available, then create one with the bootstrap
-		// flag so that it can become the leader.
-		if n == 0 {
-			return c.createBootstrapPod(o)
+		if bootstrap {
+			return c.bootstrapCluster(o)
 		}
 		return c.createMissingPods(o, n*-1)
 	}
@@ -345,78 +571,58 @@ func (c *Controller) reconcileSize(o *stanv1alpha1.NatsStreamingCluster) error {
 	return nil
 }
 
-func (c *Controller) reconcilePodTemplate(o *stanv1alpha1.NatsStreamingCluster) error {
-	pods, err := c.findRunningPods(o.Name, o.Namespace)
-	if err != nil {
-		return err
-	}
+func (c *Controller) createBootstrapPod(o *stanv1alpha1.NatsStreamingCluster) (*k8scorev1.Pod, error) {
+	pod := newStanNodePod(o, fmt.Sprintf("%s-1", o.Name))
 
-	desiredImage := o.Spec.Image
-	if desiredImage == "" {
-		desiredImage = DefaultNATSStreamingImage
-	}
+	// The bootstrap flag is not part of the spec hash, since
+	// the pod is recreated without it.
+	pod.Spec.Containers[0].Command = stanContainerBootstrapCmd(o, pod)
 
-	var desiredAnnotations map[string]string
-	podTemplate := o.Spec.PodTemplate
-	if podTemplate != nil {
-		desiredAnnotations = podTemplate.GetObjectMeta().GetAnnotations()
+	log.Infof("Creating bootstrap pod '%s/%s'", o.Namespace, pod.Name)
+	_, err := c.kc.CoreV1().Pods(o.Namespace).Create(pod)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		log.Errorf("Failed to create bootstrap Pod: %v", err)
+		return nil, err
 	}
 
-	for _, pod := range pods {
-		currentImage := pod.Spec.Containers[0].Image
-		currentAnnotations := pod.GetObjectMeta().GetAnnotations()
-		delete(currentAnnotations, "kubernetes.io/psp") // Ignore k8s auto-applied annotations
-		for k, _ := range currentAnnotations {
-			if strings.HasPrefix(k, "cni.projectcalico.org/") {
-				delete(currentAnnotations, k)
-			}
-		}
-		if desiredImage != currentImage || (desiredAnnotations != nil && !reflect.DeepEqual(desiredAnnotations, currentAnnotations)) {
-			if desiredImage != currentImage {
-				log.Infof("Reconciling image '%s' in pod '%s/%s' with '%s'", currentImage, o.Namespace, pod.ObjectMeta.Name, desiredImage)
-			} else {
-				log.Infof("Reconciling annotations on pod '%s/%s'", o.Namespace, pod.ObjectMeta.Name)
-			}
-			c.kc.CoreV1().Pods(o.Namespace).Delete(pod.ObjectMeta.Name, k8sDeleteInBackground())
-			// Wait for the pod to delete
-			deletionWaitErr := k8sutilwait.PollImmediate(5*time.Second, 5*time.Minute, func() (bool, error) {
-				_, err := c.kc.CoreV1().Pods(o.Namespace).Get(pod.ObjectMeta.Name, k8smetav1.GetOptions{})
-				return err != nil, nil
-			})
-			if deletionWaitErr != nil {
-				log.Errorf("Problem waiting for deletion of pod '%s/%s': %s", o.Namespace, pod.ObjectMeta.Name, deletionWaitErr)
-			}
+	return pod, nil
+}
 
-			// Recreate the pod with the right image
-			if _, err := c.createPodFrom(o, pod); err != nil {
-				continue // Creation failed. Skip, and let size reconciliation fix later
-			}
+func (c *Controller) recreatePod(o *stanv1alpha1.NatsStreamingCluster, name string) (*k8scorev1.Pod, error) {
+	newPod := newStanNodePod(o, name)
 
-			// Wait for it to be ready before moving on
-			recreateWaitErr := k8sutilwait.PollImmediate(5*time.Second, 5*time.Minute, func() (bool, error) {
-				newPod, err := c.kc.CoreV1().Pods(o.Namespace).Get(pod.ObjectMeta.Name, k8smetav1.GetOptions{})
-				if err != nil {
-					log.Debugf("Pod '%s/%s' not up yet", o.Namespace, pod.ObjectMeta.Name)
-					return false, nil
-				}
-
-				return newPod.Status.Phase == k8scorev1.PodRunning && newPod.Status.ContainerStatuses[0].Ready, nil
-			})
-			if recreateWaitErr != nil {
-				log.Warnf("Problem waiting for pod '%s/%s' to come back: %s", o.Namespace, pod.ObjectMeta.Name, recreateWaitErr)
-			}
-		}
+	log.Infof("Recreating pod '%s/%s'", o.Namespace, newPod.Name)
+	_, err := c.kc.CoreV1().Pods(o.Namespace).Create(newPod)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		log.Errorf("Failed to create Pod: %v", err)
+		return nil, err
 	}
 
-	return nil
+	return newPod, nil
+}
+
+// adoptPod records the spec hash on a pod created before it was
+// tracked, without restarting it.
+func (c *Controller) adoptPod(pod *k8scorev1.Pod, hash string) error {
+	log.Infof("Recording spec hash of pod '%s/%s'", pod.Namespace, pod.Name)
+	updated := pod.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[PodSpecHashAnnotation] = hash
+	_, err := c.kc.CoreV1().Pods(pod.Namespace).Update(updated)
+	return err
 }
 
-func (c *Controller) createBootstrapPod(o *stanv1alpha1.NatsStreamingCluster) error {
+// newStanNodePod returns the desired pod for a node of the cluster,
+// annotated with the hash of its spec.
+func newStanNodePod(o *stanv1alpha1.NatsStreamingCluster, name string) *k8scorev1.Pod {
 	pod := newStanPod(o)
-	pod.Name = fmt.Sprintf("%s-1", o.Name)
+	pod.Name = name
+	pod.Spec.Hostname = name
 
 	container := stanContainer(o, pod)
-	container.Command = stanContainerBootstrapCmd(o, pod)
+	container.Command = stanContainerCmd(o, pod)
 
 	if len(pod.Spec.Containers) >= 1 {
 		pod.Spec.Containers[0] = container
@@ -424,36 +630,58 @@ func (c *Controller) createBootstrapPod(o *stanv1alpha1.NatsStreamingCluster) er
 		pod.Spec.Containers = []k8scorev1.Container{container}
 	}
 
-	log.Infof("Creating bootstrap pod '%s/%s'", o.Namespace, pod.Name)
-	_, err := c.kc.CoreV1().Pods(o.Namespace).Create(pod)
-	if err != nil && !k8serrors.IsAlreadyExists(err) {
-		log.Errorf("Failed to create bootstrap Pod: %v", err)
-		return err
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
 	}
+	pod.Annotations[PodSpecHashAnnotation] = podSpecHash(o, pod)
+
+	// Not part of the spec hash, since the store is only restored
+	// before the cluster is formed, and only wiped once when the
+	// pod is recreated.
+	applyRestore(o, pod)
+	applyRejoin(o, pod)
+	return pod
+}
 
-	return nil
+// podSpecHash is the hash of everything that defines a pod, including
+// the generated configuration file that is only read on startup.
+func podSpecHash(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) string {
+	annotations := make(map[string]string)
+	for k, v := range pod.Annotations {
+		if k != PodSpecHashAnnotation {
+			annotations[k] = v
+		}
+	}
+	data, err := json.Marshal(struct {
+		Labels      map[string]string
+		Annotations map[string]string
+		Spec        k8scorev1.PodSpec
+		ConfigFile  string
+	}{pod.Labels, annotations, pod.Spec, stanConfigFile(o)})
+	if err != nil {
+		// Should not happen with a valid pod spec.
+		log.Errorf("Failed to hash spec of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
 }
 
-func (c *Controller) createPodFrom(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) (*k8scorev1.Pod, error) {
-	newPod := newStanPod(o)
-	newPod.Name = pod.Name
-	container := stanContainer(o, newPod)
-	container.Command = stanContainerCmd(o, pod)
+// podOrdinal returns the ordinal from the name of a pod,
+// or zero in case the name does not have one.
+func podOrdinal(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) int {
+	return nodeOrdinal(o, pod.Name)
+}
 
-	if len(newPod.Spec.Containers) >= 1 {
-		newPod.Spec.Containers[0] = container
-	} else {
-		newPod.Spec.Containers = []k8scorev1.Container{container}
+func nodeOrdinal(o *stanv1alpha1.NatsStreamingCluster, name string) int {
+	prefix := o.Name + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return 0
 	}
-
-	log.Infof("Recreating pod '%s/%s'", o.Namespace, newPod.Name)
-	_, err := c.kc.CoreV1().Pods(o.Namespace).Create(newPod)
-	if err != nil && !k8serrors.IsAlreadyExists(err) {
-		log.Errorf("Failed to create Pod: %v", err)
-		return nil, err
+	n, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+	if err != nil {
+		return 0
 	}
-
-	return newPod, nil
+	return n
 }
 
 func stanContainer(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) k8scorev1.Container {
@@ -473,13 +701,55 @@ func stanContainer(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) k8s
 	}
 	container.Name = "stan"
 
+	if !hasContainerPort(container, MonitoringPort) {
+		container.Ports = append(container.Ports, k8scorev1.ContainerPort{
+			Name:          "monitoring",
+			ContainerPort: MonitoringPort,
+			Protocol:      k8scorev1.ProtocolTCP,
+		})
+	}
+
+	if o.Spec.Resources != nil {
+		container.Resources = *o.Spec.Resources.DeepCopy()
+	}
+
+	if isEncrypted(o) {
+		container.Env = append(container.Env, encryptionKeyEnvVar(o.Spec.Config.Encryption))
+	}
+
+	if stanConfigFile(o) != "" && !hasVolumeMount(container, configVolumeName) {
+		container.VolumeMounts = append(container.VolumeMounts, k8scorev1.VolumeMount{
+			Name:      configVolumeName,
+			MountPath: configMountPath,
+			ReadOnly:  true,
+		})
+	}
+
 	return container
 }
 
+func hasContainerPort(container k8scorev1.Container, port int32) bool {
+	for _, p := range container.Ports {
+		if p.ContainerPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolumeMount(container k8scorev1.Container, name string) bool {
+	for _, vm := range container.VolumeMounts {
+		if vm.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func stanContainerCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) []string {
 	args := []string{
 		"/nats-streaming-server",
-		"-cluster_id", o.Name,
+		"-cluster_id", stanClusterID(o),
 		"-nats_server", fmt.Sprintf("nats://%s:4222", o.Spec.NatsService),
 		"-m", fmt.Sprintf("%d", MonitoringPort),
 	}
@@ -498,13 +768,15 @@ func stanContainerCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod)
 			"-store", "file",
 		}
 
-		ftModeEnabled := o.Spec.Config != nil && o.Spec.Config.FTGroup != ""
-		isClustered := o.Spec.Config != nil && (o.Spec.Size > 1 || o.Spec.Config.Clustered)
+		ftModeEnabled := isFTMode(o)
 
 		// Disable clustering if using single instance or FT mode.
-		if isClustered && !ftModeEnabled {
+		if isClustered(o) {
 			storeArgs = append(storeArgs, "-clustered")
-			storeArgs = append(storeArgs, fmt.Sprintf("--cluster_node_id=%q", pod.Name))
+			storeArgs = append(storeArgs, fmt.Sprintf("--cluster_node_id=%s", clusterNodeID(pod.Name)))
+			if o.Spec.Config.Cluster != nil {
+				storeArgs = append(storeArgs, clusterArgs(o, pod, o.Spec.Config.Cluster)...)
+			}
 		}
 
 		// Allow using a custom mount path which could be a persistent volume.
@@ -512,10 +784,11 @@ func stanContainerCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod)
 			if ftModeEnabled {
 				// In case of FT mode then use the name of the first pod
 				// as the storage directory in order to make it possible
-				// to switch from clustered mode to fault tolerance mode.
+				// to switch from clustered mode to fault tolerance mode,
+				// see reconcileMode.
 				name := fmt.Sprintf("%s-1", o.Name)
 				storeArgs = append(storeArgs, "-dir", o.Spec.Config.StoreDir+"/"+name)
-				storeArgs = append(storeArgs, fmt.Sprintf("--ft_group=%s", o.Spec.Config.FTGroup))
+				storeArgs = append(storeArgs, fmt.Sprintf("--ft_group=%s", ftGroup(o)))
 			} else {
 				// Using clustering.
 				storeArgs = append(storeArgs, "-dir", o.Spec.Config.StoreDir+"/"+pod.Name)
@@ -525,9 +798,17 @@ func stanContainerCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod)
 			// Use local filesystem if no explicit directory was set.
 			storeArgs = append(storeArgs, "-dir", "store")
 		}
+
+		if o.Spec.Config != nil && o.Spec.Config.FileStore != nil {
+			storeArgs = append(storeArgs, fileStoreArgs(o.Spec.Config.FileStore)...)
+		}
 	}
 	args = append(args, storeArgs...)
 
+	if isEncrypted(o) {
+		args = append(args, encryptionArgs(o.Spec.Config.Encryption)...)
+	}
+
 	// Debugging params
 	if o.Spec.Config != nil {
 		if o.Spec.Config.Debug {
@@ -543,11 +824,134 @@ func stanContainerCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod)
 
 	if o.Spec.ConfigFile != "" {
 		args = append(args, "-sc", o.Spec.ConfigFile)
+	} else if stanConfigFile(o) != "" {
+		args = append(args, "-sc", configMountPath+"/"+configFileName)
 	}
 
 	return args
 }
 
+// isFTMode returns whether the nodes run in fault tolerance mode.
+func isFTMode(o *stanv1alpha1.NatsStreamingCluster) bool {
+	if o.Spec.Mode != "" {
+		return o.Spec.Mode == stanv1alpha1.ModeFaultTolerance
+	}
+	return o.Spec.Config != nil && o.Spec.Config.FTGroup != ""
+}
+
+// isClustered returns whether the nodes form a Raft cluster.
+func isClustered(o *stanv1alpha1.NatsStreamingCluster) bool {
+	if o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" || isFTMode(o) {
+		return false
+	}
+	if o.Spec.Mode != "" {
+		return o.Spec.Mode == stanv1alpha1.ModeClustered && o.Spec.Config != nil
+	}
+	return o.Spec.Config != nil && (o.Spec.Size > 1 || o.Spec.Config.Clustered)
+}
+
+// ftGroup is the name of the fault tolerance group of the nodes,
+// by default the name of the cluster.
+func ftGroup(o *stanv1alpha1.NatsStreamingCluster) string {
+	if o.Spec.Config != nil && o.Spec.Config.FTGroup != "" {
+		return o.Spec.Config.FTGroup
+	}
+	return o.Name
+}
+
+// clusterNodeID is the Raft node ID of a pod.  The name is quoted
+// as it has always been passed that way to the server, so that peer
+// lists match the IDs of the nodes with existing state.
+func clusterNodeID(name string) string {
+	return fmt.Sprintf("%q", name)
+}
+
+// initialPeers returns the node IDs of the nodes that formed the
+// cluster with explicit peers, and whether a pod is one of them.
+func initialPeers(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) ([]string, bool) {
+	peers := make([]string, 0, len(o.Status.InitialPeers))
+	member := false
+	for _, name := range o.Status.InitialPeers {
+		peers = append(peers, clusterNodeID(name))
+		member = member || name == pod.Name
+	}
+	return peers, member
+}
+
+func hasExplicitPeers(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return isClustered(o) && o.Spec.Config.Cluster != nil && o.Spec.Config.Cluster.ExplicitPeers
+}
+
+func clusterArgs(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod, cc *stanv1alpha1.ClusterConfig) []string {
+	var args []string
+	if cc.LogCacheSize > 0 {
+		args = append(args, fmt.Sprintf("--cluster_log_cache_size=%d", cc.LogCacheSize))
+	}
+	if cc.LogSnapshots > 0 {
+		args = append(args, fmt.Sprintf("--cluster_log_snapshots=%d", cc.LogSnapshots))
+	}
+	if cc.TrailingLogs > 0 {
+		args = append(args, fmt.Sprintf("--cluster_trailing_logs=%d", cc.TrailingLogs))
+	}
+	if cc.Sync {
+		args = append(args, "--cluster_sync")
+	}
+	if cc.AllowAddRemoveNode {
+		args = append(args, "--cluster_allow_add_remove_node")
+	}
+	// Only the nodes that formed the cluster have the peers, the
+	// ones added later have no Raft state and join it through the
+	// leader instead of forming a group of their own.
+	if peers, member := initialPeers(o, pod); cc.ExplicitPeers && member {
+		args = append(args, fmt.Sprintf("--cluster_peers=%s", strings.Join(peers, ",")))
+	}
+	return args
+}
+
+func fileStoreArgs(fs *stanv1alpha1.FileStoreConfig) []string {
+	var args []string
+	if fs.CompactEnabled != nil {
+		args = append(args, fmt.Sprintf("--file_compact_enabled=%t", *fs.CompactEnabled))
+	}
+	if fs.CompactFragmentation > 0 {
+		args = append(args, fmt.Sprintf("--file_compact_frag=%d", fs.CompactFragmentation))
+	}
+	if fs.CompactInterval > 0 {
+		args = append(args, fmt.Sprintf("--file_compact_interval=%d", fs.CompactInterval))
+	}
+	if fs.CompactMinSize != "" {
+		args = append(args, fmt.Sprintf("--file_compact_min_size=%s", fs.CompactMinSize))
+	}
+	if fs.BufferSize != "" {
+		args = append(args, fmt.Sprintf("--file_buffer_size=%s", fs.BufferSize))
+	}
+	if fs.CRC != nil {
+		args = append(args, fmt.Sprintf("--file_crc=%t", *fs.CRC))
+	}
+	if fs.CRCPolynomial > 0 {
+		args = append(args, fmt.Sprintf("--file_crc_poly=%d", fs.CRCPolynomial))
+	}
+	if fs.SyncOnFlush != nil {
+		args = append(args, fmt.Sprintf("--file_sync=%t", *fs.SyncOnFlush))
+	}
+	if fs.SliceMaxMsgs > 0 {
+		args = append(args, fmt.Sprintf("--file_slice_max_msgs=%d", fs.SliceMaxMsgs))
+	}
+	if fs.SliceMaxBytes != "" {
+		args = append(args, fmt.Sprintf("--file_slice_max_bytes=%s", fs.SliceMaxBytes))
+	}
+	if fs.SliceMaxAge != "" {
+		args = append(args, fmt.Sprintf("--file_slice_max_age=%s", fs.SliceMaxAge))
+	}
+	if fs.FileDescriptorsLimit > 0 {
+		args = append(args, fmt.Sprintf("--file_fds_limit=%d", fs.FileDescriptorsLimit))
+	}
+	if fs.ParallelRecovery > 0 {
+		args = append(args, fmt.Sprintf("--file_parallel_recovery=%d", fs.ParallelRecovery))
+	}
+	return args
+}
+
 func stanContainerBootstrapCmd(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) []string {
 	cmd := stanContainerCmd(o, pod)
 
@@ -566,21 +970,10 @@ func (c *Controller) createMissingPods(o *stanv1alpha1.NatsStreamingCluster, n i
 		// otherwise skip it.
 		name := fmt.Sprintf("%s-%d", o.Name, i)
 		_, err := c.kc.CoreV1().Pods(o.Namespace).Get(name, k8smetav1.GetOptions{})
-		if err == nil {
+		if err == nil || isBackupNode(o, name) {
 			continue
 		}
-		pod := newStanPod(o)
-		pod.Name = name
-
-		container := stanContainer(o, pod)
-		container.Command = stanContainerCmd(o, pod)
-
-		if len(pod.Spec.Containers) >= 1 {
-			pod.Spec.Containers[0] = container
-		} else {
-			pod.Spec.Containers = []k8scorev1.Container{container}
-		}
-		pods = append(pods, pod)
+		pods = append(pods, newStanNodePod(o, name))
 	}
 
 	for _, pod := range pods {
@@ -622,39 +1015,100 @@ func newStanPod(o *stanv1alpha1.NatsStreamingCluster) *k8scorev1.Pod {
 	}
 
 	// Base from Pod Spec from template if present.
+	// Copy it so that the template in the cluster is not modified.
 	template := o.Spec.PodTemplate
 	if template != nil {
+		template = template.DeepCopy()
 		pod.ObjectMeta = template.ObjectMeta
 		pod.Spec = template.Spec
 	}
 
 	pod.Namespace = o.Namespace
-	pod.OwnerReferences = []k8smetav1.OwnerReference{
-		*k8smetav1.NewControllerRef(o, k8sschema.GroupVersionKind{
-			Group:   stanv1alpha1.SchemeGroupVersion.Group,
-			Version: stanv1alpha1.SchemeGroupVersion.Version,
-			Kind:    "NatsStreamingCluster",
-		}),
-	}
+	pod.OwnerReferences = []k8smetav1.OwnerReference{clusterOwnerRef(o)}
 
 	if pod.Labels == nil {
 		pod.Labels = map[string]string{}
 	}
-	pod.Labels["app"] = "nats-streaming"
-	pod.Labels["stan_cluster"] = o.Name
+	for k, v := range clusterLabels(o.Name) {
+		pod.Labels[k] = v
+	}
+
+	// Nodes have a DNS record under the headless service.
+	pod.Spec.Subdomain = headlessServiceName(o)
+
+	applyPodSettings(o, pod)
+	applyPlacement(o, pod)
 
 	if pod.Spec.RestartPolicy == "" {
 		pod.Spec.RestartPolicy = k8scorev1.RestartPolicyOnFailure
 	}
+
+	if stanConfigFile(o) != "" {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, k8scorev1.Volume{
+			Name: configVolumeName,
+			VolumeSource: k8scorev1.VolumeSource{
+				ConfigMap: &k8scorev1.ConfigMapVolumeSource{
+					LocalObjectReference: k8scorev1.LocalObjectReference{
+						Name: configMapName(o),
+					},
+				},
+			},
+		})
+	}
 	return pod.DeepCopy()
 }
 
+// applyPodSettings sets the typed pod settings of the spec,
+// which take precedence over the ones from the template.
+func applyPodSettings(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) {
+	if o.Spec.NodeSelector != nil {
+		pod.Spec.NodeSelector = make(map[string]string)
+		for k, v := range o.Spec.NodeSelector {
+			pod.Spec.NodeSelector[k] = v
+		}
+	}
+	if o.Spec.Tolerations != nil {
+		pod.Spec.Tolerations = make([]k8scorev1.Toleration, len(o.Spec.Tolerations))
+		for i := range o.Spec.Tolerations {
+			o.Spec.Tolerations[i].DeepCopyInto(&pod.Spec.Tolerations[i])
+		}
+	}
+	if o.Spec.PriorityClassName != "" {
+		pod.Spec.PriorityClassName = o.Spec.PriorityClassName
+	}
+	if o.Spec.ServiceAccountName != "" {
+		pod.Spec.ServiceAccountName = o.Spec.ServiceAccountName
+	}
+	if o.Spec.SecurityContext != nil {
+		pod.Spec.SecurityContext = o.Spec.SecurityContext.DeepCopy()
+	}
+	if o.Spec.ImagePullSecrets != nil {
+		pod.Spec.ImagePullSecrets = make([]k8scorev1.LocalObjectReference, len(o.Spec.ImagePullSecrets))
+		copy(pod.Spec.ImagePullSecrets, o.Spec.ImagePullSecrets)
+	}
+}
+
+// clusterLabels are the labels of the objects that belong to a cluster.
+func clusterLabels(name string) map[string]string {
+	return map[string]string{
+		"app":          "nats-streaming",
+		"stan_cluster": name,
+	}
+}
+
+// clusterOwnerRef makes the cluster the controller of an object,
+// so that it is garbage collected along with the cluster.
+func clusterOwnerRef(o *stanv1alpha1.NatsStreamingCluster) k8smetav1.OwnerReference {
+	return *k8smetav1.NewControllerRef(o, k8sschema.GroupVersionKind{
+		Group:   stanv1alpha1.SchemeGroupVersion.Group,
+		Version: stanv1alpha1.SchemeGroupVersion.Version,
+		Kind:    "NatsStreamingCluster",
+	})
+}
+
 func (c *Controller) findPods(name string, namespace string) (*k8scorev1.PodList, error) {
 	opts := k8smetav1.ListOptions{
-		LabelSelector: k8slabels.SelectorFromSet(map[string]string{
-			"app":          "nats-streaming",
-			"stan_cluster": name,
-		}).String(),
+		LabelSelector: k8slabels.SelectorFromSet(clusterLabels(name)).String(),
 	}
 
 	return c.kc.CoreV1().Pods(namespace).List(opts)
@@ -0,0 +1,333 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	stanfake "github.com/nats-io/nats-streaming-operator/pkg/client/v1alpha1/fake"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8scache "k8s.io/client-go/tools/cache"
+)
+
+func newTestController(clusters []k8sruntime.Object, objects ...k8sruntime.Object) *Controller {
+	c := NewController(nil)
+	c.kc = k8sfake.NewSimpleClientset(objects...)
+	c.ncr = stanfake.NewSimpleClientset(clusters...)
+	c.channels = k8scache.NewIndexer(k8scache.MetaNamespaceKeyFunc, channelIndexers)
+	for _, obj := range clusters {
+		if channel, ok := obj.(*stanv1alpha1.NatsStreamingChannel); ok {
+			c.channels.Add(channel)
+		}
+	}
+	return c
+}
+
+func newTestCluster(name string, size int32, config *stanv1alpha1.ServerConfig) *stanv1alpha1.NatsStreamingCluster {
+	return &stanv1alpha1.NatsStreamingCluster{
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: stanv1alpha1.NatsStreamingClusterSpec{
+			Size:        size,
+			NatsService: "example-nats",
+			Config:      config,
+		},
+	}
+}
+
+func newTestPod(name string) *k8scorev1.Pod {
+	return &k8scorev1.Pod{
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+	}
+}
+
+func TestStanContainerCmdFileStore(t *testing.T) {
+	enabled := false
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{
+		StoreDir: "/pv/stan",
+		FileStore: &stanv1alpha1.FileStoreConfig{
+			CompactEnabled:       &enabled,
+			BufferSize:           "2MB",
+			SliceMaxAge:          "24h",
+			FileDescriptorsLimit: 100,
+			ParallelRecovery:     4,
+		},
+	})
+	cmd := strings.Join(stanContainerCmd(o, newTestPod("stan-1")), " ")
+
+	for _, expected := range []string{
+		"-store file",
+		"-dir /pv/stan/stan-1",
+		"--file_compact_enabled=false",
+		"--file_buffer_size=2MB",
+		"--file_slice_max_age=24h",
+		"--file_fds_limit=100",
+		"--file_parallel_recovery=4",
+	} {
+		if !strings.Contains(cmd, expected) {
+			t.Errorf("Expected %q in command, got: %s", expected, cmd)
+		}
+	}
+	if strings.Contains(cmd, "--file_crc") {
+		t.Errorf("Expected unset options to be omitted, got: %s", cmd)
+	}
+}
+
+func TestStanContainerCmdClusterConfig(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{
+		StoreDir: "/pv/stan",
+		Cluster: &stanv1alpha1.ClusterConfig{
+			HeartbeatTimeout:   "5s",
+			ElectionTimeout:    "5s",
+			LogCacheSize:       1024,
+			LogSnapshots:       4,
+			AllowAddRemoveNode: true,
+			ExplicitPeers:      true,
+		},
+	})
+	o.Status.InitialPeers = []string{"stan-1", "stan-2", "stan-3"}
+	cmd := strings.Join(stanContainerCmd(o, newTestPod("stan-2")), " ")
+
+	for _, expected := range []string{
+		"-clustered",
+		`--cluster_node_id="stan-2"`,
+		"--cluster_log_cache_size=1024",
+		"--cluster_log_snapshots=4",
+		"--cluster_allow_add_remove_node",
+		`--cluster_peers="stan-1","stan-2","stan-3"`,
+		"-sc /etc/stan-operator/stan.conf",
+	} {
+		if !strings.Contains(cmd, expected) {
+			t.Errorf("Expected %q in command, got: %s", expected, cmd)
+		}
+	}
+
+	conf := stanConfigFile(o)
+	for _, expected := range []string{
+		`raft_heartbeat_timeout: "5s"`,
+		`raft_election_timeout: "5s"`,
+	} {
+		if !strings.Contains(conf, expected) {
+			t.Errorf("Expected %q in configuration file, got: %s", expected, conf)
+		}
+	}
+
+	pod := newStanPod(o)
+	container := stanContainer(o, pod)
+	if !hasVolumeMount(container, configVolumeName) {
+		t.Errorf("Expected configuration file to be mounted in the container")
+	}
+}
+
+func TestTypedPodSettings(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	o.Spec.Resources = &k8scorev1.ResourceRequirements{
+		Limits: k8scorev1.ResourceList{
+			k8scorev1.ResourceMemory: k8sresource.MustParse("512Mi"),
+		},
+	}
+	o.Spec.NodeSelector = map[string]string{"disktype": "ssd"}
+	o.Spec.Tolerations = []k8scorev1.Toleration{
+		{Key: "dedicated", Operator: k8scorev1.TolerationOpEqual, Value: "stan", Effect: k8scorev1.TaintEffectNoSchedule},
+	}
+	o.Spec.PriorityClassName = "high-priority"
+	o.Spec.ServiceAccountName = "stan"
+	o.Spec.ImagePullSecrets = []k8scorev1.LocalObjectReference{{Name: "registry"}}
+	o.Spec.PodTemplate = &k8scorev1.PodTemplateSpec{
+		Spec: k8scorev1.PodSpec{
+			NodeSelector: map[string]string{"disktype": "hdd"},
+			Containers: []k8scorev1.Container{
+				{Name: "stan"},
+				{Name: "metrics"},
+			},
+		},
+	}
+
+	pod := newStanNodePod(o, "stan-1")
+	if pod.Spec.NodeSelector["disktype"] != "ssd" {
+		t.Errorf("Expected typed node selector to take precedence, got: %v", pod.Spec.NodeSelector)
+	}
+	if pod.Spec.PriorityClassName != "high-priority" || pod.Spec.ServiceAccountName != "stan" {
+		t.Errorf("Unexpected pod settings: %+v", pod.Spec)
+	}
+	if q := pod.Spec.Containers[0].Resources.Limits[k8scorev1.ResourceMemory]; q.String() != "512Mi" {
+		t.Errorf("Expected resources on the stan container, got: %v", pod.Spec.Containers[0].Resources)
+	}
+	if len(pod.Spec.Containers[1].Resources.Limits) != 0 {
+		t.Errorf("Expected resources not to be set on sidecars")
+	}
+	hash := pod.Annotations[PodSpecHashAnnotation]
+	if hash == "" {
+		t.Fatalf("Expected spec hash annotation on the pod")
+	}
+
+	// Drift in any of the typed settings is detected by the spec
+	// hash, the same as drift in the template.
+	for _, tt := range []struct {
+		setting string
+		change  func()
+	}{
+		{"resources", func() { o.Spec.Resources.Limits[k8scorev1.ResourceMemory] = k8sresource.MustParse("1Gi") }},
+		{"node selector", func() { o.Spec.NodeSelector["disktype"] = "nvme" }},
+		{"tolerations", func() { o.Spec.Tolerations[0].Value = "other" }},
+		{"priority class", func() { o.Spec.PriorityClassName = "low-priority" }},
+		{"service account", func() { o.Spec.ServiceAccountName = "other" }},
+		{"security context", func() { o.Spec.SecurityContext = &k8scorev1.PodSecurityContext{FSGroup: new(int64)} }},
+		{"image pull secrets", func() {
+			o.Spec.ImagePullSecrets = append(o.Spec.ImagePullSecrets, k8scorev1.LocalObjectReference{Name: "mirror"})
+		}},
+	} {
+		tt.change()
+		changed := newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation]
+		if changed == hash {
+			t.Errorf("Expected change in %s to change the spec hash", tt.setting)
+		}
+		hash = changed
+	}
+}
+
+func TestPodSpecHash(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	hash := newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation]
+	if hash != newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation] {
+		t.Fatalf("Expected spec hash to be stable")
+	}
+
+	// Changes in the generated command or configuration file
+	// change the hash, same as changes in the template.
+	o.Spec.Config.Debug = true
+	debugHash := newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation]
+	if debugHash == hash {
+		t.Errorf("Expected change in the command to change the spec hash")
+	}
+	o.Spec.Config.Cluster = &stanv1alpha1.ClusterConfig{HeartbeatTimeout: "5s", ElectionTimeout: "5s"}
+	clusterHash := newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation]
+	if clusterHash == debugHash {
+		t.Errorf("Expected change in the configuration file to change the spec hash")
+	}
+	o.Spec.PodTemplate = &k8scorev1.PodTemplateSpec{
+		Spec: k8scorev1.PodSpec{
+			Containers: []k8scorev1.Container{
+				{Name: "stan", Env: []k8scorev1.EnvVar{{Name: "FOO", Value: "bar"}}},
+			},
+		},
+	}
+	if newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation] == clusterHash {
+		t.Errorf("Expected change in the template to change the spec hash")
+	}
+}
+
+func TestReconcilePaused(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	o.Annotations = map[string]string{PausedAnnotation: "true"}
+	c := newTestController([]k8sruntime.Object{o})
+
+	if err := c.reconcile(o); err != nil {
+		t.Fatal(err)
+	}
+	pods, err := c.kc.CoreV1().Pods("default").List(k8smetav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected no pods to be created while paused, got %d", len(pods.Items))
+	}
+	o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterPaused); cond == nil || cond.Status != k8scorev1.ConditionTrue {
+		t.Fatalf("Expected paused condition, got: %+v", o.Status.Conditions)
+	}
+
+	o.Annotations = nil
+	if err := c.reconcile(o); err != nil {
+		t.Fatal(err)
+	}
+	o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterPaused); cond == nil || cond.Status != k8scorev1.ConditionFalse {
+		t.Errorf("Expected paused condition to be cleared, got: %+v", o.Status.Conditions)
+	}
+	pods, err = c.kc.CoreV1().Pods("default").List(k8smetav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) == 0 {
+		t.Errorf("Expected pods to be created once resumed")
+	}
+}
+
+// fakeHTTPClient replies to the monitoring requests of the
+// operator with the responses set by pod IP and path.
+type fakeHTTPClient map[string]string
+
+func (f fakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	body, ok := f[req.URL.Host+req.URL.Path]
+	if !ok {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func newTestStorePods(o *stanv1alpha1.NatsStreamingCluster) []k8sruntime.Object {
+	var pods []k8sruntime.Object
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		pod := newStanNodePod(o, fmt.Sprintf("%s-%d", o.Name, i))
+		pod.Spec.NodeName = fmt.Sprintf("node-%d", i)
+		pod.Status.PodIP = fmt.Sprintf("10.0.0.%d", i)
+		pod.Status.Phase = k8scorev1.PodRunning
+		pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{Name: "stan", Ready: true}}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+func newTestStoreCluster(name string, size int32) *stanv1alpha1.NatsStreamingCluster {
+	o := newTestCluster(name, size, &stanv1alpha1.ServerConfig{StoreDir: "/pv/stan"})
+	o.Spec.PodTemplate = &k8scorev1.PodTemplateSpec{
+		Spec: k8scorev1.PodSpec{
+			Volumes: []k8scorev1.Volume{{
+				Name: "store",
+				VolumeSource: k8scorev1.VolumeSource{
+					PersistentVolumeClaim: &k8scorev1.PersistentVolumeClaimVolumeSource{ClaimName: "stan-pvc"},
+				},
+			}},
+			Containers: []k8scorev1.Container{{
+				VolumeMounts: []k8scorev1.VolumeMount{{Name: "store", MountPath: "/pv"}},
+			}},
+		},
+	}
+	return o
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	from := time.Date(2020, 1, 31, 10, 30, 15, 0, time.UTC)
+	for _, tt := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2020, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2020, 2, 1, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Sunday as 7, the first one after the 31st is Feb 2nd.
+		{"30 2 * * 7", time.Date(2020, 2, 2, 2, 30, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted.
+		{"0 0 15 * 1-5", time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		s, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %s", tt.spec, err)
+		}
+		if got := s.next(from); !got.Equal(tt.expected) {
+			t.Errorf("Expected next run of %q to be %v, got: %v", tt.spec, tt.expected, got)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@often"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("Expected error parsing %q", spec)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func isEncrypted(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return o.Spec.Config != nil && o.Spec.Config.Encryption != nil
+}
+
+func encryptionArgs(ec *stanv1alpha1.EncryptionConfig) []string {
+	// The key is never passed as an argument, the server
+	// reads it from the environment instead.
+	args := []string{"--encrypt=true"}
+	if ec.Cipher != "" {
+		args = append(args, fmt.Sprintf("--encryption_cipher=%s", ec.Cipher))
+	}
+	return args
+}
+
+func encryptionKeyEnvVar(ec *stanv1alpha1.EncryptionConfig) k8scorev1.EnvVar {
+	return k8scorev1.EnvVar{
+		Name: EncryptionKeyEnvVar,
+		ValueFrom: &k8scorev1.EnvVarSource{
+			SecretKeyRef: ec.KeySecret.DeepCopy(),
+		},
+	}
+}
+
+// podIsEncrypted returns whether a pod was started with encryption.
+func podIsEncrypted(pod *k8scorev1.Pod) bool {
+	if len(pod.Spec.Containers) < 1 {
+		return false
+	}
+	for _, arg := range pod.Spec.Containers[0].Command {
+		if strings.HasPrefix(arg, "--encrypt=") {
+			return arg == "--encrypt=true"
+		}
+	}
+	return false
+}
+
+// reconcileEncryption records whether the store is encrypted, and
+// refuses to turn the encryption on or off for an existing store
+// unless the migration annotation has been set on the cluster.
+func (c *Controller) reconcileEncryption(o *stanv1alpha1.NatsStreamingCluster) error {
+	// There is no existing data to protect with a memory store.
+	if o.Spec.StoreType == "MEMORY" {
+		return nil
+	}
+
+	desired := isEncrypted(o)
+	current := o.Status.StoreEncrypted
+	if current == nil {
+		// Pick up the state of clusters created before it was
+		// recorded from the pods that are already running.
+		pods, err := c.findRunningPods(o.Name, o.Namespace)
+		if err != nil {
+			return err
+		}
+		recorded := desired
+		if len(pods) > 0 {
+			recorded = podIsEncrypted(pods[0])
+		}
+		current = &recorded
+	}
+
+	migrate := o.Annotations[EncryptionMigrationAnnotation] == "true"
+	if *current != desired && !migrate {
+		return fmt.Errorf("refusing to change encryption of the store of '%s/%s' cluster (encrypted=%v), set the %q annotation to migrate it",
+			o.Namespace, o.Name, *current, EncryptionMigrationAnnotation)
+	}
+	if o.Status.StoreEncrypted != nil && *o.Status.StoreEncrypted == desired && !migrate {
+		return nil
+	}
+
+	if *current != desired {
+		log.Infof("Migrating store of '%s/%s' cluster (encrypted=%v)", o.Namespace, o.Name, desired)
+	}
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		cluster.Status.StoreEncrypted = &desired
+		delete(cluster.Annotations, EncryptionMigrationAnnotation)
+	})
+}
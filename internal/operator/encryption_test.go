@@ -0,0 +1,68 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileEncryptionMigration(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{
+		StoreDir: "/pv/stan",
+		Encryption: &stanv1alpha1.EncryptionConfig{
+			Cipher: "AES",
+			KeySecret: &k8scorev1.SecretKeySelector{
+				LocalObjectReference: k8scorev1.LocalObjectReference{Name: "stan-key"},
+				Key:                  "key",
+			},
+		},
+	})
+	encrypted := false
+	o.Status.StoreEncrypted = &encrypted
+	c := newTestController([]k8sruntime.Object{o})
+
+	if err := c.reconcileEncryption(o); err == nil {
+		t.Fatal("Expected encryption of an existing store to be refused")
+	}
+
+	o.Annotations = map[string]string{EncryptionMigrationAnnotation: "true"}
+	if err := c.reconcileEncryption(o); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status.StoreEncrypted == nil || !*result.Status.StoreEncrypted {
+		t.Errorf("Expected store to be recorded as encrypted")
+	}
+	if _, ok := result.Annotations[EncryptionMigrationAnnotation]; ok {
+		t.Errorf("Expected migration annotation to be removed")
+	}
+
+	cmd := strings.Join(stanContainerCmd(o, newTestPod("stan-1")), " ")
+	if !strings.Contains(cmd, "--encrypt=true --encryption_cipher=AES") {
+		t.Errorf("Expected encryption flags in command, got: %s", cmd)
+	}
+	container := stanContainer(o, newStanPod(o))
+	if len(container.Env) != 1 || container.Env[0].Name != EncryptionKeyEnvVar || container.Env[0].ValueFrom.SecretKeyRef.Name != "stan-key" {
+		t.Errorf("Expected encryption key from Secret in the environment, got: %+v", container.Env)
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+)
+
+func reclaimPolicy(o *stanv1alpha1.NatsStreamingCluster) stanv1alpha1.ReclaimPolicy {
+	if o.Spec.ReclaimPolicy == "" {
+		return stanv1alpha1.ReclaimRetain
+	}
+	return o.Spec.ReclaimPolicy
+}
+
+func hasFinalizer(o *stanv1alpha1.NatsStreamingCluster) bool {
+	for _, f := range o.Finalizers {
+		if f == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureFinalizer adds the finalizer to the cluster so that
+// its resources are cleaned up before it is deleted.
+func (c *Controller) ensureFinalizer(o *stanv1alpha1.NatsStreamingCluster) error {
+	if hasFinalizer(o) {
+		return nil
+	}
+	log.Debugf("Adding finalizer to '%s/%s' cluster", o.Namespace, o.Name)
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		if !hasFinalizer(cluster) {
+			cluster.Finalizers = append(cluster.Finalizers, Finalizer)
+		}
+	})
+}
+
+func (c *Controller) removeFinalizer(o *stanv1alpha1.NatsStreamingCluster) error {
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		var finalizers []string
+		for _, f := range cluster.Finalizers {
+			if f != Finalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		cluster.Finalizers = finalizers
+	})
+}
+
+// dataClaims returns the PersistentVolumeClaims with the data of
+// the cluster, which are the ones with the labels of the cluster.
+// Claims that are only used by the volumes of the template, such as
+// a shared volume managed by the user, are never adopted nor deleted.
+func (c *Controller) dataClaims(o *stanv1alpha1.NatsStreamingCluster) ([]*k8scorev1.PersistentVolumeClaim, error) {
+	result, err := c.kc.CoreV1().PersistentVolumeClaims(o.Namespace).List(k8smetav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(clusterLabels(o.Name)).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims := make([]*k8scorev1.PersistentVolumeClaim, 0, len(result.Items))
+	for i := range result.Items {
+		claims = append(claims, &result.Items[i])
+	}
+	return claims, nil
+}
+
+func isOwnedBy(meta k8smetav1.Object, o *stanv1alpha1.NatsStreamingCluster) bool {
+	for _, ref := range meta.GetOwnerReferences() {
+		if ref.UID == o.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// adoptDataClaims makes the cluster an owner of its data volumes,
+// including the ones retained from a deleted cluster of the same name.
+func (c *Controller) adoptDataClaims(o *stanv1alpha1.NatsStreamingCluster) error {
+	claims, err := c.dataClaims(o)
+	if err != nil {
+		return err
+	}
+	var retained bool
+	for _, claim := range claims {
+		if isOwnedBy(claim, o) {
+			continue
+		}
+		if _, ok := claim.Labels[RetainedLabel]; ok {
+			log.Infof("Adopting retained volume claim '%s/%s'", o.Namespace, claim.Name)
+			retained = true
+		} else {
+			log.Infof("Adopting volume claim '%s/%s'", o.Namespace, claim.Name)
+		}
+
+		// Not the controller reference, since the claim may
+		// have been created by something else.
+		updated := claim.DeepCopy()
+		ref := clusterOwnerRef(o)
+		controller := false
+		ref.Controller = &controller
+		updated.OwnerReferences = append(updated.OwnerReferences, ref)
+		delete(updated.Labels, RetainedLabel)
+		if _, err := c.kc.CoreV1().PersistentVolumeClaims(o.Namespace).Update(updated); err != nil {
+			return err
+		}
+	}
+
+	// The retained volumes have the Raft state of the previous
+	// cluster, which must not be bootstrapped again.
+	if retained {
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Bootstrapped = true
+		})
+	}
+	return nil
+}
+
+// finalize cleans up the resources of a deleted cluster according
+// to its reclaim policy, then lets the deletion go ahead.
+func (c *Controller) finalize(o *stanv1alpha1.NatsStreamingCluster) error {
+	if !hasFinalizer(o) {
+		return nil
+	}
+	if isPaused(o) {
+		log.Infof("Holding deletion of paused '%s/%s' cluster", o.Namespace, o.Name)
+		return nil
+	}
+
+	policy := reclaimPolicy(o)
+	log.Infof("Cleaning up '%s/%s' cluster (reclaimPolicy=%s)", o.Namespace, o.Name, policy)
+	claims, err := c.dataClaims(o)
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case stanv1alpha1.ReclaimDelete:
+		if err := c.deleteOwnedResources(o); err != nil {
+			return err
+		}
+		for _, claim := range claims {
+			log.Infof("Deleting volume claim '%s/%s'", o.Namespace, claim.Name)
+			err := c.kc.CoreV1().PersistentVolumeClaims(o.Namespace).Delete(claim.Name, &k8smetav1.DeleteOptions{})
+			if err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+		}
+	default:
+		for _, claim := range claims {
+			if err := c.releaseClaim(o, claim); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.removeFinalizer(o)
+}
+
+// releaseClaim removes the cluster from the owners of a claim so
+// that it is not garbage collected, and labels it to be adopted by
+// a later cluster with the same name.
+func (c *Controller) releaseClaim(o *stanv1alpha1.NatsStreamingCluster, claim *k8scorev1.PersistentVolumeClaim) error {
+	log.Infof("Retaining volume claim '%s/%s'", o.Namespace, claim.Name)
+	updated := claim.DeepCopy()
+	var refs []k8smetav1.OwnerReference
+	for _, ref := range updated.OwnerReferences {
+		if ref.UID != o.UID {
+			refs = append(refs, ref)
+		}
+	}
+	updated.OwnerReferences = refs
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	for k, v := range clusterLabels(o.Name) {
+		updated.Labels[k] = v
+	}
+	updated.Labels[RetainedLabel] = o.Name
+	_, err := c.kc.CoreV1().PersistentVolumeClaims(o.Namespace).Update(updated)
+	return err
+}
+
+// deleteOwnedResources deletes the pods, Services, ConfigMaps and
+// Secrets of the cluster in order, before its volumes are deleted.
+func (c *Controller) deleteOwnedResources(o *stanv1alpha1.NatsStreamingCluster) error {
+	opts := k8smetav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(clusterLabels(o.Name)).String(),
+	}
+	core := c.kc.CoreV1()
+
+	pods, err := core.Pods(o.Namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		if !k8smetav1.IsControlledBy(&pod, o) {
+			continue
+		}
+		log.Infof("Deleting pod '%s/%s'", o.Namespace, pod.Name)
+		if err := core.Pods(o.Namespace).Delete(pod.Name, k8sDeleteInBackground()); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	svcs, err := core.Services(o.Namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs.Items {
+		if !k8smetav1.IsControlledBy(&svc, o) {
+			continue
+		}
+		log.Infof("Deleting service '%s/%s'", o.Namespace, svc.Name)
+		if err := core.Services(o.Namespace).Delete(svc.Name, &k8smetav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	cms, err := core.ConfigMaps(o.Namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		if !k8smetav1.IsControlledBy(&cm, o) {
+			continue
+		}
+		log.Infof("Deleting config map '%s/%s'", o.Namespace, cm.Name)
+		if err := core.ConfigMaps(o.Namespace).Delete(cm.Name, &k8smetav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	secrets, err := core.Secrets(o.Namespace).List(opts)
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets.Items {
+		if !k8smetav1.IsControlledBy(&secret, o) {
+			continue
+		}
+		log.Infof("Deleting secret '%s/%s'", o.Namespace, secret.Name)
+		if err := core.Secrets(o.Namespace).Delete(secret.Name, &k8smetav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestFinalizeReclaimPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy  stanv1alpha1.ReclaimPolicy
+		deleted bool
+	}{
+		{"", false},
+		{stanv1alpha1.ReclaimRetain, false},
+		{stanv1alpha1.ReclaimDelete, true},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+			o.UID = k8stypes.UID("stan-uid")
+			o.Spec.ReclaimPolicy = tc.policy
+			claim := &k8scorev1.PersistentVolumeClaim{
+				ObjectMeta: k8smetav1.ObjectMeta{
+					Name:      "stan-pvc",
+					Namespace: "default",
+					Labels:    clusterLabels("stan"),
+				},
+			}
+			// A claim managed by the user, only referenced by
+			// the template.
+			shared := &k8scorev1.PersistentVolumeClaim{
+				ObjectMeta: k8smetav1.ObjectMeta{
+					Name:      "shared-pvc",
+					Namespace: "default",
+				},
+			}
+			o.Spec.PodTemplate = &k8scorev1.PodTemplateSpec{
+				Spec: k8scorev1.PodSpec{
+					Volumes: []k8scorev1.Volume{{
+						Name: "shared",
+						VolumeSource: k8scorev1.VolumeSource{
+							PersistentVolumeClaim: &k8scorev1.PersistentVolumeClaimVolumeSource{ClaimName: "shared-pvc"},
+						},
+					}},
+				},
+			}
+			pod := newTestPod("stan-1")
+			pod.Labels = clusterLabels("stan")
+			pod.OwnerReferences = []k8smetav1.OwnerReference{clusterOwnerRef(o)}
+			c := newTestController([]k8sruntime.Object{o}, claim, shared, pod)
+
+			if err := c.ensureFinalizer(o); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.adoptDataClaims(o); err != nil {
+				t.Fatal(err)
+			}
+			claim, err := c.kc.CoreV1().PersistentVolumeClaims("default").Get("stan-pvc", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isOwnedBy(claim, o) {
+				t.Fatalf("Expected claim to be adopted, got: %+v", claim.OwnerReferences)
+			}
+
+			o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasFinalizer(o) {
+				t.Fatalf("Expected finalizer, got: %v", o.Finalizers)
+			}
+			now := k8smetav1.Now()
+			o.DeletionTimestamp = &now
+			if err := c.processUpdate(context.Background(), o, o); err != nil {
+				t.Fatal(err)
+			}
+
+			o, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer(o) {
+				t.Errorf("Expected finalizer to be removed, got: %v", o.Finalizers)
+			}
+			shared, err = c.kc.CoreV1().PersistentVolumeClaims("default").Get("shared-pvc", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected claim only referenced by the template to be kept: %v", err)
+			}
+			if len(shared.OwnerReferences) > 0 || len(shared.Labels) > 0 {
+				t.Errorf("Expected claim only referenced by the template to be left alone, got: %+v", shared.ObjectMeta)
+			}
+			claim, err = c.kc.CoreV1().PersistentVolumeClaims("default").Get("stan-pvc", k8smetav1.GetOptions{})
+			if tc.deleted {
+				if err == nil {
+					t.Errorf("Expected claim to be deleted")
+				}
+				if _, err := c.kc.CoreV1().Pods("default").Get("stan-1", k8smetav1.GetOptions{}); err == nil {
+					t.Errorf("Expected pod to be deleted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isOwnedBy(claim, o) || claim.Labels[RetainedLabel] != "stan" {
+				t.Errorf("Expected claim to be retained, got: %+v", claim.ObjectMeta)
+			}
+		})
+	}
+}
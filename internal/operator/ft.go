@@ -0,0 +1,182 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// sharedVolume returns whether a volume that is not a claim can
+// be mounted by pods on different nodes at the same time.
+func sharedVolume(volume k8scorev1.Volume) bool {
+	vs := volume.VolumeSource
+	return vs.NFS != nil || vs.CephFS != nil || vs.Glusterfs != nil || vs.AzureFile != nil || vs.Quobyte != nil
+}
+
+func hasAccessMode(claim *k8scorev1.PersistentVolumeClaim, mode k8scorev1.PersistentVolumeAccessMode) bool {
+	for _, m := range claim.Spec.AccessModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedStoreProblem returns why in FT mode the store is not on a
+// volume that all the nodes can mount at the same time, since the
+// standby servers take over the store of the active one.  Such a
+// store still works with all the pods on the same node.
+func (c *Controller) sharedStoreProblem(o *stanv1alpha1.NatsStreamingCluster) (string, error) {
+	pod := newStanNodePod(o, fmt.Sprintf("%s-1", o.Name))
+	volumes, _ := storeVolumes(pod, storeDir(o))
+	if len(volumes) == 0 {
+		return "config.storeDir is not on a volume shared by the nodes", nil
+	}
+	for _, volume := range volumes {
+		if sharedVolume(volume) {
+			continue
+		}
+		pvc := volume.PersistentVolumeClaim
+		if pvc == nil {
+			return fmt.Sprintf("volume %s may not be shared by nodes on different hosts", volume.Name), nil
+		}
+		claim, err := c.kc.CoreV1().PersistentVolumeClaims(o.Namespace).Get(pvc.ClaimName, k8smetav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if !hasAccessMode(claim, k8scorev1.ReadWriteMany) {
+			return fmt.Sprintf("claim %s has access modes %v rather than ReadWriteMany", claim.Name, claim.Spec.AccessModes), nil
+		}
+	}
+	return "", nil
+}
+
+// reconcileSharedStore warns in the status of a cluster in FT mode
+// whose store may not be shared by the nodes, which is kept running
+// as is.  The claims of the store are only checked again once its
+// volumes changed.
+func (c *Controller) reconcileSharedStore(o *stanv1alpha1.NatsStreamingCluster) error {
+	if !isFTMode(o) || o.Spec.Size < 2 || o.Spec.StoreType == "SQL" {
+		if getCondition(&o.Status, stanv1alpha1.ClusterStoreNotShared) == nil {
+			return nil
+		}
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			setCondition(status, stanv1alpha1.ClusterStoreNotShared, k8scorev1.ConditionFalse, "NotFaultTolerant", "")
+		})
+	}
+
+	volumes, _ := storeVolumes(newStanNodePod(o, fmt.Sprintf("%s-1", o.Name)), storeDir(o))
+	checked := fmt.Sprintf("%s %v", storeDir(o), volumes)
+	c.mu.Lock()
+	last := c.sharedStores[o.UID]
+	c.mu.Unlock()
+	if checked == last {
+		return nil
+	}
+
+	problem, err := c.sharedStoreProblem(o)
+	if err != nil {
+		log.Errorf("Failed to check the shared store of '%s/%s' cluster: %v", o.Namespace, o.Name, err)
+		return nil
+	}
+	if problem != "" {
+		log.Warnf("Store of '%s/%s' cluster in ft mode may not be shared by its nodes: %s", o.Namespace, o.Name, problem)
+		c.event(o, k8scorev1.EventTypeWarning, "StoreNotShared", "The store may not be shared by the nodes in ft mode: %s", problem)
+	}
+	err = c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		if problem == "" {
+			setCondition(status, stanv1alpha1.ClusterStoreNotShared, k8scorev1.ConditionFalse, "Shared", "")
+			return
+		}
+		setCondition(status, stanv1alpha1.ClusterStoreNotShared, k8scorev1.ConditionTrue, "NotShared",
+			fmt.Sprintf("The standby servers can only take over the store on the same host: %s", problem))
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.sharedStores[o.UID] = checked
+	c.mu.Unlock()
+	return nil
+}
+
+// ftRoles returns the node running the active server and the ones
+// running a standby server, as last scraped from their monitoring
+// endpoint.  Pods created since the last scrape are left out.
+func ftRoles(pods []*k8scorev1.Pod, stats *stanv1alpha1.ClusterStats) (string, []string) {
+	var active string
+	var standbys []string
+	for _, pod := range pods {
+		if stats.LastScrapeTime.Before(&pod.CreationTimestamp) {
+			continue
+		}
+		for _, node := range stats.Nodes {
+			if node.Name != pod.Name {
+				continue
+			}
+			switch node.State {
+			case serverStateFTActive:
+				active = pod.Name
+			case serverStateFTStandby:
+				standbys = append(standbys, pod.Name)
+			}
+		}
+	}
+	sort.Strings(standbys)
+	return active, standbys
+}
+
+// reconcileFaultTolerance records the active and standby nodes, which
+// are kept as they were while there are no recent stats.
+func (c *Controller) reconcileFaultTolerance(o *stanv1alpha1.NatsStreamingCluster) error {
+	var ft *stanv1alpha1.FaultToleranceStatus
+	if isFTMode(o) {
+		stats := c.recentStats(o)
+		if stats == nil {
+			log.Debugf("Not checking the active server of '%s/%s' cluster without recent stats", o.Namespace, o.Name)
+			return nil
+		}
+		pods, err := c.findRunningPods(o.Name, o.Namespace)
+		if err != nil {
+			return err
+		}
+		active, standbys := ftRoles(pods, stats)
+		ft = &stanv1alpha1.FaultToleranceStatus{Active: active, Standbys: standbys}
+		if active == "" && len(pods) > 0 {
+			log.Warnf("No active server found in '%s/%s' cluster", o.Namespace, o.Name)
+		}
+	}
+	if reflect.DeepEqual(o.Status.FaultTolerance, ft) {
+		return nil
+	}
+	if ft != nil && ft.Active != "" && (o.Status.FaultTolerance == nil || o.Status.FaultTolerance.Active != ft.Active) {
+		log.Infof("Active server of '%s/%s' cluster is %s", o.Namespace, o.Name, ft.Active)
+	}
+	err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.FaultTolerance = ft
+	})
+	if err != nil {
+		return err
+	}
+	// Also used to order the updates of the pods.
+	o.Status.FaultTolerance = ft
+	return nil
+}
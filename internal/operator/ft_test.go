@@ -0,0 +1,133 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestFaultTolerance(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Spec.Mode = stanv1alpha1.ModeFaultTolerance
+	claim := &k8scorev1.PersistentVolumeClaim{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-pvc", Namespace: "default"},
+		Spec: k8scorev1.PersistentVolumeClaimSpec{
+			AccessModes: []k8scorev1.PersistentVolumeAccessMode{k8scorev1.ReadWriteOnce},
+		},
+	}
+	pods := newTestStorePods(o)
+	c := newTestController([]k8sruntime.Object{o}, append(pods, claim)...)
+
+	notShared := func(o *stanv1alpha1.NatsStreamingCluster) *stanv1alpha1.ClusterCondition {
+		t.Helper()
+		if err := c.reconcileSharedStore(o); err != nil {
+			t.Fatal(err)
+		}
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return getCondition(&result.Status, stanv1alpha1.ClusterStoreNotShared)
+	}
+	if cond := notShared(o); cond == nil || cond.Status != k8scorev1.ConditionTrue || !strings.Contains(cond.Message, "claim stan-pvc") {
+		t.Errorf("Expected ReadWriteOnce claim to be warned about in ft mode, got: %+v", cond)
+	}
+	claim.Spec.AccessModes = []k8scorev1.PersistentVolumeAccessMode{k8scorev1.ReadWriteMany}
+	if _, err := c.kc.CoreV1().PersistentVolumeClaims("default").Update(claim); err != nil {
+		t.Fatal(err)
+	}
+	if cond := notShared(o); cond == nil || cond.Status != k8scorev1.ConditionTrue {
+		t.Errorf("Expected the claim not to be checked again until the volumes change, got: %+v", cond)
+	}
+	c.sharedStores = make(map[k8stypes.UID]string)
+	if cond := notShared(o); cond == nil || cond.Status != k8scorev1.ConditionFalse {
+		t.Errorf("Expected ReadWriteMany claim to be accepted, got: %+v", cond)
+	}
+	nfs := o.DeepCopy()
+	nfs.Spec.PodTemplate.Spec.Volumes[0].VolumeSource = k8scorev1.VolumeSource{
+		NFS: &k8scorev1.NFSVolumeSource{Server: "nfs", Path: "/exports"},
+	}
+	if problem, err := c.sharedStoreProblem(nfs); err != nil || problem != "" {
+		t.Errorf("Expected NFS volume to be accepted, got: %q %v", problem, err)
+	}
+	local := o.DeepCopy()
+	local.Spec.PodTemplate.Spec.Volumes[0].VolumeSource = k8scorev1.VolumeSource{
+		EmptyDir: &k8scorev1.EmptyDirVolumeSource{},
+	}
+	if cond := notShared(local); cond == nil || cond.Status != k8scorev1.ConditionTrue || !strings.Contains(cond.Message, "volume store") {
+		t.Errorf("Expected emptyDir volume to be warned about in ft mode, got: %+v", cond)
+	}
+
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"FT_STANDBY"}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"FT_ACTIVE"}`,
+		"10.0.0.3:8222/streaming/serverz": `{"cluster_id":"stan","state":"FT_STANDBY"}`,
+	}
+	if err := c.reconcileFaultTolerance(o); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{}); result.Status.FaultTolerance != nil {
+		t.Errorf("Expected the servers not to be recorded before they are scraped, got: %+v", result.Status.FaultTolerance)
+	}
+	if err := c.scrapeCluster(o); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Status.Stats = result.Status.Stats
+	if err := c.reconcileFaultTolerance(o); err != nil {
+		t.Fatal(err)
+	}
+	expected := &stanv1alpha1.FaultToleranceStatus{Active: "stan-2", Standbys: []string{"stan-1", "stan-3"}}
+	result, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Status.FaultTolerance, expected) {
+		t.Errorf("Expected %+v in status, got: %+v", expected, result.Status.FaultTolerance)
+	}
+
+	// The standbys are updated first, even when all the pods
+	// could be updated at once.
+	all := k8sintstr.FromString("100%")
+	o.Spec.UpdateStrategy = &stanv1alpha1.UpdateStrategy{
+		RollingUpdate: &stanv1alpha1.RollingUpdateStrategy{MaxUnavailable: &all},
+	}
+	o.Spec.Image = "nats-streaming:latest"
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	result, err = c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updating []string
+	for _, update := range result.Status.Updates {
+		updating = append(updating, update.Pod)
+	}
+	if !reflect.DeepEqual(updating, []string{"stan-3", "stan-1"}) {
+		t.Errorf("Expected only the standbys to be updated, got: %v", updating)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics exported by the operator in the Prometheus text format.
+const (
+	metricBackupLastSuccess = "nats_streaming_backup_schedule_last_success_timestamp_seconds"
+	metricBackupLastFailure = "nats_streaming_backup_schedule_last_failure_timestamp_seconds"
+	metricBackupNextRun     = "nats_streaming_backup_schedule_next_run_timestamp_seconds"
+)
+
+var metricHelp = map[string]string{
+	metricBackupLastSuccess: "Time of the latest successful backup of the schedule.",
+	metricBackupLastFailure: "Time of the latest failed backup of the schedule.",
+	metricBackupNextRun:     "Time of the next backup of the schedule.",
+}
+
+// metrics is the set of gauges exported by the operator, keyed
+// by their name and then by their rendered labels.
+type metrics struct {
+	mu     sync.Mutex
+	gauges map[string]map[string]float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{gauges: make(map[string]map[string]float64)}
+}
+
+// formatLabels renders the labels of a sample in a stable order.
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, strconv.Quote(labels[k]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *metrics) set(name string, labels map[string]string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples, ok := m.gauges[name]
+	if !ok {
+		samples = make(map[string]float64)
+		m.gauges[name] = samples
+	}
+	samples[formatLabels(labels)] = value
+}
+
+func (m *metrics) get(name string, labels map[string]string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.gauges[name][formatLabels(labels)]
+	return value, ok
+}
+
+func (m *metrics) delete(name string, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.gauges[name], formatLabels(labels))
+}
+
+// write renders all the metrics in the Prometheus text format.
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.gauges))
+	for name := range m.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		samples := m.gauges[name]
+		if len(samples) == 0 {
+			continue
+		}
+		if help, ok := metricHelp[name]; ok {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, help); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s gauge\n", name); err != nil {
+			return err
+		}
+		labels := make([]string, 0, len(samples))
+		for l := range samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			value := strconv.FormatFloat(samples[l], 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s{%s} %s\n", name, l, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// serveMetrics serves the metrics of the operator until the
+// context is canceled.
+func (c *Controller) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c.metrics)
+	// Also used by the liveness and readiness probes of the chart.
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{Addr: c.opts.MetricsAddress, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Infof("Serving metrics on %s", c.opts.MetricsAddress)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("Error serving metrics: %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// clusterMode returns the mode in which the nodes should run.
+func clusterMode(o *stanv1alpha1.NatsStreamingCluster) stanv1alpha1.ClusterMode {
+	switch {
+	case isFTMode(o):
+		return stanv1alpha1.ModeFaultTolerance
+	case isClustered(o):
+		return stanv1alpha1.ModeClustered
+	}
+	return stanv1alpha1.ModeStandalone
+}
+
+// podMode returns the mode in which a pod was started.
+func podMode(pod *k8scorev1.Pod) stanv1alpha1.ClusterMode {
+	if len(pod.Spec.Containers) < 1 {
+		return stanv1alpha1.ModeStandalone
+	}
+	for _, arg := range pod.Spec.Containers[0].Command {
+		if arg == "-clustered" {
+			return stanv1alpha1.ModeClustered
+		}
+		if strings.HasPrefix(arg, "--ft_group=") {
+			return stanv1alpha1.ModeFaultTolerance
+		}
+	}
+	return stanv1alpha1.ModeStandalone
+}
+
+func modeTransitionJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-mode-transition", o.Name)
+}
+
+// movesStore returns whether the store has to be moved, since the
+// nodes only share the store of the first one when not clustered.
+func movesStore(t *stanv1alpha1.ModeTransition) bool {
+	return t.From == stanv1alpha1.ModeClustered || t.To == stanv1alpha1.ModeClustered
+}
+
+// reconcileMode records the mode in which the nodes run and switches
+// them over to a new one, returning whether a switch is in progress
+// during which the nodes are not to be started.  The switch stops all
+// the nodes, moves the store to the layout of the new mode and then
+// starts them again, refusing to do so when data could be lost.
+func (c *Controller) reconcileMode(o *stanv1alpha1.NatsStreamingCluster) (bool, error) {
+	// There is no store on the file system to move.
+	if o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" {
+		return false, nil
+	}
+	if t := o.Status.ModeTransition; t != nil {
+		return c.advanceModeTransition(o, t.DeepCopy())
+	}
+
+	desired := clusterMode(o)
+	current := o.Status.Mode
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return false, err
+	}
+	if current == "" {
+		// Pick up the mode of clusters created before it was
+		// recorded, which was always the one of the spec unless
+		// it is now set explicitly.
+		current = desired
+		if o.Spec.Mode != "" && len(pods) > 0 {
+			current = podMode(pods[0])
+		}
+	}
+	if current == desired {
+		if o.Status.Mode == desired {
+			return false, nil
+		}
+		return false, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Mode = desired
+		})
+	}
+
+	now := k8smetav1.Now()
+	t := &stanv1alpha1.ModeTransition{
+		From:      current,
+		To:        desired,
+		Phase:     stanv1alpha1.ModeTransitionStopping,
+		Source:    fmt.Sprintf("%s-1", o.Name),
+		StartTime: &now,
+	}
+	for _, pod := range pods {
+		t.Nodes = append(t.Nodes, pod.Name)
+	}
+	sort.Strings(t.Nodes)
+
+	_, mounts := storeVolumes(newStanNodePod(o, t.Source), storeDir(o))
+	if storeDir(o) == "" || len(mounts) == 0 {
+		if len(pods) > 0 {
+			return false, c.refuseModeTransition(o, t, "the store of the nodes is not on a volume and would be lost, delete the pods to switch anyway")
+		}
+		// Nothing to move in case the nodes are not running.
+		return false, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.Mode = desired
+		})
+	}
+	if desired == stanv1alpha1.ModeClustered && hasExplicitPeers(o) {
+		return false, c.refuseModeTransition(o, t, "the nodes cannot be seeded from the store of the first one with explicit peers, disable them for the switch")
+	}
+	if current == stanv1alpha1.ModeClustered {
+		// Only the store of the leader is known to have all the
+		// committed messages, the store of the others is dropped.
+		leader := c.clusterLeader(o, pods)
+		if leader == "" {
+			return false, c.refuseModeTransition(o, t, "the leader of the Raft group could not be found to keep its store")
+		}
+		t.Source = leader
+	}
+
+	log.Infof("Switching '%s/%s' cluster from %s to %s mode, keeping the store of %s", o.Namespace, o.Name, t.From, t.To, t.Source)
+	t.Message = "stopping the nodes"
+	if err := c.updateModeTransition(o, t); err != nil {
+		return false, err
+	}
+	return c.advanceModeTransition(o, t)
+}
+
+// storeDir returns the directory with the stores of the nodes,
+// empty unless it is set in the config.
+func storeDir(o *stanv1alpha1.NatsStreamingCluster) string {
+	if o.Spec.Config == nil {
+		return ""
+	}
+	return o.Spec.Config.StoreDir
+}
+
+// clusterLeader returns the name of the pod that is the leader of
+// the Raft group as last scraped, or an empty string when there is
+// none or the stats are not recent.
+func (c *Controller) clusterLeader(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod) string {
+	for _, node := range raftNodes(o, pods, c.recentStats(o)) {
+		if podIsReady(node.pod) && node.isLeader() {
+			return node.pod.Name
+		}
+	}
+	return ""
+}
+
+func (c *Controller) refuseModeTransition(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition, reason string) error {
+	err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		setCondition(status, stanv1alpha1.ClusterModeTransition, k8scorev1.ConditionFalse, "Refused",
+			fmt.Sprintf("Refusing to switch from %s to %s mode: %s", t.From, t.To, reason))
+	})
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("refusing to switch '%s/%s' cluster from %s to %s mode: %s", o.Namespace, o.Name, t.From, t.To, reason)
+}
+
+// setModeTransition sets the progress of the switch in the status.
+func setModeTransition(status *stanv1alpha1.NatsStreamingClusterStatus, t *stanv1alpha1.ModeTransition) {
+	status.ModeTransition = t.DeepCopy()
+	cstatus := k8scorev1.ConditionTrue
+	if t.Phase == stanv1alpha1.ModeTransitionFailed {
+		cstatus = k8scorev1.ConditionFalse
+	}
+	setCondition(status, stanv1alpha1.ClusterModeTransition, cstatus, string(t.Phase),
+		fmt.Sprintf("Switching from %s to %s mode: %s", t.From, t.To, t.Message))
+}
+
+func (c *Controller) updateModeTransition(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) error {
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		setModeTransition(status, t)
+	})
+}
+
+// advanceModeTransition advances the switch by one step, returning
+// whether the nodes are still to be kept stopped.
+func (c *Controller) advanceModeTransition(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) (bool, error) {
+	if desired := clusterMode(o); desired != t.To && t.Phase != stanv1alpha1.ModeTransitionStarting {
+		log.Warnf("Cluster '%s/%s' is still being switched to %s mode, switching to %s mode once done", o.Namespace, o.Name, t.To, desired)
+	}
+
+	switch t.Phase {
+	case stanv1alpha1.ModeTransitionStopping:
+		stopped, err := c.stopNodes(o, fmt.Sprintf("to switch to %s mode", t.To))
+		if err != nil || !stopped {
+			return true, err
+		}
+		if !movesStore(t) {
+			return true, c.startNodes(o, t)
+		}
+		t.Phase = stanv1alpha1.ModeTransitionMovingData
+		t.Job = modeTransitionJobName(o)
+		t.Message = fmt.Sprintf("moving the store of %s", t.Source)
+		if err := c.createModeTransitionJob(o, t); err != nil {
+			return true, err
+		}
+		return true, c.updateModeTransition(o, t)
+
+	case stanv1alpha1.ModeTransitionMovingData:
+		job, failure, err := c.pollStoreJob(o, t.Job, func() error {
+			return c.createModeTransitionJob(o, t)
+		})
+		if err != nil {
+			return true, err
+		}
+		if failure != "" {
+			log.Errorf("Failed to move the store of '%s/%s' cluster: %s", o.Namespace, o.Name, failure)
+			t.Phase = stanv1alpha1.ModeTransitionFailed
+			t.Message = fmt.Sprintf("moving the store failed, delete job %s to retry: %s", t.Job, failure)
+			return true, c.updateModeTransition(o, t)
+		}
+		if job == nil {
+			return true, nil
+		}
+		if err := c.deleteStoreJob(o, job.Name); err != nil {
+			return true, err
+		}
+		return true, c.startNodes(o, t)
+
+	case stanv1alpha1.ModeTransitionFailed:
+		deleted, err := c.storeJobDeleted(o, t.Job)
+		if err != nil || !deleted {
+			return true, err
+		}
+		log.Infof("Retrying to move the store of '%s/%s' cluster", o.Namespace, o.Name)
+		t.Phase = stanv1alpha1.ModeTransitionMovingData
+		t.Message = fmt.Sprintf("moving the store of %s", t.Source)
+		return true, c.updateModeTransition(o, t)
+
+	case stanv1alpha1.ModeTransitionStarting:
+		pods, err := c.findRunningPods(o.Name, o.Namespace)
+		if err != nil {
+			return false, err
+		}
+		ready := 0
+		for _, pod := range pods {
+			if podIsReady(pod) {
+				ready++
+			}
+		}
+		if ready < int(o.Spec.Size) {
+			return false, nil
+		}
+		log.Infof("Switched '%s/%s' cluster from %s to %s mode", o.Namespace, o.Name, t.From, t.To)
+		return false, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.ModeTransition = nil
+			setCondition(status, stanv1alpha1.ClusterModeTransition, k8scorev1.ConditionFalse, "Completed",
+				fmt.Sprintf("Switched from %s to %s mode", t.From, t.To))
+		})
+	}
+	return false, fmt.Errorf("unknown phase %q of the mode switch of '%s/%s' cluster", t.Phase, o.Namespace, o.Name)
+}
+
+// startNodes records the new mode so that the nodes are started in
+// it, bootstrapping the Raft group again from the first node.
+func (c *Controller) startNodes(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) error {
+	t.Phase = stanv1alpha1.ModeTransitionStarting
+	t.Message = "starting the nodes"
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		setModeTransition(status, t)
+		status.Mode = t.To
+		status.Bootstrapped = false
+		status.BootstrapNode = ""
+		status.BootstrapTime = nil
+	})
+}
+
+// modeTransitionScript moves the store of the source node to the
+// first node, which is the store used by every mode, and removes
+// the stores and Raft logs of the other nodes which are outdated.
+func modeTransitionScript(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) string {
+	dir := storeDir(o)
+	first := fmt.Sprintf("%s-1", o.Name)
+	src, dst := shellQuote(path.Join(dir, t.Source)), shellQuote(path.Join(dir, first))
+
+	lines := []string{"set -e"}
+	if t.Source != first {
+		// Already moved in case the job is retried.
+		lines = append(lines,
+			fmt.Sprintf("if [ -d %s ]; then", src),
+			fmt.Sprintf("  rm -rf %s", dst),
+			fmt.Sprintf("  mv %s %s", src, dst),
+			"fi",
+		)
+	}
+	lines = append(lines,
+		fmt.Sprintf("if [ ! -d %s ]; then", dst),
+		fmt.Sprintf(`  echo "No store found at %s" >&2`, path.Join(dir, first)),
+		"  exit 1",
+		"fi",
+	)
+
+	nodes := map[string]bool{first: true}
+	for _, name := range t.Nodes {
+		nodes[name] = true
+	}
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		nodes[fmt.Sprintf("%s-%d", o.Name, i)] = true
+	}
+	var stale []string
+	for name := range nodes {
+		if name != first {
+			stale = append(stale, path.Join(dir, name))
+		}
+		stale = append(stale, path.Join(dir, "raft", name))
+	}
+	sort.Strings(stale)
+	lines = append(lines, fmt.Sprintf("rm -rf %s", shellQuoteAll(stale)))
+	return strings.Join(lines, "\n")
+}
+
+func newModeTransitionJob(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) (*k8sbatchv1.Job, error) {
+	node := newStanNodePod(o, fmt.Sprintf("%s-1", o.Name))
+	volumes, mounts := storeVolumes(node, storeDir(o))
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no volume of pod %s has the store directory %s", node.Name, storeDir(o))
+	}
+
+	job := newTargetJob(k8smetav1.ObjectMeta{
+		Name:      t.Job,
+		Namespace: o.Namespace,
+		Labels: map[string]string{
+			"app":          "nats-streaming-mode-transition",
+			"stan_cluster": o.Name,
+		},
+		OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+	}, "", &stanv1alpha1.BackupTarget{}, modeTransitionScript(o, t), volumes, mounts)
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.ImagePullSecrets = o.Spec.ImagePullSecrets
+	podSpec.SecurityContext = node.Spec.SecurityContext
+	return job, nil
+}
+
+func (c *Controller) createModeTransitionJob(o *stanv1alpha1.NatsStreamingCluster, t *stanv1alpha1.ModeTransition) error {
+	job, err := newModeTransitionJob(o, t)
+	if err != nil {
+		return err
+	}
+	log.Infof("Creating job '%s/%s' to move the store of %s", job.Namespace, job.Name, t.Source)
+	_, err = c.kc.BatchV1().Jobs(o.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
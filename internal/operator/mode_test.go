@@ -0,0 +1,154 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileModeTransition(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Status.Mode = stanv1alpha1.ModeClustered
+	c := newTestController([]k8sruntime.Object{o}, newTestStorePods(o)...)
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	reconcileMode := func(o *stanv1alpha1.NatsStreamingCluster) bool {
+		o.Spec.Mode = stanv1alpha1.ModeFaultTolerance
+		switching, err := c.reconcileMode(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return switching
+	}
+
+	// Refused without a leader to take the store from.
+	o.Spec.Mode = stanv1alpha1.ModeFaultTolerance
+	if _, err := c.reconcileMode(o); err == nil {
+		t.Fatalf("Expected switch without a leader to be refused")
+	}
+	if cond := getCondition(&getCluster().Status, stanv1alpha1.ClusterModeTransition); cond == nil || cond.Reason != "Refused" {
+		t.Errorf("Expected refused condition, got: %+v", cond)
+	}
+	if pods, _ := c.findRunningPods("stan", "default"); len(pods) != 3 {
+		t.Fatalf("Expected pods to keep running, got: %d", len(pods))
+	}
+
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower"}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader"}`,
+	}
+	if err := c.scrapeCluster(getCluster()); err != nil {
+		t.Fatal(err)
+	}
+	if !reconcileMode(getCluster()) {
+		t.Fatalf("Expected switch to be in progress")
+	}
+	if pods, _ := c.findPods("stan", "default"); len(pods.Items) != 0 {
+		t.Fatalf("Expected pods to be stopped, got: %d", len(pods.Items))
+	}
+	if !reconcileMode(getCluster()) {
+		t.Fatalf("Expected switch to be in progress")
+	}
+	mt := getCluster().Status.ModeTransition
+	if mt == nil || mt.Phase != stanv1alpha1.ModeTransitionMovingData || mt.Source != "stan-2" || mt.From != stanv1alpha1.ModeClustered {
+		t.Fatalf("Expected store of the leader to be moved, got: %+v", mt)
+	}
+	job, err := c.kc.BatchV1().Jobs("default").Get(mt.Job, k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := job.Spec.Template.Spec.Containers[0].Command[2]
+	for _, expected := range []string{
+		`mv '/pv/stan/stan-2' '/pv/stan/stan-1'`,
+		`rm -rf '/pv/stan/raft/stan-1' '/pv/stan/raft/stan-2' '/pv/stan/raft/stan-3' '/pv/stan/stan-2' '/pv/stan/stan-3'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script, got:\n%s", expected, script)
+		}
+	}
+
+	// Nodes are kept stopped until the store is moved.
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	if !reconcileMode(getCluster()) {
+		t.Fatalf("Expected switch to be in progress")
+	}
+	o = getCluster()
+	if o.Status.Mode != stanv1alpha1.ModeFaultTolerance || o.Status.ModeTransition.Phase != stanv1alpha1.ModeTransitionStarting {
+		t.Fatalf("Expected nodes to be started in ft mode, got: %+v", o.Status)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get(mt.Job, k8smetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected job to be deleted")
+	}
+	if reconcileMode(o) {
+		t.Fatalf("Expected nodes to be started")
+	}
+
+	o.Spec.Mode = stanv1alpha1.ModeFaultTolerance
+	for _, pod := range newTestStorePods(o) {
+		if _, err := c.kc.CoreV1().Pods("default").Create(pod.(*k8scorev1.Pod)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reconcileMode(o) {
+		t.Fatalf("Expected switch to be done")
+	}
+	o = getCluster()
+	if o.Status.ModeTransition != nil {
+		t.Errorf("Expected switch to be done, got: %+v", o.Status.ModeTransition)
+	}
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterModeTransition); cond == nil || cond.Reason != "Completed" {
+		t.Errorf("Expected completed condition, got: %+v", cond)
+	}
+	o.Spec.Mode = stanv1alpha1.ModeFaultTolerance
+	if cmd := strings.Join(stanContainerCmd(o, newTestPod("stan-3")), " "); !strings.Contains(cmd, "-dir /pv/stan/stan-1 --ft_group=stan") {
+		t.Errorf("Expected nodes to share the store of the first one, got: %s", cmd)
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode   stanv1alpha1.ClusterMode
+		size   int32
+		config *stanv1alpha1.ServerConfig
+		valid  bool
+	}{
+		{stanv1alpha1.ModeStandalone, 1, nil, true},
+		{stanv1alpha1.ModeStandalone, 3, nil, false},
+		{stanv1alpha1.ModeFaultTolerance, 2, &stanv1alpha1.ServerConfig{StoreDir: "/pv"}, true},
+		{stanv1alpha1.ModeFaultTolerance, 2, &stanv1alpha1.ServerConfig{}, false},
+		{stanv1alpha1.ModeClustered, 3, &stanv1alpha1.ServerConfig{}, true},
+		{stanv1alpha1.ModeClustered, 3, &stanv1alpha1.ServerConfig{FTGroup: "stan"}, false},
+		{"raft", 3, &stanv1alpha1.ServerConfig{}, false},
+	} {
+		o := newTestCluster("stan", tt.size, tt.config)
+		o.Spec.Mode = tt.mode
+		if err := validateCluster(o); (err == nil) != tt.valid {
+			t.Errorf("Expected mode %s with size %d to be valid=%v, got: %v", tt.mode, tt.size, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// monitoringTimeout is how long to wait for the monitoring
+// endpoint of a server.
+const monitoringTimeout = 5 * time.Second
+
+// HTTPClient makes the requests to the monitoring endpoints of
+// the servers, so that it can be replaced in tests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Server roles as reported by the monitoring endpoint.
+const (
+	serverRoleLeader    = "Leader"
+	serverRoleFollower  = "Follower"
+	serverRoleCandidate = "Candidate"
+)
+
+// Server states in FT mode as reported by the monitoring endpoint.
+const (
+	serverStateFTActive  = "FT_ACTIVE"
+	serverStateFTStandby = "FT_STANDBY"
+)
+
+// serverz is the part of the response of the /streaming/serverz
+// monitoring endpoint used by the operator.
+type serverz struct {
+	ClusterID     string `json:"cluster_id"`
+	ServerID      string `json:"server_id"`
+	Version       string `json:"version"`
+	State         string `json:"state"`
+	Role          string `json:"role,omitempty"`
+	Clients       int    `json:"clients"`
+	Subscriptions int    `json:"subscriptions"`
+	Channels      int    `json:"channels"`
+	TotalMsgs     uint64 `json:"total_msgs"`
+	TotalBytes    uint64 `json:"total_bytes"`
+}
+
+// storez is the part of the response of the /streaming/storez
+// monitoring endpoint used by the operator.
+type storez struct {
+	Type string `json:"type"`
+}
+
+// channelsz is the part of the response of the /streaming/channelsz
+// monitoring endpoint used by the operator.
+type channelsz struct {
+	Total    int `json:"total"`
+	Channels []struct {
+		Subscriptions []struct {
+			PendingCount int `json:"pending_count"`
+		} `json:"subscriptions"`
+	} `json:"channels"`
+}
+
+// clientsz is the part of the response of the /streaming/clientsz
+// monitoring endpoint used by the operator.
+type clientsz struct {
+	Total int `json:"total"`
+}
+
+// monitoringURL is the URL of an endpoint of the monitoring
+// server of a pod.
+func monitoringURL(pod *k8scorev1.Pod, path string) string {
+	return fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, MonitoringPort, path)
+}
+
+// getMonitoring gets an endpoint of the monitoring server of
+// a pod and decodes its JSON response.
+func (c *Controller) getMonitoring(pod *k8scorev1.Pod, path string, v interface{}) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod '%s/%s' has no IP", pod.Namespace, pod.Name)
+	}
+	req, err := http.NewRequest("GET", monitoringURL(pod, path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from %s: %s", req.URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// serverInfo returns the state of the server running in a pod.
+func (c *Controller) serverInfo(pod *k8scorev1.Pod) (*serverz, error) {
+	info := &serverz{}
+	if err := c.getMonitoring(pod, "/streaming/serverz", info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func isPartitioned(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return o.Spec.Config != nil && o.Spec.Config.Partitioning != nil
+}
+
+// stanClusterID is the ID of the NATS Streaming cluster, which is
+// shared by all the clusters that are partitions of the same one.
+func stanClusterID(o *stanv1alpha1.NatsStreamingCluster) string {
+	if isPartitioned(o) && o.Spec.Config.Partitioning.ClusterID != "" {
+		return o.Spec.Config.Partitioning.ClusterID
+	}
+	return o.Name
+}
+
+// validChannel returns whether the channel is a valid
+// subject, optionally with wildcards.
+func validChannel(channel string) bool {
+	if channel == "" {
+		return false
+	}
+	tokens := strings.Split(channel, ".")
+	for i, token := range tokens {
+		if token == "" || strings.ContainsAny(token, " \t") {
+			return false
+		}
+		if token == ">" && i != len(tokens)-1 {
+			return false
+		}
+		if len(token) > 1 && strings.ContainsAny(token, "*>") {
+			return false
+		}
+	}
+	return true
+}
+
+// channelsOverlap returns whether there is any channel
+// that would match both names or wildcard patterns.
+func channelsOverlap(a, b string) bool {
+	at := strings.Split(a, ".")
+	bt := strings.Split(b, ".")
+	for i := 0; ; i++ {
+		if i == len(at) || i == len(bt) {
+			return len(at) == len(bt)
+		}
+		if at[i] == ">" || bt[i] == ">" {
+			return true
+		}
+		if at[i] != bt[i] && at[i] != "*" && bt[i] != "*" {
+			return false
+		}
+	}
+}
+
+// channelCovers returns whether every channel matched by the
+// name or wildcard pattern is also matched by the pattern.
+func channelCovers(pattern, channel string) bool {
+	pt := strings.Split(pattern, ".")
+	ct := strings.Split(channel, ".")
+	for i := 0; ; i++ {
+		if i == len(pt) || i == len(ct) {
+			return len(pt) == len(ct)
+		}
+		if pt[i] == ">" {
+			return true
+		}
+		if ct[i] == ">" || (pt[i] != ct[i] && pt[i] != "*") {
+			return false
+		}
+	}
+}
+
+// partitionOverlaps returns the channels of the cluster that
+// overlap with the partitions of other clusters that have the
+// same cluster ID and connect to the same NATS service.
+func partitionOverlaps(o *stanv1alpha1.NatsStreamingCluster, others []stanv1alpha1.NatsStreamingCluster) []string {
+	var overlaps []string
+	for _, other := range others {
+		if other.UID == o.UID || !isPartitioned(&other) {
+			continue
+		}
+		if other.Spec.NatsService != o.Spec.NatsService || stanClusterID(&other) != stanClusterID(o) {
+			continue
+		}
+		for _, channel := range o.Spec.Config.Partitioning.Channels {
+			for _, otherChannel := range other.Spec.Config.Partitioning.Channels {
+				if channelsOverlap(channel, otherChannel) {
+					overlaps = append(overlaps, fmt.Sprintf("%s (%s in %s)", channel, otherChannel, other.Name))
+				}
+			}
+		}
+	}
+	sort.Strings(overlaps)
+	return overlaps
+}
+
+// reconcilePartitions warns in the status of the cluster
+// about channels that are owned by other partitions too.
+func (c *Controller) reconcilePartitions(o *stanv1alpha1.NatsStreamingCluster) error {
+	if !isPartitioned(o) {
+		if getCondition(&o.Status, stanv1alpha1.ClusterPartitionsOverlap) == nil {
+			return nil
+		}
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			setCondition(status, stanv1alpha1.ClusterPartitionsOverlap, k8scorev1.ConditionFalse, "NotPartitioned", "")
+		})
+	}
+
+	clusters, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters(o.Namespace).List(k8smetav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	overlaps := partitionOverlaps(o, clusters.Items)
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		if len(overlaps) == 0 {
+			setCondition(status, stanv1alpha1.ClusterPartitionsOverlap, k8scorev1.ConditionFalse, "NoOverlap", "")
+			return
+		}
+		message := fmt.Sprintf("Channels owned by other partitions: %s", strings.Join(overlaps, ", "))
+		log.Warnf("Partition of '%s/%s' cluster overlaps: %s", o.Namespace, o.Name, message)
+		setCondition(status, stanv1alpha1.ClusterPartitionsOverlap, k8scorev1.ConditionTrue, "ChannelsOverlap", message)
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestChannelsOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"foo.*", "foo.bar", true},
+		{"foo.*", "foo.bar.baz", false},
+		{"foo.>", "foo.bar.baz", true},
+		{"foo.>", "foo", false},
+		{"*.bar", "foo.*", true},
+		{">", "foo", true},
+		{"foo.bar", "foo.baz", false},
+	} {
+		if got := channelsOverlap(tc.a, tc.b); got != tc.overlap {
+			t.Errorf("Expected overlap of %q and %q to be %v, got %v", tc.a, tc.b, tc.overlap, got)
+		}
+		if got := channelsOverlap(tc.b, tc.a); got != tc.overlap {
+			t.Errorf("Expected overlap of %q and %q to be %v, got %v", tc.b, tc.a, tc.overlap, got)
+		}
+	}
+}
+
+func TestReconcilePartitions(t *testing.T) {
+	newPartition := func(name, uid string, channels ...string) *stanv1alpha1.NatsStreamingCluster {
+		o := newTestCluster(name, 1, &stanv1alpha1.ServerConfig{
+			Partitioning: &stanv1alpha1.PartitioningConfig{
+				ClusterID: "stan",
+				Channels:  channels,
+			},
+		})
+		o.UID = k8stypes.UID(uid)
+		return o
+	}
+	a := newPartition("stan-a", "a", "orders.*", "payments")
+	b := newPartition("stan-b", "b", "orders.eu", "users.>")
+	c := newTestController([]k8sruntime.Object{a, b})
+
+	if err := validateCluster(a); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cmd := strings.Join(stanContainerCmd(a, newTestPod("stan-a-1")), " ")
+	if !strings.Contains(cmd, "-cluster_id stan") || !strings.Contains(cmd, "-sc /etc/stan-operator/stan.conf") {
+		t.Errorf("Expected shared cluster ID and generated configuration file, got: %s", cmd)
+	}
+	conf := stanConfigFile(a)
+	if !strings.Contains(conf, "partitioning: true") || !strings.Contains(conf, `"orders.*": {}`) {
+		t.Errorf("Expected partitioned channels in configuration file, got: %s", conf)
+	}
+
+	if err := c.reconcilePartitions(a); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan-a", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := getCondition(&result.Status, stanv1alpha1.ClusterPartitionsOverlap)
+	if cond == nil || cond.Status != k8scorev1.ConditionTrue {
+		t.Fatalf("Expected partitions overlap condition, got: %+v", result.Status.Conditions)
+	}
+	if !strings.Contains(cond.Message, "orders.* (orders.eu in stan-b)") {
+		t.Errorf("Unexpected condition message: %s", cond.Message)
+	}
+}
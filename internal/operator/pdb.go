@@ -0,0 +1,131 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8spolicyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// quorumSize is the number of nodes needed for a Raft cluster
+// of the given size to be able to elect a leader.
+func quorumSize(size int32) int32 {
+	return size/2 + 1
+}
+
+func pdbEnabled(o *stanv1alpha1.NatsStreamingCluster) bool {
+	if cfg := o.Spec.PodDisruptionBudget; cfg != nil && cfg.Enabled != nil {
+		return *cfg.Enabled
+	}
+	return keepsQuorumOnEviction(o) || o.Spec.PodDisruptionBudget != nil
+}
+
+// keepsQuorumOnEviction returns whether any node of a clustered
+// cluster can be evicted while keeping quorum, which is not the case
+// with fewer than 3 nodes.  A budget that allows no eviction at all
+// would block the drains of the nodes forever.
+func keepsQuorumOnEviction(o *stanv1alpha1.NatsStreamingCluster) bool {
+	return isClustered(o) && o.Spec.Size-quorumSize(o.Spec.Size) > 0
+}
+
+func newStanPodDisruptionBudget(o *stanv1alpha1.NatsStreamingCluster) *k8spolicyv1beta1.PodDisruptionBudget {
+	pdb := &k8spolicyv1beta1.PodDisruptionBudget{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:            o.Name,
+			Namespace:       o.Namespace,
+			Labels:          clusterLabels(o.Name),
+			OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+		},
+		Spec: k8spolicyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &k8smetav1.LabelSelector{
+				MatchLabels: clusterLabels(o.Name),
+			},
+		},
+	}
+
+	cfg := o.Spec.PodDisruptionBudget
+	switch {
+	case cfg != nil && cfg.MinAvailable != nil:
+		minAvailable := *cfg.MinAvailable
+		pdb.Spec.MinAvailable = &minAvailable
+	case cfg != nil && cfg.MaxUnavailable != nil:
+		maxUnavailable := *cfg.MaxUnavailable
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	case keepsQuorumOnEviction(o):
+		// As many nodes as possible while keeping quorum.
+		maxUnavailable := k8sintstr.FromInt(int(o.Spec.Size - quorumSize(o.Spec.Size)))
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	default:
+		maxUnavailable := k8sintstr.FromInt(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return pdb
+}
+
+// reconcilePodDisruptionBudget keeps the PodDisruptionBudget of
+// the cluster in sync with its size.
+func (c *Controller) reconcilePodDisruptionBudget(o *stanv1alpha1.NatsStreamingCluster) error {
+	pdbs := c.kc.PolicyV1beta1().PodDisruptionBudgets(o.Namespace)
+	current, err := pdbs.Get(o.Name, k8smetav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if !pdbEnabled(o) {
+		if !exists || !k8smetav1.IsControlledBy(current, o) {
+			return nil
+		}
+		log.Infof("Removing pod disruption budget '%s/%s'", o.Namespace, o.Name)
+		err := pdbs.Delete(o.Name, &k8smetav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	desired := newStanPodDisruptionBudget(o)
+	if exists {
+		if reflect.DeepEqual(current.Spec.MinAvailable, desired.Spec.MinAvailable) &&
+			reflect.DeepEqual(current.Spec.MaxUnavailable, desired.Spec.MaxUnavailable) {
+			return nil
+		}
+
+		// The spec of a PodDisruptionBudget cannot be updated
+		// in the policy/v1beta1 API, so it has to be replaced.
+		log.Infof("Replacing pod disruption budget '%s/%s'", o.Namespace, o.Name)
+		err := pdbs.Delete(o.Name, &k8smetav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		log.Infof("Creating pod disruption budget '%s/%s'", o.Namespace, o.Name)
+	}
+
+	_, err = pdbs.Create(desired)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
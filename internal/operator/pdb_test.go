@@ -0,0 +1,89 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcilePodDisruptionBudget(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	c := newTestController([]k8sruntime.Object{o})
+
+	if err := c.reconcilePodDisruptionBudget(o); err != nil {
+		t.Fatal(err)
+	}
+	pdb, err := c.kc.PolicyV1beta1().PodDisruptionBudgets("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("Expected max unavailable of 1 for 3 nodes, got: %v", pdb.Spec.MaxUnavailable)
+	}
+
+	o.Spec.Size = 5
+	if err := c.reconcilePodDisruptionBudget(o); err != nil {
+		t.Fatal(err)
+	}
+	pdb, err = c.kc.PolicyV1beta1().PodDisruptionBudgets("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 2 {
+		t.Errorf("Expected max unavailable of 2 for 5 nodes, got: %v", pdb.Spec.MaxUnavailable)
+	}
+
+	// No node of a clustered cluster of 1 or 2 nodes can be evicted
+	// while keeping quorum, so no budget blocks the drains forever.
+	for _, size := range []int32{2, 1} {
+		o.Spec.Size = size
+		o.Spec.Config = &stanv1alpha1.ServerConfig{Clustered: true}
+		if err := c.reconcilePodDisruptionBudget(o); err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.kc.PolicyV1beta1().PodDisruptionBudgets("default").Get("stan", k8smetav1.GetOptions{})
+		if err == nil {
+			t.Errorf("Expected no pod disruption budget for %d clustered nodes", size)
+		}
+	}
+
+	// An explicit budget allows evicting a node.
+	o.Spec.Size = 2
+	o.Spec.PodDisruptionBudget = &stanv1alpha1.PodDisruptionBudgetConfig{}
+	if err := c.reconcilePodDisruptionBudget(o); err != nil {
+		t.Fatal(err)
+	}
+	pdb, err = c.kc.PolicyV1beta1().PodDisruptionBudgets("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("Expected max unavailable of 1 for 2 nodes, got: %v", pdb.Spec.MaxUnavailable)
+	}
+
+	o.Spec.Size = 1
+	o.Spec.Config = nil
+	o.Spec.PodDisruptionBudget = nil
+	if err := c.reconcilePodDisruptionBudget(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.kc.PolicyV1beta1().PodDisruptionBudgets("default").Get("stan", k8smetav1.GetOptions{})
+	if err == nil {
+		t.Errorf("Expected pod disruption budget to be removed for a single node")
+	}
+}
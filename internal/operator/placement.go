@@ -0,0 +1,92 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// hostnameTopologyKey is the label with the name of a node.
+	hostnameTopologyKey = "kubernetes.io/hostname"
+
+	// zoneTopologyKey is the label with the zone of a node.
+	zoneTopologyKey = "failure-domain.beta.kubernetes.io/zone"
+)
+
+func placementPreset(o *stanv1alpha1.NatsStreamingCluster) stanv1alpha1.PlacementPreset {
+	if o.Spec.Placement == nil || o.Spec.Placement.Preset == "" {
+		return stanv1alpha1.PlacementPreferredNode
+	}
+	return o.Spec.Placement.Preset
+}
+
+// stanPodAntiAffinity returns the anti-affinity that spreads
+// the nodes of the cluster according to the placement preset.
+//
+// The topologySpreadConstraints of the pods are not available in
+// the version of the Kubernetes API in use, so spreading across
+// zones is done with a preferred anti-affinity instead.
+func stanPodAntiAffinity(o *stanv1alpha1.NatsStreamingCluster) *k8scorev1.PodAntiAffinity {
+	term := func(topologyKey string) k8scorev1.PodAffinityTerm {
+		return k8scorev1.PodAffinityTerm{
+			LabelSelector: &k8smetav1.LabelSelector{
+				MatchLabels: clusterLabels(o.Name),
+			},
+			TopologyKey: topologyKey,
+		}
+	}
+
+	switch placementPreset(o) {
+	case stanv1alpha1.PlacementPreferredNode:
+		return &k8scorev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []k8scorev1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term(hostnameTopologyKey)},
+			},
+		}
+	case stanv1alpha1.PlacementRequiredNode:
+		return &k8scorev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []k8scorev1.PodAffinityTerm{
+				term(hostnameTopologyKey),
+			},
+		}
+	case stanv1alpha1.PlacementZoneSpread:
+		return &k8scorev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []k8scorev1.PodAffinityTerm{
+				term(hostnameTopologyKey),
+			},
+			PreferredDuringSchedulingIgnoredDuringExecution: []k8scorev1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term(zoneTopologyKey)},
+			},
+		}
+	}
+	return nil
+}
+
+// applyPlacement merges the anti-affinity of the placement preset
+// into the pod, unless the template already defines one.
+func applyPlacement(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) {
+	antiAffinity := stanPodAntiAffinity(o)
+	if antiAffinity == nil {
+		return
+	}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &k8scorev1.Affinity{}
+	}
+	if pod.Spec.Affinity.PodAntiAffinity == nil {
+		pod.Spec.Affinity.PodAntiAffinity = antiAffinity
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func TestPlacementPresets(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+
+	pod := newStanPod(o)
+	aa := pod.Spec.Affinity.PodAntiAffinity
+	if len(aa.PreferredDuringSchedulingIgnoredDuringExecution) != 1 || aa.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		t.Errorf("Expected preferred node anti-affinity by default, got: %+v", aa)
+	}
+
+	o.Spec.Placement = &stanv1alpha1.PlacementConfig{Preset: stanv1alpha1.PlacementZoneSpread}
+	pod = newStanPod(o)
+	aa = pod.Spec.Affinity.PodAntiAffinity
+	if len(aa.RequiredDuringSchedulingIgnoredDuringExecution) != 1 || aa.RequiredDuringSchedulingIgnoredDuringExecution[0].TopologyKey != hostnameTopologyKey {
+		t.Errorf("Expected required node anti-affinity, got: %+v", aa)
+	}
+	if len(aa.PreferredDuringSchedulingIgnoredDuringExecution) != 1 || aa.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey != zoneTopologyKey {
+		t.Errorf("Expected preferred zone anti-affinity, got: %+v", aa)
+	}
+	if aa.RequiredDuringSchedulingIgnoredDuringExecution[0].LabelSelector.MatchLabels["stan_cluster"] != "stan" {
+		t.Errorf("Expected anti-affinity keyed on the cluster label")
+	}
+
+	o.Spec.Placement = &stanv1alpha1.PlacementConfig{Preset: stanv1alpha1.PlacementNone}
+	if pod = newStanPod(o); pod.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity, got: %+v", pod.Spec.Affinity)
+	}
+
+	// Explicit anti-affinity in the template takes precedence,
+	// and the template itself is left untouched.
+	o.Spec.Placement = nil
+	o.Spec.PodTemplate = &k8scorev1.PodTemplateSpec{
+		Spec: k8scorev1.PodSpec{
+			Affinity: &k8scorev1.Affinity{
+				NodeAffinity: &k8scorev1.NodeAffinity{},
+			},
+		},
+	}
+	pod = newStanPod(o)
+	if pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		t.Errorf("Expected anti-affinity to be merged with the template, got: %+v", pod.Spec.Affinity)
+	}
+	if o.Spec.PodTemplate.Spec.Affinity.PodAntiAffinity != nil {
+		t.Errorf("Expected template not to be modified")
+	}
+	o.Spec.PodTemplate.Spec.Affinity.PodAntiAffinity = &k8scorev1.PodAntiAffinity{}
+	pod = newStanPod(o)
+	if pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution != nil {
+		t.Errorf("Expected explicit anti-affinity to be kept, got: %+v", pod.Spec.Affinity.PodAntiAffinity)
+	}
+}
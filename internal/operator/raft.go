@@ -0,0 +1,451 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// rejoinContainerName is the name of the init container that wipes
+// the store of a node rejoining its Raft group.
+const rejoinContainerName = "stan-rejoin"
+
+func raftMaxLag(o *stanv1alpha1.NatsStreamingCluster) int64 {
+	if rh := o.Spec.RaftHealth; rh != nil && rh.MaxLag > 0 {
+		return rh.MaxLag
+	}
+	return DefaultRaftMaxLag
+}
+
+func raftHealthGracePeriod(o *stanv1alpha1.NatsStreamingCluster) time.Duration {
+	if rh := o.Spec.RaftHealth; rh != nil && rh.GracePeriod != "" {
+		if d, err := time.ParseDuration(rh.GracePeriod); err == nil {
+			return d
+		}
+	}
+	return DefaultRaftHealthGracePeriod
+}
+
+// raftNode is a node of a Raft group with its state as last scraped
+// from its monitoring endpoint, which is nil when it could not be
+// reached.
+type raftNode struct {
+	pod   *k8scorev1.Pod
+	stats *stanv1alpha1.NodeStats
+}
+
+func (n raftNode) joined() bool {
+	return n.stats != nil && (n.stats.Role == serverRoleLeader || n.stats.Role == serverRoleFollower)
+}
+
+func (n raftNode) isLeader() bool {
+	return n.stats != nil && n.stats.Role == serverRoleLeader
+}
+
+// recentStats returns the stats last scraped from the nodes of a
+// cluster, unless they are too old to tell the state of the nodes.
+func (c *Controller) recentStats(o *stanv1alpha1.NatsStreamingCluster) *stanv1alpha1.ClusterStats {
+	stats := o.Status.Stats
+	if stats == nil || stats.LastScrapeTime == nil || time.Since(stats.LastScrapeTime.Time) > 3*c.scrapeInterval() {
+		return nil
+	}
+	return stats
+}
+
+// raftNodes returns the state of the nodes whose pod is running as
+// last scraped, ordered by their ordinal.  The monitoring endpoints
+// are only requested by the scraper, so that nodes that cannot be
+// reached do not hold back the reconciliation of every cluster.
+// Pods created since the last scrape are left out until they are
+// scraped, rather than taking the state of the pod they replaced.
+func raftNodes(o *stanv1alpha1.NatsStreamingCluster, pods []*k8scorev1.Pod, stats *stanv1alpha1.ClusterStats) []raftNode {
+	var nodes []raftNode
+	if stats == nil || stats.LastScrapeTime == nil {
+		return nil
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != k8scorev1.PodRunning || stats.LastScrapeTime.Before(&pod.CreationTimestamp) {
+			continue
+		}
+		for i := range stats.Nodes {
+			if stats.Nodes[i].Name != pod.Name {
+				continue
+			}
+			node := raftNode{pod: pod}
+			if stats.Nodes[i].State != "" {
+				node.stats = &stats.Nodes[i]
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return podOrdinal(o, nodes[i].pod) < podOrdinal(o, nodes[j].pod)
+	})
+	return nodes
+}
+
+// raftPeers returns the known voters of the Raft group with the nodes
+// that now report being members of it.  Nodes are only dropped once
+// their removal was confirmed by the leader, since the group keeps
+// every voter it had, even once its pod is deleted.
+func raftPeers(known []string, nodes []raftNode) []string {
+	peers := append([]string{}, known...)
+	for _, node := range nodes {
+		if node.joined() && !containsString(peers, node.pod.Name) {
+			peers = append(peers, node.pod.Name)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// unhealthySince returns since when a node has been unhealthy for
+// the same reason, now if it was not before.
+func unhealthySince(previous *stanv1alpha1.RaftHealthStatus, name string, reason stanv1alpha1.NodeHealthReason, now k8smetav1.Time) k8smetav1.Time {
+	if previous == nil {
+		return now
+	}
+	for _, node := range previous.UnhealthyNodes {
+		if node.Name == name && node.Reason == reason {
+			return node.Since
+		}
+	}
+	return now
+}
+
+// raftHealth compares the state of the nodes of the Raft group.  It
+// returns the health of the group and the leader to keep, which in
+// case of a split is the one with the most messages.
+func raftHealth(
+	o *stanv1alpha1.NatsStreamingCluster,
+	nodes []raftNode,
+	previous *stanv1alpha1.RaftHealthStatus,
+	now k8smetav1.Time,
+) (*stanv1alpha1.RaftHealthStatus, *raftNode) {
+	health := &stanv1alpha1.RaftHealthStatus{}
+	var leader *raftNode
+	for i, node := range nodes {
+		if !node.isLeader() {
+			continue
+		}
+		health.Leaders = append(health.Leaders, node.pod.Name)
+		if leader == nil || node.stats.Messages > leader.stats.Messages {
+			leader = &nodes[i]
+		}
+	}
+
+	unhealthy := func(node raftNode, reason stanv1alpha1.NodeHealthReason, lag int64) {
+		health.UnhealthyNodes = append(health.UnhealthyNodes, stanv1alpha1.UnhealthyNode{
+			Name:   node.pod.Name,
+			Reason: reason,
+			Lag:    lag,
+			Since:  unhealthySince(previous, node.pod.Name, reason, now),
+		})
+	}
+	maxLag := raftMaxLag(o)
+	for _, node := range nodes {
+		switch {
+		case node.stats == nil:
+			unhealthy(node, stanv1alpha1.NodeUnreachable, 0)
+		case node.stats.Role == serverRoleCandidate:
+			unhealthy(node, stanv1alpha1.NodeCandidate, 0)
+		case !node.joined():
+			unhealthy(node, stanv1alpha1.NodeNotJoined, 0)
+		case node.isLeader() && node.pod.Name != leader.pod.Name:
+			unhealthy(node, stanv1alpha1.NodeSplitLeader, 0)
+		case node.stats.Role == serverRoleFollower && len(health.Leaders) == 1:
+			lag := leader.stats.Messages - node.stats.Messages
+			if lag > maxLag {
+				unhealthy(node, stanv1alpha1.NodeLagging, lag)
+			}
+		}
+	}
+	return health, leader
+}
+
+// degradedCondition returns the Degraded condition for the health
+// of a Raft group with the given number of running nodes.
+func degradedCondition(health *stanv1alpha1.RaftHealthStatus, running int) (k8scorev1.ConditionStatus, string, string) {
+	switch {
+	case len(health.Leaders) == 0 && running > 0:
+		return k8scorev1.ConditionTrue, "NoLeader", "No node is the leader of the Raft group"
+	case len(health.Leaders) > 1:
+		return k8scorev1.ConditionTrue, "MultipleLeaders",
+			fmt.Sprintf("Nodes %s all claim to be the leader of the Raft group", strings.Join(health.Leaders, ", "))
+	case len(health.UnhealthyNodes) > 0:
+		var reason string
+		var problems []string
+		for _, node := range health.UnhealthyNodes {
+			switch node.Reason {
+			case stanv1alpha1.NodeNotJoined:
+				problems = append(problems, fmt.Sprintf("%s has not joined the Raft group", node.Name))
+				if reason == "" {
+					reason = "NodeNotJoined"
+				}
+			case stanv1alpha1.NodeUnreachable:
+				problems = append(problems, fmt.Sprintf("%s cannot be reached", node.Name))
+				if reason == "" {
+					reason = "NodeUnreachable"
+				}
+			case stanv1alpha1.NodeCandidate:
+				problems = append(problems, fmt.Sprintf("%s is a candidate of the Raft group", node.Name))
+				if reason == "" {
+					reason = "NodeCandidate"
+				}
+			case stanv1alpha1.NodeLagging:
+				problems = append(problems, fmt.Sprintf("%s is %d messages behind the leader", node.Name, node.Lag))
+				if reason == "" {
+					reason = "LaggingFollower"
+				}
+			}
+		}
+		return k8scorev1.ConditionTrue, reason, strings.Join(problems, ", ")
+	}
+	return k8scorev1.ConditionFalse, "Healthy", ""
+}
+
+func isRejoining(health *stanv1alpha1.RaftHealthStatus, name string) bool {
+	if health == nil {
+		return false
+	}
+	for _, node := range health.Rejoining {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rejoiningNodes returns the nodes that are still to be recreated
+// to rejoin their Raft group.
+func (c *Controller) rejoiningNodes(o *stanv1alpha1.NatsStreamingCluster) ([]stanv1alpha1.RejoiningNode, error) {
+	if o.Status.RaftHealth == nil || len(o.Status.RaftHealth.Rejoining) == 0 {
+		return nil, nil
+	}
+	pods, err := c.findPods(o.Name, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var rejoining []stanv1alpha1.RejoiningNode
+	for _, node := range o.Status.RaftHealth.Rejoining {
+		recreated := false
+		for _, pod := range pods.Items {
+			if pod.Name == node.Name && pod.DeletionTimestamp == nil && string(pod.UID) != node.PodUID {
+				recreated = true
+			}
+		}
+		if recreated {
+			log.Infof("Pod '%s/%s' has been recreated to rejoin the Raft group", o.Namespace, node.Name)
+			continue
+		}
+		rejoining = append(rejoining, node)
+	}
+	return rejoining, nil
+}
+
+// reconcileRaftHealth compares the state of the nodes of a clustered
+// cluster and sets the Degraded condition when the Raft group has no
+// leader, more than one, or nodes that have not joined it or lag
+// behind.  The state is the one last scraped, the health is kept as
+// it was while there are no recent stats.  Remediation is only done
+// when enabled in the spec.
+func (c *Controller) reconcileRaftHealth(o *stanv1alpha1.NatsStreamingCluster) error {
+	if !isClustered(o) {
+		cond := getCondition(&o.Status, stanv1alpha1.ClusterDegraded)
+		if o.Status.RaftHealth == nil && len(o.Status.RaftPeers) == 0 && (cond == nil || cond.Status == k8scorev1.ConditionFalse) {
+			return nil
+		}
+		return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.RaftHealth = nil
+			status.RaftPeers = nil
+			setCondition(status, stanv1alpha1.ClusterDegraded, k8scorev1.ConditionFalse, "NotClustered", "")
+		})
+	}
+
+	stats := c.recentStats(o)
+	if stats == nil {
+		log.Debugf("Not checking the Raft group of '%s/%s' cluster without recent stats", o.Namespace, o.Name)
+		return nil
+	}
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return err
+	}
+	nodes := raftNodes(o, pods, stats)
+	health, leader := raftHealth(o, nodes, o.Status.RaftHealth, k8smetav1.Now())
+	health.Rejoining, err = c.rejoiningNodes(o)
+	if err != nil {
+		return err
+	}
+	cstatus, reason, message := degradedCondition(health, len(nodes))
+
+	cond := getCondition(&o.Status, stanv1alpha1.ClusterDegraded)
+	changed := cond == nil || cond.Status != cstatus || cond.Reason != reason || cond.Message != message
+	if changed && cstatus == k8scorev1.ConditionTrue {
+		log.Warnf("Raft group of '%s/%s' cluster is degraded: %s", o.Namespace, o.Name, message)
+	} else if changed && cond != nil && cond.Status == k8scorev1.ConditionTrue {
+		log.Infof("Raft group of '%s/%s' cluster is healthy again", o.Namespace, o.Name)
+	}
+	peers := raftPeers(o.Status.RaftPeers, nodes)
+	if changed || !reflect.DeepEqual(o.Status.RaftHealth, health) || !reflect.DeepEqual(o.Status.RaftPeers, peers) {
+		err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.RaftHealth = health.DeepCopy()
+			status.RaftPeers = raftPeers(status.RaftPeers, nodes)
+			setCondition(status, stanv1alpha1.ClusterDegraded, cstatus, reason, message)
+		})
+		if err != nil {
+			return err
+		}
+		o.Status.RaftHealth = health
+		o.Status.RaftPeers = peers
+	}
+	return c.remediateRaftHealth(o, nodes, leader)
+}
+
+// remediateRaftHealth restarts or wipes a single unhealthy node once
+// it has been unhealthy for longer than the grace period, as long as
+// there is a leader to catch up from and the other nodes still form
+// a quorum.  Only the nodes that answered with a state outside of
+// the group are wiped, the ones that could not be reached or are
+// still candidates are restarted.
+func (c *Controller) remediateRaftHealth(o *stanv1alpha1.NatsStreamingCluster, nodes []raftNode, leader *raftNode) error {
+	rh := o.Spec.RaftHealth
+	health := o.Status.RaftHealth
+	if rh == nil || (!rh.RestartLaggingFollowers && !rh.RejoinNodes) {
+		return nil
+	}
+	if leader == nil || len(health.Rejoining) > 0 {
+		return nil
+	}
+	var healthy int32
+	for _, node := range nodes {
+		if podIsReady(node.pod) && node.joined() && !isUnhealthy(health, node.pod.Name) {
+			healthy++
+		}
+	}
+	if healthy < quorumSize(o.Spec.Size) {
+		log.Warnf("Not remediating '%s/%s' cluster, only %d of %d nodes are healthy", o.Namespace, o.Name, healthy, o.Spec.Size)
+		return nil
+	}
+
+	grace := raftHealthGracePeriod(o)
+	for _, unhealthy := range health.UnhealthyNodes {
+		if time.Since(unhealthy.Since.Time) < grace {
+			continue
+		}
+		var pod *k8scorev1.Pod
+		for _, node := range nodes {
+			if node.pod.Name == unhealthy.Name {
+				pod = node.pod
+			}
+		}
+		if pod == nil {
+			continue
+		}
+		switch {
+		case unhealthy.Reason == stanv1alpha1.NodeLagging && rh.RestartLaggingFollowers:
+			log.Infof("Restarting pod '%s/%s' lagging %d messages behind the leader since %s",
+				pod.Namespace, pod.Name, unhealthy.Lag, unhealthy.Since.Format(time.RFC3339))
+		case (unhealthy.Reason == stanv1alpha1.NodeUnreachable || unhealthy.Reason == stanv1alpha1.NodeCandidate) && rh.RejoinNodes:
+			log.Infof("Restarting pod '%s/%s', %s since %s",
+				pod.Namespace, pod.Name, unhealthy.Reason, unhealthy.Since.Format(time.RFC3339))
+		case (unhealthy.Reason == stanv1alpha1.NodeNotJoined || unhealthy.Reason == stanv1alpha1.NodeSplitLeader) && rh.RejoinNodes:
+			log.Infof("Wiping pod '%s/%s' to rejoin the Raft group led by %s, %s since %s",
+				pod.Namespace, pod.Name, leader.pod.Name, unhealthy.Reason, unhealthy.Since.Format(time.RFC3339))
+			// The node is recorded first, so that it is recreated
+			// with the init container that wipes its store.
+			node := stanv1alpha1.RejoiningNode{Name: pod.Name, PodUID: string(pod.UID)}
+			err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+				if status.RaftHealth == nil {
+					status.RaftHealth = &stanv1alpha1.RaftHealthStatus{}
+				}
+				status.RaftHealth.Rejoining = append(status.RaftHealth.Rejoining, node)
+			})
+			if err != nil {
+				return err
+			}
+			o.Status.RaftHealth.Rejoining = append(o.Status.RaftHealth.Rejoining, node)
+		default:
+			continue
+		}
+		return c.kc.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &k8smetav1.DeleteOptions{})
+	}
+	return nil
+}
+
+func isUnhealthy(health *stanv1alpha1.RaftHealthStatus, name string) bool {
+	if health == nil {
+		return false
+	}
+	for _, node := range health.UnhealthyNodes {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rejoinScript wipes the store and Raft log of a node.  Init
+// containers run again when the pod is restarted, so it is only
+// done once for each pod.
+func rejoinScript(storeDir, node string, paths []string) string {
+	marker := shellQuote(path.Join(storeDir, fmt.Sprintf(".%s-rejoin", node)))
+	var dirs []string
+	for _, p := range paths {
+		dirs = append(dirs, path.Join(storeDir, p))
+	}
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf(`if [ "$(cat %s 2>/dev/null)" != "$POD_UID" ]; then`, marker),
+		fmt.Sprintf("  rm -rf %s", shellQuoteAll(dirs)),
+		fmt.Sprintf(`  echo "$POD_UID" > %s`, marker),
+		"fi",
+	}, "\n")
+}
+
+// applyRejoin adds the init container that wipes the store and Raft
+// log of a node rejoining its Raft group, so that it gets them from
+// the leader again.
+func applyRejoin(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) {
+	if !isRejoining(o.Status.RaftHealth, pod.Name) {
+		return
+	}
+	storeDir, paths, err := storePaths(o, pod.Name)
+	if err != nil {
+		return
+	}
+	_, mounts := storeVolumes(pod, storeDir)
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, k8scorev1.Container{
+		Name:    rejoinContainerName,
+		Image:   DefaultRejoinImage,
+		Command: []string{"/bin/sh", "-c", rejoinScript(storeDir, pod.Name, paths)},
+		Env: []k8scorev1.EnvVar{{
+			Name: "POD_UID",
+			ValueFrom: &k8scorev1.EnvVarSource{
+				FieldRef: &k8scorev1.ObjectFieldSelector{FieldPath: "metadata.uid"},
+			},
+		}},
+		VolumeMounts: mounts,
+	})
+}
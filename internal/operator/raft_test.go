@@ -0,0 +1,163 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestReconcileRaftHealth(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Spec.RaftHealth = &stanv1alpha1.RaftHealthConfig{RestartLaggingFollowers: true, RejoinNodes: true}
+	pods := newTestStorePods(o)
+	for i, pod := range pods {
+		pod.(*k8scorev1.Pod).UID = k8stypes.UID(fmt.Sprintf("uid-%d", i+1))
+	}
+	c := newTestController([]k8sruntime.Object{o}, pods...)
+	reconcile := func() *stanv1alpha1.NatsStreamingCluster {
+		t.Helper()
+		if err := c.scrapeCluster(o); err != nil {
+			t.Fatal(err)
+		}
+		scraped, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Status.Stats = scraped.Status.Stats
+		if err := c.reconcileRaftHealth(o); err != nil {
+			t.Fatal(err)
+		}
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		o = result
+		return result
+	}
+	expectDegraded := func(result *stanv1alpha1.NatsStreamingCluster, reason string) {
+		t.Helper()
+		cond := getCondition(&result.Status, stanv1alpha1.ClusterDegraded)
+		if cond == nil || cond.Reason != reason {
+			t.Fatalf("Expected Degraded condition with reason %s, got: %+v", reason, cond)
+		}
+	}
+	podExists := func(name string) bool {
+		_, err := c.kc.CoreV1().Pods("default").Get(name, k8smetav1.GetOptions{})
+		return err == nil
+	}
+
+	c.hc = fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower","total_msgs":5000}`,
+		"10.0.0.2:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader","total_msgs":5000}`,
+		"10.0.0.3:8222/streaming/serverz": `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower","total_msgs":4500}`,
+	}
+	result := reconcile()
+	if cond := getCondition(&result.Status, stanv1alpha1.ClusterDegraded); cond == nil || cond.Status != k8scorev1.ConditionFalse {
+		t.Errorf("Expected the cluster not to be degraded, got: %+v", cond)
+	}
+	if !reflect.DeepEqual(result.Status.RaftHealth.Leaders, []string{"stan-2"}) {
+		t.Errorf("Expected stan-2 to be the leader, got: %v", result.Status.RaftHealth.Leaders)
+	}
+	if !reflect.DeepEqual(result.Status.RaftPeers, []string{"stan-1", "stan-2", "stan-3"}) {
+		t.Errorf("Expected the members of the group to be recorded as voters, got: %v", result.Status.RaftPeers)
+	}
+
+	c.hc.(fakeHTTPClient)["10.0.0.1:8222/streaming/serverz"] = `{"cluster_id":"stan","state":"CLUSTERED","role":"Leader","total_msgs":4000}`
+	expectDegraded(reconcile(), "MultipleLeaders")
+
+	// Lagging followers are only restarted after the grace period.
+	c.hc.(fakeHTTPClient)["10.0.0.1:8222/streaming/serverz"] = `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower","total_msgs":5000}`
+	c.hc.(fakeHTTPClient)["10.0.0.3:8222/streaming/serverz"] = `{"cluster_id":"stan","state":"CLUSTERED","role":"Follower","total_msgs":2000}`
+	result = reconcile()
+	expectDegraded(result, "LaggingFollower")
+	unhealthy := result.Status.RaftHealth.UnhealthyNodes
+	if len(unhealthy) != 1 || unhealthy[0].Name != "stan-3" || unhealthy[0].Reason != stanv1alpha1.NodeLagging || unhealthy[0].Lag != 3000 {
+		t.Fatalf("Expected stan-3 to be lagging 3000 messages, got: %+v", unhealthy)
+	}
+	if !podExists("stan-3") {
+		t.Fatalf("Expected stan-3 not to be restarted within the grace period")
+	}
+	o.Status.RaftHealth.UnhealthyNodes[0].Since = k8smetav1.NewTime(time.Now().Add(-10 * time.Minute))
+	reconcile()
+	if podExists("stan-3") {
+		t.Fatalf("Expected lagging stan-3 to be restarted")
+	}
+
+	// A node that cannot be reached or is a candidate is only
+	// restarted, since its state is not known to be lost.
+	if _, err := c.kc.CoreV1().Pods("default").Create(pods[2].(*k8scorev1.Pod)); err != nil {
+		t.Fatal(err)
+	}
+	c.hc.(fakeHTTPClient)["10.0.0.3:8222/streaming/serverz"] = `{"cluster_id":"stan","state":"CLUSTERED","role":"Candidate"}`
+	expectDegraded(reconcile(), "NodeCandidate")
+	delete(c.hc.(fakeHTTPClient), "10.0.0.3:8222/streaming/serverz")
+	result = reconcile()
+	expectDegraded(result, "NodeUnreachable")
+	o.Status.RaftHealth.UnhealthyNodes[0].Since = k8smetav1.NewTime(time.Now().Add(-10 * time.Minute))
+	result = reconcile()
+	if len(result.Status.RaftHealth.Rejoining) != 0 {
+		t.Fatalf("Expected unreachable stan-3 not to be wiped, got: %+v", result.Status.RaftHealth.Rejoining)
+	}
+	if podExists("stan-3") {
+		t.Fatalf("Expected unreachable stan-3 to be restarted")
+	}
+
+	// A node that reports that it has not joined the group is
+	// wiped and recreated.
+	if _, err := c.kc.CoreV1().Pods("default").Create(pods[2].(*k8scorev1.Pod)); err != nil {
+		t.Fatal(err)
+	}
+	c.hc.(fakeHTTPClient)["10.0.0.3:8222/streaming/serverz"] = `{"cluster_id":"stan","state":"CLUSTERED","role":""}`
+	result = reconcile()
+	expectDegraded(result, "NodeNotJoined")
+	o.Status.RaftHealth.UnhealthyNodes[0].Since = k8smetav1.NewTime(time.Now().Add(-10 * time.Minute))
+	result = reconcile()
+	expected := []stanv1alpha1.RejoiningNode{{Name: "stan-3", PodUID: "uid-3"}}
+	if !reflect.DeepEqual(result.Status.RaftHealth.Rejoining, expected) {
+		t.Fatalf("Expected %+v to be rejoining, got: %+v", expected, result.Status.RaftHealth.Rejoining)
+	}
+	if podExists("stan-3") {
+		t.Fatalf("Expected stan-3 to be deleted to rejoin the group")
+	}
+	if err := c.createMissingPods(o, 1); err != nil {
+		t.Fatal(err)
+	}
+	pod, err := c.kc.CoreV1().Pods("default").Get("stan-3", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.Spec.InitContainers) != 1 || pod.Spec.InitContainers[0].Name != rejoinContainerName || pod.Spec.InitContainers[0].Image != DefaultRejoinImage {
+		t.Fatalf("Expected stan-3 to be recreated with the rejoin init container, got: %+v", pod.Spec.InitContainers)
+	}
+	script := pod.Spec.InitContainers[0].Command[2]
+	if !strings.Contains(script, "rm -rf '/pv/stan/stan-3' '/pv/stan/raft/stan-3'") {
+		t.Errorf("Expected the store of stan-3 to be wiped, got: %s", script)
+	}
+	if pod.Annotations[PodSpecHashAnnotation] != newStanNodePod(newTestStoreCluster("stan", 3), "stan-3").Annotations[PodSpecHashAnnotation] {
+		t.Errorf("Expected the rejoin init container not to change the spec hash")
+	}
+	if result := reconcile(); len(result.Status.RaftHealth.Rejoining) != 0 {
+		t.Errorf("Expected stan-3 to have rejoined, got: %+v", result.Status.RaftHealth.Rejoining)
+	}
+}
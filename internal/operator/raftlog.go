@@ -0,0 +1,468 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Raft log of a node is the BoltDB file of raft-boltdb, with the
+// entries in the "logs" bucket keyed by their big endian index and
+// encoded with msgpack.  Only what is needed to read the last entry
+// of a consistent file is implemented, the file is never written.
+const (
+	boltMagic          = 0xED0CDAED
+	boltPageHeaderSize = 16
+	boltElementSize    = 16
+	boltMetaSize       = 64
+	boltBranchPage     = 0x01
+	boltLeafPage       = 0x02
+	boltBucketLeaf     = 0x01
+	boltMaxDepth       = 64
+)
+
+var raftLogsBucket = []byte("logs")
+
+// lastRaftLogEntry returns the term and index of the last entry of
+// the Raft log at the path, zero for an empty log.
+func lastRaftLogEntry(name string) (term, index uint64, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	db := &boltReader{r: f}
+	root, err := db.rootBucket()
+	if err != nil {
+		return 0, 0, err
+	}
+	var logs []byte
+	for _, elem := range root.elements {
+		if elem.flags&boltBucketLeaf != 0 && bytes.Equal(elem.key, raftLogsBucket) {
+			logs = elem.value
+		}
+	}
+	if logs == nil {
+		return 0, 0, nil
+	}
+	key, value, err := db.lastInBucket(logs)
+	if err != nil || key == nil {
+		return 0, 0, err
+	}
+	if len(key) != 8 {
+		return 0, 0, fmt.Errorf("invalid key %x of the last log entry", key)
+	}
+	index = binary.BigEndian.Uint64(key)
+	term, err = raftLogTerm(value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid log entry at index %d: %v", index, err)
+	}
+	return term, index, nil
+}
+
+type boltReader struct {
+	r        io.ReaderAt
+	pageSize uint32
+	root     uint64
+}
+
+type boltElement struct {
+	flags uint32
+	key   []byte
+	value []byte
+	child uint64
+}
+
+type boltPage struct {
+	branch   bool
+	elements []boltElement
+}
+
+// rootBucket reads the meta pages, using the one of the latest
+// transaction with a valid checksum, and returns the leaves of the
+// root bucket with the buckets of the file.
+func (db *boltReader) rootBucket() (*boltPage, error) {
+	var best []byte
+	for i := 0; i < 2; i++ {
+		offset := int64(0)
+		if i == 1 {
+			if db.pageSize == 0 {
+				break
+			}
+			offset = int64(db.pageSize)
+		}
+		buf := make([]byte, boltPageHeaderSize+boltMetaSize)
+		if _, err := db.r.ReadAt(buf, offset); err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("cannot read the meta page: %v", err)
+			}
+			break
+		}
+		meta := buf[boltPageHeaderSize:]
+		if binary.LittleEndian.Uint32(meta[0:4]) != boltMagic {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write(meta[:56])
+		if h.Sum64() != binary.LittleEndian.Uint64(meta[56:64]) {
+			continue
+		}
+		if db.pageSize == 0 {
+			db.pageSize = binary.LittleEndian.Uint32(meta[8:12])
+		}
+		if best == nil || binary.LittleEndian.Uint64(meta[48:56]) > binary.LittleEndian.Uint64(best[48:56]) {
+			best = meta
+		}
+	}
+	if best == nil || db.pageSize < boltPageHeaderSize+boltMetaSize {
+		return nil, errors.New("not a BoltDB file or no valid meta page")
+	}
+	db.root = binary.LittleEndian.Uint64(best[16:24])
+
+	var leaves []boltElement
+	err := db.walk(db.root, 0, func(p *boltPage) error {
+		leaves = append(leaves, p.elements...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltPage{elements: leaves}, nil
+}
+
+// walk calls the function with every leaf page of the tree, in order.
+func (db *boltReader) walk(id uint64, depth int, fn func(*boltPage) error) error {
+	if depth > boltMaxDepth {
+		return errors.New("the tree of pages is too deep")
+	}
+	p, err := db.page(id)
+	if err != nil {
+		return err
+	}
+	if !p.branch {
+		return fn(p)
+	}
+	for _, elem := range p.elements {
+		if err := db.walk(elem.child, depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastInBucket returns the last key and value of the bucket with the
+// given header, nil for an empty bucket.
+func (db *boltReader) lastInBucket(header []byte) ([]byte, []byte, error) {
+	if len(header) < 16 {
+		return nil, nil, errors.New("invalid bucket header")
+	}
+	var p *boltPage
+	var err error
+	if id := binary.LittleEndian.Uint64(header[0:8]); id == 0 {
+		// Small buckets are inlined after their header.
+		p, err = parseBoltPage(header[16:])
+	} else {
+		p, err = db.page(id)
+		for depth := 0; err == nil && p.branch; depth++ {
+			if depth > boltMaxDepth || len(p.elements) == 0 {
+				return nil, nil, errors.New("invalid branch page")
+			}
+			p, err = db.page(p.elements[len(p.elements)-1].child)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(p.elements) == 0 {
+		return nil, nil, nil
+	}
+	last := p.elements[len(p.elements)-1]
+	return last.key, last.value, nil
+}
+
+// page reads the page with the id and its overflow pages.
+func (db *boltReader) page(id uint64) (*boltPage, error) {
+	if id < 2 {
+		return nil, fmt.Errorf("invalid page %d", id)
+	}
+	header := make([]byte, boltPageHeaderSize)
+	offset := int64(id) * int64(db.pageSize)
+	if _, err := db.r.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("cannot read page %d: %v", id, err)
+	}
+	overflow := binary.LittleEndian.Uint32(header[12:16])
+	buf := make([]byte, (int64(overflow)+1)*int64(db.pageSize))
+	if _, err := db.r.ReadAt(buf, offset); err != nil {
+		return nil, fmt.Errorf("cannot read page %d: %v", id, err)
+	}
+	return parseBoltPage(buf)
+}
+
+func parseBoltPage(buf []byte) (*boltPage, error) {
+	if len(buf) < boltPageHeaderSize {
+		return nil, errors.New("truncated page")
+	}
+	flags := binary.LittleEndian.Uint16(buf[8:10])
+	count := int(binary.LittleEndian.Uint16(buf[10:12]))
+	p := &boltPage{branch: flags&boltBranchPage != 0}
+	if !p.branch && flags&boltLeafPage == 0 {
+		return nil, fmt.Errorf("unexpected page with flags %#x", flags)
+	}
+	for i := 0; i < count; i++ {
+		at := boltPageHeaderSize + i*boltElementSize
+		if at+boltElementSize > len(buf) {
+			return nil, errors.New("truncated page")
+		}
+		elem := buf[at : at+boltElementSize]
+		var e boltElement
+		var pos, ksize, vsize int
+		if p.branch {
+			pos = int(binary.LittleEndian.Uint32(elem[0:4]))
+			ksize = int(binary.LittleEndian.Uint32(elem[4:8]))
+			e.child = binary.LittleEndian.Uint64(elem[8:16])
+		} else {
+			e.flags = binary.LittleEndian.Uint32(elem[0:4])
+			pos = int(binary.LittleEndian.Uint32(elem[4:8]))
+			ksize = int(binary.LittleEndian.Uint32(elem[8:12]))
+			vsize = int(binary.LittleEndian.Uint32(elem[12:16]))
+		}
+		start := at + pos
+		if pos < 0 || ksize < 0 || vsize < 0 || start+ksize+vsize > len(buf) {
+			return nil, errors.New("truncated page")
+		}
+		e.key = buf[start : start+ksize]
+		e.value = buf[start+ksize : start+ksize+vsize]
+		p.elements = append(p.elements, e)
+	}
+	return p, nil
+}
+
+// raftLogTerm returns the term of a log entry, a msgpack map of the
+// fields of the entry by name.
+func raftLogTerm(entry []byte) (uint64, error) {
+	d := &msgpackDecoder{buf: entry}
+	n, err := d.mapLen()
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < n; i++ {
+		key, err := d.str()
+		if err != nil {
+			return 0, err
+		}
+		if key == "Term" {
+			return d.uint()
+		}
+		if err := d.skip(); err != nil {
+			return 0, err
+		}
+	}
+	return 0, errors.New("no term")
+}
+
+// msgpackDecoder decodes the few msgpack types found in the log
+// entries before their term.
+type msgpackDecoder struct {
+	buf []byte
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *msgpackDecoder) length(size int) (int, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *msgpackDecoder) mapLen() (int, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b[0]&0xf0 == 0x80:
+		return int(b[0] & 0x0f), nil
+	case b[0] == 0xde:
+		return d.length(2)
+	case b[0] == 0xdf:
+		return d.length(4)
+	}
+	return 0, fmt.Errorf("unexpected msgpack type %#x instead of a map", b[0])
+}
+
+// str decodes a string, or raw bytes as the older encoders write them.
+func (d *msgpackDecoder) str() (string, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case b[0]&0xe0 == 0xa0:
+		n = int(b[0] & 0x1f)
+	case b[0] == 0xd9, b[0] == 0xc4:
+		n, err = d.length(1)
+	case b[0] == 0xda, b[0] == 0xc5:
+		n, err = d.length(2)
+	case b[0] == 0xdb, b[0] == 0xc6:
+		n, err = d.length(4)
+	default:
+		return "", fmt.Errorf("unexpected msgpack type %#x instead of a string", b[0])
+	}
+	if err != nil {
+		return "", err
+	}
+	s, err := d.next(n)
+	return string(s), err
+}
+
+func (d *msgpackDecoder) uint() (uint64, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	size := 0
+	switch {
+	case b[0] < 0x80:
+		return uint64(b[0]), nil
+	case b[0] == 0xcc, b[0] == 0xd0:
+		size = 1
+	case b[0] == 0xcd, b[0] == 0xd1:
+		size = 2
+	case b[0] == 0xce, b[0] == 0xd2:
+		size = 4
+	case b[0] == 0xcf, b[0] == 0xd3:
+		size = 8
+	default:
+		return 0, fmt.Errorf("unexpected msgpack type %#x instead of an integer", b[0])
+	}
+	v, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range v {
+		n = n<<8 | uint64(c)
+	}
+	if b[0] >= 0xd0 && v[0]&0x80 != 0 {
+		return 0, errors.New("negative integer")
+	}
+	return n, nil
+}
+
+// skip skips an integer or a string, which are the types of the
+// fields of a log entry before its term.
+func (d *msgpackDecoder) skip() error {
+	if len(d.buf) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	if c := d.buf[0]; c&0xe0 == 0xa0 || (c >= 0xc4 && c <= 0xc6) || (c >= 0xd9 && c <= 0xdb) {
+		_, err := d.str()
+		return err
+	}
+	_, err := d.uint()
+	return err
+}
+
+// lastRaftSnapshot returns the term and index of the latest snapshot
+// in the directory, named after them by the server, zero without any.
+func lastRaftSnapshot(dir string) (term, index uint64, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+	for _, file := range files {
+		parts := strings.SplitN(file.Name(), "-", 3)
+		if !file.IsDir() || len(parts) != 3 {
+			continue
+		}
+		t, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		i, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if t > term || (t == term && i > index) {
+			term, index = t, i
+		}
+	}
+	return term, index, nil
+}
+
+// WriteRaftStates writes the term and index of the last entry of the
+// Raft log of each node with a log under the directory, one
+// "<node> <term> <index>" line per node, as the Raft library tells
+// the most recent log from the last entry of the log or, once
+// compacted, of the latest snapshot.  A node whose log cannot be read
+// is written as "<node> unreadable: <error>".
+func WriteRaftStates(w io.Writer, dir string, nodes []string) error {
+	for _, node := range nodes {
+		logs, err := filepath.Glob(filepath.Join(dir, node, "*", "raft.log"))
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			continue
+		}
+		sort.Strings(logs)
+		term, index, err := lastRaftLogEntry(logs[0])
+		if err == nil {
+			var sterm, sindex uint64
+			sterm, sindex, err = lastRaftSnapshot(filepath.Join(filepath.Dir(logs[0]), "snapshots"))
+			if sindex > index {
+				term, index = sterm, sindex
+			}
+		}
+		if err != nil {
+			_, err = fmt.Fprintf(w, "%s unreadable: %v\n", node, err)
+		} else {
+			_, err = fmt.Fprintf(w, "%s %d %d\n", node, term, index)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBoltPageSize = 4096
+
+type testBoltElement struct {
+	key, value []byte
+	flags      uint32
+	child      uint64
+}
+
+// testBoltPage lays out a branch or leaf page as BoltDB does, only
+// as long as its elements when inlined in a bucket without an id.
+func testBoltPage(id uint64, branch bool, elems []testBoltElement) []byte {
+	buf := make([]byte, testBoltPageSize)
+	binary.LittleEndian.PutUint64(buf[0:8], id)
+	flags := uint16(boltLeafPage)
+	if branch {
+		flags = boltBranchPage
+	}
+	binary.LittleEndian.PutUint16(buf[8:10], flags)
+	binary.LittleEndian.PutUint16(buf[10:12], uint16(len(elems)))
+	data := boltPageHeaderSize + len(elems)*boltElementSize
+	for i, e := range elems {
+		at := boltPageHeaderSize + i*boltElementSize
+		elem := buf[at : at+boltElementSize]
+		pos := uint32(data - at)
+		if branch {
+			binary.LittleEndian.PutUint32(elem[0:4], pos)
+			binary.LittleEndian.PutUint32(elem[4:8], uint32(len(e.key)))
+			binary.LittleEndian.PutUint64(elem[8:16], e.child)
+		} else {
+			binary.LittleEndian.PutUint32(elem[0:4], e.flags)
+			binary.LittleEndian.PutUint32(elem[4:8], pos)
+			binary.LittleEndian.PutUint32(elem[8:12], uint32(len(e.key)))
+			binary.LittleEndian.PutUint32(elem[12:16], uint32(len(e.value)))
+		}
+		data += copy(buf[data:], e.key)
+		data += copy(buf[data:], e.value)
+	}
+	if id == 0 {
+		return buf[:data]
+	}
+	return buf
+}
+
+func testBoltMeta(id, root, txid uint64) []byte {
+	buf := make([]byte, testBoltPageSize)
+	binary.LittleEndian.PutUint64(buf[0:8], id)
+	binary.LittleEndian.PutUint16(buf[8:10], 0x04)
+	meta := buf[boltPageHeaderSize:]
+	binary.LittleEndian.PutUint32(meta[0:4], boltMagic)
+	binary.LittleEndian.PutUint32(meta[4:8], 2)
+	binary.LittleEndian.PutUint32(meta[8:12], testBoltPageSize)
+	binary.LittleEndian.PutUint64(meta[16:24], root)
+	binary.LittleEndian.PutUint64(meta[48:56], txid)
+	h := fnv.New64a()
+	h.Write(meta[:56])
+	binary.LittleEndian.PutUint64(meta[56:64], h.Sum64())
+	return buf
+}
+
+func testBoltBucket(root uint64, inline []byte) []byte {
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint64(header[0:8], root)
+	return append(header, inline...)
+}
+
+// testRaftLogEntry encodes a log entry as raft-boltdb does.
+func testRaftLogEntry(index, term uint64) testBoltElement {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+	var value bytes.Buffer
+	value.WriteByte(0x84)
+	value.WriteString("\xa5Index\xcf")
+	binary.Write(&value, binary.BigEndian, index)
+	value.WriteString("\xa4Term\xcf")
+	binary.Write(&value, binary.BigEndian, term)
+	value.WriteString("\xa4Type\x00\xa4Data\xa3msg")
+	return testBoltElement{key: key, value: value.Bytes()}
+}
+
+func writeTestFile(t *testing.T, name string, pages ...[]byte) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, bytes.Join(pages, nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastRaftLogEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raftlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The logs bucket on its own pages, under the root page of the
+	// latest meta page, the other one having an outdated root.
+	branched := filepath.Join(dir, "branched.log")
+	writeTestFile(t, branched,
+		testBoltMeta(0, 2, 4),
+		testBoltMeta(1, 6, 3),
+		testBoltPage(2, false, []testBoltElement{
+			{key: []byte("conf"), value: testBoltBucket(0, testBoltPage(0, false, nil)), flags: boltBucketLeaf},
+			{key: []byte("logs"), value: testBoltBucket(3, nil), flags: boltBucketLeaf},
+		}),
+		testBoltPage(3, true, []testBoltElement{
+			{key: testRaftLogEntry(1, 0).key, child: 4},
+			{key: testRaftLogEntry(3, 0).key, child: 5},
+		}),
+		testBoltPage(4, false, []testBoltElement{testRaftLogEntry(1, 1), testRaftLogEntry(2, 1)}),
+		testBoltPage(5, false, []testBoltElement{testRaftLogEntry(3, 2), testRaftLogEntry(300, 7)}),
+		testBoltPage(6, false, nil),
+	)
+
+	// A small logs bucket inlined in the root page.
+	inline := filepath.Join(dir, "inline.log")
+	writeTestFile(t, inline,
+		testBoltMeta(0, 2, 1),
+		testBoltMeta(1, 2, 1),
+		testBoltPage(2, false, []testBoltElement{
+			{key: []byte("logs"), value: testBoltBucket(0, testBoltPage(0, false, []testBoltElement{
+				testRaftLogEntry(5, 2), testRaftLogEntry(6, 3),
+			})), flags: boltBucketLeaf},
+		}),
+	)
+
+	empty := filepath.Join(dir, "empty.log")
+	writeTestFile(t, empty, testBoltMeta(0, 2, 1), testBoltMeta(1, 2, 1), testBoltPage(2, false, nil))
+
+	garbage := filepath.Join(dir, "garbage.log")
+	writeTestFile(t, garbage, bytes.Repeat([]byte("garbage"), 1000))
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		term  uint64
+		index uint64
+		err   bool
+	}{
+		{"branched", branched, 7, 300, false},
+		{"inline", inline, 3, 6, false},
+		{"empty", empty, 0, 0, false},
+		{"garbage", garbage, 0, 0, true},
+		{"missing", filepath.Join(dir, "missing.log"), 0, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			term, index, err := lastRaftLogEntry(tc.path)
+			if tc.err != (err != nil) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if term != tc.term || index != tc.index {
+				t.Errorf("Expected term %d and index %d, got: %d and %d", tc.term, tc.index, term, index)
+			}
+		})
+	}
+}
+
+func TestWriteRaftStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raftlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs := func(entries ...testBoltElement) [][]byte {
+		return [][]byte{
+			testBoltMeta(0, 2, 1),
+			testBoltMeta(1, 2, 1),
+			testBoltPage(2, false, []testBoltElement{
+				{key: []byte("logs"), value: testBoltBucket(0, testBoltPage(0, false, entries)), flags: boltBucketLeaf},
+			}),
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "stan-1", "stan", "raft.log"), logs(testRaftLogEntry(120, 3))...)
+	// The entries up to the latest snapshot were compacted.
+	writeTestFile(t, filepath.Join(dir, "stan-2", "stan", "raft.log"), logs()...)
+	for _, snapshot := range []string{"3-150-1600000000000", "2-90-1500000000000"} {
+		if err := os.MkdirAll(filepath.Join(dir, "stan-2", "stan", "snapshots", snapshot), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "stan-3", "stan", "raft.log"), []byte("garbage"))
+	if err := os.MkdirAll(filepath.Join(dir, "stan-4"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteRaftStates(&out, dir, []string{"stan-1", "stan-2", "stan-3", "stan-4", "stan-5"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "stan-1 3 120" || lines[1] != "stan-2 3 150" || !strings.HasPrefix(lines[2], "stan-3 unreadable: ") {
+		t.Fatalf("Unexpected states:\n%s", out.String())
+	}
+	states := parseRaftStates(out.String())
+	if _, err := mostRecentRaftState(states[:2]); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := mostRecentRaftState(states); err == nil || !strings.Contains(err.Error(), "stan-3 cannot be read") {
+		t.Errorf("Expected the unreadable log to be refused, got: %v", err)
+	}
+}
@@ -0,0 +1,568 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// quorumRecoveryMarker is the file in the store directory with
+	// the node being recovered, in case the job is retried once its
+	// store has been moved already.
+	quorumRecoveryMarker = ".quorum-recovery"
+
+	// preRecoverySuffix is appended to the stores and the Raft logs
+	// set aside by a recovery, which are only removed once all the
+	// nodes are ready again.
+	preRecoverySuffix = ".pre-recovery"
+)
+
+func quorumRecoveryJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-quorum-recovery", o.Name)
+}
+
+func quorumRecoveryCleanupJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-quorum-recovery-cleanup", o.Name)
+}
+
+func quorumRecoveryLabels(o *stanv1alpha1.NatsStreamingCluster) map[string]string {
+	return map[string]string{
+		"app":          "nats-streaming-quorum-recovery",
+		"stan_cluster": o.Name,
+	}
+}
+
+// reconcileQuorumRecovery recovers a Raft group that lost its quorum
+// as requested by the RecoverQuorumAnnotation, returning whether the
+// nodes are not to be started.  All the nodes are stopped, the store
+// of the survivor is made the store of the first node without its
+// Raft log, and the first node is then bootstrapped alone so that
+// fresh peers join it.  Unless named, the survivor is the node whose
+// Raft log has the most recent last entry, as read by a job once
+// stopped.  The other stores are set aside until all the nodes are
+// ready again.
+func (c *Controller) reconcileQuorumRecovery(o *stanv1alpha1.NatsStreamingCluster) (bool, error) {
+	if r := o.Status.QuorumRecovery; r != nil {
+		return c.advanceQuorumRecovery(o, r.DeepCopy())
+	}
+	value := o.Annotations[RecoverQuorumAnnotation]
+	if value == "" || value == "false" {
+		return false, nil
+	}
+	survivor := value
+	if survivor == "true" {
+		survivor = ""
+	}
+
+	if !isClustered(o) || o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" {
+		return false, c.refuseQuorumRecovery(o, "only the Raft group of a clustered file store can be recovered")
+	}
+	_, mounts := storeVolumes(newStanNodePod(o, fmt.Sprintf("%s-1", o.Name)), storeDir(o))
+	if storeDir(o) == "" || len(mounts) == 0 {
+		return false, c.refuseQuorumRecovery(o, "the store of the nodes is not on a volume")
+	}
+	if hasExplicitPeers(o) {
+		return false, c.refuseQuorumRecovery(o, "the first node cannot be bootstrapped alone with explicit peers, disable them for the recovery")
+	}
+	if survivor == "" && c.opts.Image == "" {
+		return false, c.refuseQuorumRecovery(o, "the image of the operator to read the Raft logs with is not set, set the annotation to the node to recover from")
+	}
+	known := survivor == ""
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		known = known || survivor == fmt.Sprintf("%s-%d", o.Name, i)
+	}
+	if !known {
+		return false, c.refuseQuorumRecovery(o, fmt.Sprintf("%s is not a node of the cluster", survivor))
+	}
+
+	now := k8smetav1.Now()
+	r := &stanv1alpha1.QuorumRecovery{
+		Phase:     stanv1alpha1.QuorumRecoveryStopping,
+		Survivor:  survivor,
+		Message:   "stopping the nodes",
+		StartTime: &now,
+	}
+	from := survivor
+	if from == "" {
+		from = "the node with the most recent Raft log entry"
+	}
+	log.Warnf("Recovering the Raft group of '%s/%s' cluster from %s", o.Namespace, o.Name, from)
+	c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryStarted", "Recovering the Raft group from %s, stopping the nodes", from)
+	err := c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		delete(cluster.Annotations, RecoverQuorumAnnotation)
+		setQuorumRecovery(&cluster.Status, r)
+		cluster.Status.RaftHealth = nil
+	})
+	if err != nil {
+		return true, err
+	}
+	return c.advanceQuorumRecovery(o, r)
+}
+
+// refuseQuorumRecovery removes the annotation of a recovery that
+// cannot be done, recording why.
+func (c *Controller) refuseQuorumRecovery(o *stanv1alpha1.NatsStreamingCluster, reason string) error {
+	log.Errorf("Refusing to recover the Raft group of '%s/%s' cluster: %s", o.Namespace, o.Name, reason)
+	c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryRefused", "Refusing to recover the Raft group: %s", reason)
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		delete(cluster.Annotations, RecoverQuorumAnnotation)
+		setCondition(&cluster.Status, stanv1alpha1.ClusterQuorumRecovery, k8scorev1.ConditionFalse, "Refused",
+			fmt.Sprintf("Refusing to recover the Raft group: %s", reason))
+	})
+}
+
+// setQuorumRecovery sets the progress of the recovery in the status.
+func setQuorumRecovery(status *stanv1alpha1.NatsStreamingClusterStatus, r *stanv1alpha1.QuorumRecovery) {
+	status.QuorumRecovery = r.DeepCopy()
+	cstatus := k8scorev1.ConditionTrue
+	if r.Phase == stanv1alpha1.QuorumRecoveryFailed {
+		cstatus = k8scorev1.ConditionFalse
+	}
+	setCondition(status, stanv1alpha1.ClusterQuorumRecovery, cstatus, string(r.Phase),
+		fmt.Sprintf("Recovering the Raft group: %s", r.Message))
+}
+
+func (c *Controller) updateQuorumRecovery(o *stanv1alpha1.NatsStreamingCluster, r *stanv1alpha1.QuorumRecovery) error {
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		setQuorumRecovery(status, r)
+	})
+}
+
+// advanceQuorumRecovery advances the recovery by one step, returning
+// whether the nodes are still to be kept stopped.
+func (c *Controller) advanceQuorumRecovery(o *stanv1alpha1.NatsStreamingCluster, r *stanv1alpha1.QuorumRecovery) (bool, error) {
+	first := fmt.Sprintf("%s-1", o.Name)
+
+	switch r.Phase {
+	case stanv1alpha1.QuorumRecoveryStopping:
+		stopped, err := c.stopNodes(o, "to recover the Raft group")
+		if err != nil || !stopped {
+			return true, err
+		}
+		if r.Survivor == "" {
+			r.Phase = stanv1alpha1.QuorumRecoverySelecting
+			r.Job = raftStateJobName(o)
+			r.Message = "looking for the node with the most recent Raft log entry"
+			c.event(o, k8scorev1.EventTypeNormal, "NodesStopped", "Stopped the nodes, %s with job %s", r.Message, r.Job)
+			if err := c.createRaftStateJob(o); err != nil {
+				return true, err
+			}
+			return true, c.updateQuorumRecovery(o, r)
+		}
+		r.Phase = stanv1alpha1.QuorumRecoveryRecovering
+		r.Job = quorumRecoveryJobName(o)
+		r.Message = fmt.Sprintf("recovering the store of %s", r.Survivor)
+		c.event(o, k8scorev1.EventTypeNormal, "NodesStopped", "Stopped the nodes, %s with job %s", r.Message, r.Job)
+		if err := c.createQuorumRecoveryJob(o, r); err != nil {
+			return true, err
+		}
+		return true, c.updateQuorumRecovery(o, r)
+
+	case stanv1alpha1.QuorumRecoverySelecting:
+		job, failure, err := c.pollStoreJob(o, r.Job, func() error {
+			return c.createRaftStateJob(o)
+		})
+		if err != nil {
+			return true, err
+		}
+		if failure != "" {
+			log.Errorf("Failed to look for the Raft logs of '%s/%s' cluster: %s", o.Namespace, o.Name, failure)
+			c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryFailed", "Job %s failed to look for the Raft logs: %s", r.Job, failure)
+			r.Phase = stanv1alpha1.QuorumRecoveryFailed
+			r.Message = fmt.Sprintf("looking for the Raft logs failed, delete job %s to retry: %s", r.Job, failure)
+			return true, c.updateQuorumRecovery(o, r)
+		}
+		if job == nil {
+			return true, nil
+		}
+		message, err := c.jobTerminationMessage(o.Namespace, job.Name)
+		if err != nil {
+			return true, err
+		}
+		if err := c.deleteStoreJob(o, job.Name); err != nil {
+			return true, err
+		}
+		best, err := mostRecentRaftState(parseRaftStates(message))
+		if err != nil {
+			reason := fmt.Sprintf("%s, set the annotation to the node to recover from", err)
+			log.Errorf("Refusing to recover the Raft group of '%s/%s' cluster: %s", o.Namespace, o.Name, reason)
+			c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryRefused", "Refusing to recover the Raft group: %s", reason)
+			return false, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+				status.QuorumRecovery = nil
+				setCondition(status, stanv1alpha1.ClusterQuorumRecovery, k8scorev1.ConditionFalse, "Refused",
+					fmt.Sprintf("Refusing to recover the Raft group: %s", reason))
+			})
+		}
+		r.Survivor = best.node
+		log.Infof("Selected %s with the most recent Raft log entry to recover '%s/%s' cluster from: %s", best.node, o.Namespace, o.Name, best)
+		c.event(o, k8scorev1.EventTypeNormal, "SurvivorSelected", "Selected %s with the most recent Raft log entry: %s", best.node, best)
+		r.Phase = stanv1alpha1.QuorumRecoveryRecovering
+		r.Job = quorumRecoveryJobName(o)
+		r.Message = fmt.Sprintf("recovering the store of %s", r.Survivor)
+		if err := c.createQuorumRecoveryJob(o, r); err != nil {
+			return true, err
+		}
+		return true, c.updateQuorumRecovery(o, r)
+
+	case stanv1alpha1.QuorumRecoveryRecovering:
+		job, failure, err := c.pollStoreJob(o, r.Job, func() error {
+			return c.createQuorumRecoveryJob(o, r)
+		})
+		if err != nil {
+			return true, err
+		}
+		if failure != "" {
+			log.Errorf("Failed to recover the store of '%s/%s' cluster: %s", o.Namespace, o.Name, failure)
+			c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryFailed", "Job %s failed to recover the store: %s", r.Job, failure)
+			r.Phase = stanv1alpha1.QuorumRecoveryFailed
+			r.Message = fmt.Sprintf("recovering the store failed, delete job %s to retry: %s", r.Job, failure)
+			return true, c.updateQuorumRecovery(o, r)
+		}
+		if job == nil {
+			return true, nil
+		}
+		if err := c.deleteStoreJob(o, job.Name); err != nil {
+			return true, err
+		}
+		log.Infof("Recovered the store of %s for '%s/%s' cluster, bootstrapping %s alone", r.Survivor, o.Namespace, o.Name, first)
+		c.event(o, k8scorev1.EventTypeNormal, "StoreRecovered",
+			"Recovered the store of %s as the store of %s, bootstrapping it as a single node Raft group, the other stores are set aside with the %s suffix until the nodes are ready",
+			r.Survivor, first, preRecoverySuffix)
+		r.Phase = stanv1alpha1.QuorumRecoveryStarting
+		r.Message = fmt.Sprintf("bootstrapping %s with the store of %s", first, r.Survivor)
+		return true, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			setQuorumRecovery(status, r)
+			status.Bootstrapped = false
+			status.BootstrapNode = ""
+			status.BootstrapTime = nil
+		})
+
+	case stanv1alpha1.QuorumRecoveryFailed:
+		// The nodes are already running when the cleanup failed.
+		stopped := r.Job != quorumRecoveryCleanupJobName(o)
+		deleted, err := c.storeJobDeleted(o, r.Job)
+		if err != nil || !deleted {
+			return stopped, err
+		}
+		log.Infof("Retrying job '%s/%s' of the quorum recovery of '%s/%s' cluster", o.Namespace, r.Job, o.Namespace, o.Name)
+		c.event(o, k8scorev1.EventTypeNormal, "QuorumRecoveryRetried", "Retrying job %s", r.Job)
+		switch r.Job {
+		case raftStateJobName(o):
+			r.Phase = stanv1alpha1.QuorumRecoverySelecting
+			r.Message = "retrying to look for the node with the most recent Raft log entry"
+		case quorumRecoveryCleanupJobName(o):
+			r.Phase = stanv1alpha1.QuorumRecoveryCleaning
+			r.Message = "retrying to remove the stores set aside"
+		default:
+			r.Phase = stanv1alpha1.QuorumRecoveryRecovering
+			r.Message = "retrying to recover the store"
+		}
+		return stopped, c.updateQuorumRecovery(o, r)
+
+	case stanv1alpha1.QuorumRecoveryStarting:
+		// The first node is bootstrapped and the others are added
+		// as fresh peers by the usual reconciliation of the size.
+		pods, err := c.findRunningPods(o.Name, o.Namespace)
+		if err != nil {
+			return false, err
+		}
+		ready := 0
+		for _, pod := range pods {
+			if podIsReady(pod) {
+				ready++
+			}
+		}
+		if ready < int(o.Spec.Size) {
+			if o.Status.Bootstrapped && !strings.HasPrefix(r.Message, "adding") {
+				c.event(o, k8scorev1.EventTypeNormal, "Bootstrapped", "Bootstrapped %s, adding %d fresh peers", first, o.Spec.Size-1)
+				r.Message = fmt.Sprintf("adding %d fresh peers to %s", o.Spec.Size-1, first)
+				return false, c.updateQuorumRecovery(o, r)
+			}
+			return false, nil
+		}
+		r.Phase = stanv1alpha1.QuorumRecoveryCleaning
+		r.Job = quorumRecoveryCleanupJobName(o)
+		r.Message = "removing the stores set aside"
+		c.event(o, k8scorev1.EventTypeNormal, "NodesReady", "All %d nodes are ready, %s with job %s", ready, r.Message, r.Job)
+		if err := c.createQuorumRecoveryCleanupJob(o); err != nil {
+			return false, err
+		}
+		return false, c.updateQuorumRecovery(o, r)
+
+	case stanv1alpha1.QuorumRecoveryCleaning:
+		job, failure, err := c.pollStoreJob(o, r.Job, func() error {
+			return c.createQuorumRecoveryCleanupJob(o)
+		})
+		if err != nil {
+			return false, err
+		}
+		if failure != "" {
+			log.Errorf("Failed to remove the stores set aside by the quorum recovery of '%s/%s' cluster: %s", o.Namespace, o.Name, failure)
+			c.event(o, k8scorev1.EventTypeWarning, "QuorumRecoveryFailed", "Job %s failed to remove the stores set aside: %s", r.Job, failure)
+			r.Phase = stanv1alpha1.QuorumRecoveryFailed
+			r.Message = fmt.Sprintf("removing the stores set aside failed, delete job %s to retry: %s", r.Job, failure)
+			return false, c.updateQuorumRecovery(o, r)
+		}
+		if job == nil {
+			return false, nil
+		}
+		if err := c.deleteStoreJob(o, job.Name); err != nil {
+			return false, err
+		}
+		log.Infof("Recovered the Raft group of '%s/%s' cluster from the store of %s", o.Namespace, o.Name, r.Survivor)
+		c.event(o, k8scorev1.EventTypeNormal, "QuorumRecovered", "Recovered the Raft group from the store of %s", r.Survivor)
+		return false, c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+			status.QuorumRecovery = nil
+			setCondition(status, stanv1alpha1.ClusterQuorumRecovery, k8scorev1.ConditionFalse, "Completed",
+				fmt.Sprintf("Recovered the Raft group from the store of %s", r.Survivor))
+		})
+	}
+	return false, fmt.Errorf("unknown phase %q of the quorum recovery of '%s/%s' cluster", r.Phase, o.Namespace, o.Name)
+}
+
+func raftStateJobName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-raft-state", o.Name)
+}
+
+// raftState is the term and index of the last entry of the Raft log
+// of a node, or why it could not be read.
+type raftState struct {
+	node       string
+	term       uint64
+	index      uint64
+	unreadable string
+}
+
+func (s *raftState) String() string {
+	return fmt.Sprintf("last entry at term %d and index %d", s.term, s.index)
+}
+
+// raftStateScript writes the last entry of the Raft log of each node
+// to the termination message with RaftStateCommand.
+func raftStateScript(o *stanv1alpha1.NatsStreamingCluster) string {
+	var nodes []string
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		nodes = append(nodes, fmt.Sprintf("%s-%d", o.Name, i))
+	}
+	return fmt.Sprintf("nats-streaming-operator %s %s %s > /dev/termination-log",
+		RaftStateCommand, shellQuote(path.Join(storeDir(o), "raft")), shellQuoteAll(nodes))
+}
+
+// parseRaftStates parses the termination message of the job written
+// by WriteRaftStates, the lines it cannot parse being unreadable.
+func parseRaftStates(message string) []*raftState {
+	var states []*raftState
+	for _, line := range strings.Split(message, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		state := &raftState{node: fields[0]}
+		states = append(states, state)
+		var err error
+		if len(fields) != 3 {
+			err = fmt.Errorf("unexpected fields")
+		} else if state.term, err = strconv.ParseUint(fields[1], 10, 64); err == nil {
+			state.index, err = strconv.ParseUint(fields[2], 10, 64)
+		}
+		if err != nil {
+			rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+			state.unreadable = strings.TrimSpace(strings.TrimPrefix(rest, "unreadable:"))
+			if state.unreadable == "" {
+				state.unreadable = err.Error()
+			}
+		}
+	}
+	return states
+}
+
+// mostRecentRaftState returns the state with the most recent last
+// entry, by term then index as Raft compares logs.  It fails without
+// any state, when a log could not be read, since it could be the
+// most recent one, and when the most recent entry is in several logs.
+func mostRecentRaftState(states []*raftState) (*raftState, error) {
+	var best []*raftState
+	for _, state := range states {
+		if state.unreadable != "" {
+			return nil, fmt.Errorf("the Raft log of %s cannot be read: %s", state.node, state.unreadable)
+		}
+		switch {
+		case len(best) == 0 || state.term > best[0].term || (state.term == best[0].term && state.index > best[0].index):
+			best = []*raftState{state}
+		case state.term == best[0].term && state.index == best[0].index:
+			best = append(best, state)
+		}
+	}
+	if len(best) == 0 {
+		return nil, fmt.Errorf("no node has a Raft log left to tell the most recent one")
+	}
+	if len(best) > 1 {
+		var nodes []string
+		for _, state := range best {
+			nodes = append(nodes, state.node)
+		}
+		return nil, fmt.Errorf("the Raft logs of %s have the same %s", strings.Join(nodes, ", "), best[0])
+	}
+	return best[0], nil
+}
+
+func (c *Controller) createRaftStateJob(o *stanv1alpha1.NatsStreamingCluster) error {
+	job := newStoreReaderJob(o, k8smetav1.ObjectMeta{
+		Name:            raftStateJobName(o),
+		Namespace:       o.Namespace,
+		Labels:          quorumRecoveryLabels(o),
+		OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+	}, c.opts.Image, raftStateScript(o))
+	if job == nil {
+		return fmt.Errorf("the store of '%s/%s' cluster is not on a volume", o.Namespace, o.Name)
+	}
+	log.Infof("Creating job '%s/%s' to look for the most recent Raft log entry of '%s/%s' cluster", job.Namespace, job.Name, o.Namespace, o.Name)
+	_, err := c.kc.BatchV1().Jobs(o.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// quorumRecoveryStale returns the stores of the nodes that are not
+// kept by the recovery of the first node from the survivor, and all
+// the Raft logs, relative to the store directory.
+func quorumRecoveryStale(o *stanv1alpha1.NatsStreamingCluster) []string {
+	var stale []string
+	for i := 2; i <= int(o.Spec.Size); i++ {
+		stale = append(stale, fmt.Sprintf("%s-%d", o.Name, i))
+	}
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		stale = append(stale, path.Join("raft", fmt.Sprintf("%s-%d", o.Name, i)))
+	}
+	return stale
+}
+
+// quorumRecoveryScript moves the store of the survivor to the first
+// node and sets aside the stores of the other nodes and all the Raft
+// logs, replacing what a previous recovery left.
+func quorumRecoveryScript(o *stanv1alpha1.NatsStreamingCluster, survivor string) string {
+	dir := storeDir(o)
+	first := fmt.Sprintf("%s-1", o.Name)
+
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("cd %s", shellQuote(dir)),
+		fmt.Sprintf("if [ -d %s ]; then", shellQuote(survivor)),
+		fmt.Sprintf("  echo %s", shellQuote(fmt.Sprintf("Recovering the store of %s", survivor))),
+		fmt.Sprintf("  echo %s > %s", shellQuote(survivor), quorumRecoveryMarker),
+		fmt.Sprintf("  if [ %s != %s ]; then", shellQuote(survivor), shellQuote(first)),
+		fmt.Sprintf("    if [ -e %s ]; then", shellQuote(first)),
+		fmt.Sprintf("      rm -rf %s", shellQuote(first+preRecoverySuffix)),
+		fmt.Sprintf("      mv %s %s", shellQuote(first), shellQuote(first+preRecoverySuffix)),
+		"    fi",
+		fmt.Sprintf("    mv %s %s", shellQuote(survivor), shellQuote(first)),
+		"  fi",
+		fmt.Sprintf(`elif [ "$(cat %s 2>/dev/null)" != %s ]; then`, quorumRecoveryMarker, shellQuote(survivor)),
+		fmt.Sprintf(`  echo "No store found at %s" >&2`, path.Join(dir, survivor)),
+		"  exit 1",
+		"fi",
+		fmt.Sprintf("for stale in %s; do", shellQuoteAll(quorumRecoveryStale(o))),
+		`  if [ -e "$stale" ]; then`,
+		fmt.Sprintf(`    rm -rf "$stale%s"`, preRecoverySuffix),
+		fmt.Sprintf(`    mv "$stale" "$stale%s"`, preRecoverySuffix),
+		"  fi",
+		"done",
+		fmt.Sprintf("rm -f %s", quorumRecoveryMarker),
+	}, "\n")
+}
+
+// quorumRecoveryCleanupScript removes the stores set aside by the
+// recovery.
+func quorumRecoveryCleanupScript(o *stanv1alpha1.NatsStreamingCluster) string {
+	var aside []string
+	for _, stale := range append([]string{fmt.Sprintf("%s-1", o.Name)}, quorumRecoveryStale(o)...) {
+		aside = append(aside, stale+preRecoverySuffix)
+	}
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("cd %s", shellQuote(storeDir(o))),
+		fmt.Sprintf("rm -rf %s", shellQuoteAll(aside)),
+	}, "\n")
+}
+
+// newQuorumRecoveryJob returns a job running the script on the store
+// volume, on the given node when not empty.
+func newQuorumRecoveryJob(o *stanv1alpha1.NatsStreamingCluster, name, nodeName, script string) (*k8sbatchv1.Job, error) {
+	node := newStanNodePod(o, fmt.Sprintf("%s-1", o.Name))
+	volumes, mounts := storeVolumes(node, storeDir(o))
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no volume of pod %s has the store directory %s", node.Name, storeDir(o))
+	}
+
+	job := newTargetJob(k8smetav1.ObjectMeta{
+		Name:            name,
+		Namespace:       o.Namespace,
+		Labels:          quorumRecoveryLabels(o),
+		OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+	}, "", &stanv1alpha1.BackupTarget{}, script, volumes, mounts)
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.ImagePullSecrets = o.Spec.ImagePullSecrets
+	podSpec.SecurityContext = node.Spec.SecurityContext
+	podSpec.NodeName = nodeName
+	return job, nil
+}
+
+func (c *Controller) createQuorumRecoveryJob(o *stanv1alpha1.NatsStreamingCluster, r *stanv1alpha1.QuorumRecovery) error {
+	job, err := newQuorumRecoveryJob(o, r.Job, "", quorumRecoveryScript(o, r.Survivor))
+	if err != nil {
+		return err
+	}
+	log.Infof("Creating job '%s/%s' to recover the store of '%s/%s' cluster", job.Namespace, job.Name, o.Namespace, o.Name)
+	_, err = c.kc.BatchV1().Jobs(o.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createQuorumRecoveryCleanupJob creates the job removing the stores
+// set aside, next to the first node which has the store volume
+// attached now that the nodes are running.
+func (c *Controller) createQuorumRecoveryCleanupJob(o *stanv1alpha1.NatsStreamingCluster) error {
+	var nodeName string
+	pod, err := c.kc.CoreV1().Pods(o.Namespace).Get(fmt.Sprintf("%s-1", o.Name), k8smetav1.GetOptions{})
+	if err == nil {
+		nodeName = pod.Spec.NodeName
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+	job, err := newQuorumRecoveryJob(o, quorumRecoveryCleanupJobName(o), nodeName, quorumRecoveryCleanupScript(o))
+	if err != nil {
+		return err
+	}
+	log.Infof("Creating job '%s/%s' to remove the stores set aside by the quorum recovery of '%s/%s' cluster", job.Namespace, job.Name, o.Namespace, o.Name)
+	_, err = c.kc.BatchV1().Jobs(o.Namespace).Create(job)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8srecord "k8s.io/client-go/tools/record"
+)
+
+func TestReconcileQuorumRecovery(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Annotations = map[string]string{RecoverQuorumAnnotation: "true"}
+	c := newTestController([]k8sruntime.Object{o}, newTestStorePods(o)...)
+	c.opts.Image = "synadia/nats-streaming-operator:test"
+	recorder := k8srecord.NewFakeRecorder(20)
+	c.recorder = recorder
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	reconcileRecovery := func() bool {
+		recovering, err := c.reconcileQuorumRecovery(getCluster())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recovering
+	}
+
+	// The survivor is selected from the Raft logs of the stopped nodes.
+	if !reconcileRecovery() {
+		t.Fatalf("Expected recovery to be in progress")
+	}
+	o = getCluster()
+	if _, ok := o.Annotations[RecoverQuorumAnnotation]; ok {
+		t.Errorf("Expected annotation to be removed once the recovery started")
+	}
+	if pods, _ := c.findPods("stan", "default"); len(pods.Items) != 0 {
+		t.Fatalf("Expected pods to be stopped, got: %d", len(pods.Items))
+	}
+	if !reconcileRecovery() {
+		t.Fatalf("Expected recovery to be in progress")
+	}
+	r := getCluster().Status.QuorumRecovery
+	if r == nil || r.Phase != stanv1alpha1.QuorumRecoverySelecting || r.Survivor != "" {
+		t.Fatalf("Expected the survivor to be selected, got: %+v", r)
+	}
+	job, err := c.kc.BatchV1().Jobs("default").Get(r.Job, k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	expectedScript := `nats-streaming-operator raft-state '/pv/stan/raft' 'stan-1' 'stan-2' 'stan-3' > /dev/termination-log`
+	if script := spec.Containers[0].Command[2]; script != expectedScript {
+		t.Errorf("Expected script %q, got: %q", expectedScript, script)
+	}
+	if image := spec.Containers[0].Image; image != c.opts.Image {
+		t.Errorf("Expected the Raft logs to be read with the image of the operator, got: %s", image)
+	}
+	if !spec.Containers[0].VolumeMounts[0].ReadOnly {
+		t.Errorf("Expected the store volume to be mounted read only")
+	}
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	pod := newTestPod("stan-raft-state-abcde")
+	pod.Labels = map[string]string{"job-name": job.Name}
+	pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{
+		Name: "backup",
+		State: k8scorev1.ContainerState{
+			Terminated: &k8scorev1.ContainerStateTerminated{
+				Message: "stan-1 3 120\nstan-2 3 150\n",
+			},
+		},
+	}}
+	if _, err := c.kc.CoreV1().Pods("default").Create(pod); err != nil {
+		t.Fatal(err)
+	}
+	if !reconcileRecovery() {
+		t.Fatalf("Expected recovery to be in progress")
+	}
+	if err := c.kc.CoreV1().Pods("default").Delete(pod.Name, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get(job.Name, k8smetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected job to be deleted once done")
+	}
+	r = getCluster().Status.QuorumRecovery
+	if r == nil || r.Phase != stanv1alpha1.QuorumRecoveryRecovering || r.Survivor != "stan-2" {
+		t.Fatalf("Expected the store of stan-2 to be recovered, got: %+v", r)
+	}
+	job, err = c.kc.BatchV1().Jobs("default").Get(r.Job, k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := job.Spec.Template.Spec.Containers[0].Command[2]
+	for _, expected := range []string{
+		`cd '/pv/stan'`,
+		`mv 'stan-1' 'stan-1.pre-recovery'`,
+		`mv 'stan-2' 'stan-1'`,
+		`for stale in 'stan-2' 'stan-3' 'raft/stan-1' 'raft/stan-2' 'raft/stan-3'; do`,
+		`mv "$stale" "$stale.pre-recovery"`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script, got:\n%s", expected, script)
+		}
+	}
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "rm -rf") && !strings.HasSuffix(strings.Trim(line, `'"`), ".pre-recovery") {
+			t.Errorf("Expected the other stores to be set aside, got: %s", line)
+		}
+	}
+
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	if !reconcileRecovery() {
+		t.Fatalf("Expected recovery to be in progress")
+	}
+	o = getCluster()
+	r = o.Status.QuorumRecovery
+	if r.Phase != stanv1alpha1.QuorumRecoveryStarting || r.Survivor != "stan-2" || o.Status.Bootstrapped {
+		t.Fatalf("Expected stan-1 to be bootstrapped with the store of stan-2, got: %+v", o.Status)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get(r.Job, k8smetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected job to be deleted")
+	}
+
+	// The nodes are started by the usual reconciliation.
+	if reconcileRecovery() {
+		t.Fatalf("Expected nodes to be started")
+	}
+	if err := c.reconcileSize(getCluster()); err != nil {
+		t.Fatal(err)
+	}
+	pod, err = c.kc.CoreV1().Pods("default").Get("stan-1", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := strings.Join(pod.Spec.Containers[0].Command, " "); !strings.Contains(cmd, "-cluster_bootstrap") {
+		t.Errorf("Expected stan-1 to be bootstrapped, got: %s", cmd)
+	}
+	if reconcileRecovery() {
+		t.Fatalf("Expected nodes to be started")
+	}
+	if err := c.kc.CoreV1().Pods("default").Delete("stan-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range newTestStorePods(o) {
+		if _, err := c.kc.CoreV1().Pods("default").Create(pod.(*k8scorev1.Pod)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reconcileRecovery() {
+		t.Fatalf("Expected nodes to be started")
+	}
+
+	// The stores set aside are removed once all the nodes are ready.
+	r = getCluster().Status.QuorumRecovery
+	if r == nil || r.Phase != stanv1alpha1.QuorumRecoveryCleaning {
+		t.Fatalf("Expected the stores set aside to be removed, got: %+v", r)
+	}
+	job, err = c.kc.BatchV1().Jobs("default").Get(r.Job, k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedScript = "rm -rf 'stan-1.pre-recovery' 'stan-2.pre-recovery' 'stan-3.pre-recovery' 'raft/stan-1.pre-recovery' 'raft/stan-2.pre-recovery' 'raft/stan-3.pre-recovery'"
+	if script := job.Spec.Template.Spec.Containers[0].Command[2]; !strings.Contains(script, expectedScript) {
+		t.Errorf("Expected %q in script, got:\n%s", expectedScript, script)
+	}
+	if nodeName := job.Spec.Template.Spec.NodeName; nodeName != "node-1" {
+		t.Errorf("Expected job to run on the node of stan-1, got: %q", nodeName)
+	}
+	job.Status.Succeeded = 1
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	if reconcileRecovery() {
+		t.Fatalf("Expected recovery to be done")
+	}
+	o = getCluster()
+	if o.Status.QuorumRecovery != nil {
+		t.Errorf("Expected recovery to be done, got: %+v", o.Status.QuorumRecovery)
+	}
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterQuorumRecovery); cond == nil || cond.Reason != "Completed" {
+		t.Errorf("Expected completed condition, got: %+v", cond)
+	}
+
+	var reasons []string
+	for len(recorder.Events) > 0 {
+		reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+	}
+	expected := []string{"QuorumRecoveryStarted", "NodesStopped", "SurvivorSelected", "StoreRecovered", "Bootstrapped", "NodesReady", "QuorumRecovered"}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected events %v, got: %v", expected, reasons)
+	}
+
+	// A named survivor is recovered without selecting one.
+	o.Annotations = map[string]string{RecoverQuorumAnnotation: "stan-3"}
+	if _, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Update(o); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRecovery()
+	if !reconcileRecovery() {
+		t.Fatalf("Expected recovery to be in progress")
+	}
+	o = getCluster()
+	if r := o.Status.QuorumRecovery; r == nil || r.Phase != stanv1alpha1.QuorumRecoveryRecovering || r.Survivor != "stan-3" {
+		t.Fatalf("Expected the store of stan-3 to be recovered, got: %+v", r)
+	}
+	if err := c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.QuorumRecovery = nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	o = getCluster()
+
+	// Refused for a node that is not part of the cluster.
+	o.Annotations = map[string]string{RecoverQuorumAnnotation: "stan-4"}
+	if _, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Update(o); err != nil {
+		t.Fatal(err)
+	}
+	if reconcileRecovery() {
+		t.Fatalf("Expected recovery to be refused")
+	}
+	o = getCluster()
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterQuorumRecovery); cond == nil || cond.Reason != "Refused" || !strings.Contains(cond.Message, "stan-4 is not a node") {
+		t.Errorf("Expected refused condition, got: %+v", cond)
+	}
+	if _, ok := o.Annotations[RecoverQuorumAnnotation]; ok {
+		t.Errorf("Expected annotation of the refused recovery to be removed")
+	}
+
+	// Refused without the image of the operator to read the Raft logs with.
+	c.opts.Image = ""
+	o.Annotations = map[string]string{RecoverQuorumAnnotation: "true"}
+	if _, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Update(o); err != nil {
+		t.Fatal(err)
+	}
+	if reconcileRecovery() {
+		t.Fatalf("Expected recovery to be refused")
+	}
+	o = getCluster()
+	if cond := getCondition(&o.Status, stanv1alpha1.ClusterQuorumRecovery); cond == nil || cond.Reason != "Refused" || !strings.Contains(cond.Message, "set the annotation to the node") {
+		t.Errorf("Expected refused condition, got: %+v", cond)
+	}
+}
+
+func TestMostRecentRaftState(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		message  string
+		expected string
+		err      string
+	}{
+		{"none", "", "", "no node has a Raft log"},
+		{"term", "stan-1 2 900\nstan-2 3 100\n", "stan-2", ""},
+		{"index", "stan-1 3 120\nstan-2 3 100\n", "stan-1", ""},
+		{"tie", "stan-1 3 120\nstan-2 3 120\nstan-3 2 900\n", "", "stan-1, stan-2 have the same last entry at term 3 and index 120"},
+		{"unreadable", "stan-1 3 120\nstan-2 unreadable: truncated page\n", "", "stan-2 cannot be read: truncated page"},
+		{"unparsable", "stan-1 3 120\nstan-2\n", "", "stan-2 cannot be read"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			best, err := mostRecentRaftState(parseRaftStates(tc.message))
+			var got string
+			if best != nil {
+				got = best.node
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %q, got: %q", tc.expected, got)
+			}
+			if tc.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("Expected error with %q, got: %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// restoreVolumeName is the volume of the restore init
+	// container with the source PersistentVolumeClaim.
+	restoreVolumeName = "stan-restore-source"
+
+	// restoreMountPath is where the source PersistentVolumeClaim
+	// is mounted in the restore init container.
+	restoreMountPath = "/restore"
+)
+
+func validateRestoreSource(o *stanv1alpha1.NatsStreamingCluster) error {
+	rs := o.Spec.RestoreFrom
+	if err := validateBackupTarget(&rs.Source); err != nil {
+		return fmt.Errorf("restoreFrom.source: %s", err)
+	}
+	if rs.Archive == "" || strings.Contains(rs.Archive, "/") {
+		return fmt.Errorf("restoreFrom.archive has to be the name of a snapshot, got %q", rs.Archive)
+	}
+	if _, _, err := storePaths(o, ""); err != nil {
+		return fmt.Errorf("restoreFrom: %s", err)
+	}
+	return nil
+}
+
+// restoreScript fills the store directory of a node from the
+// snapshot in case it does not exist yet.  The Raft log of the
+// snapshot is left out so that the cluster is formed again from
+// the restored stores.  The checksums in the SHA256SUMS manifest
+// of the snapshot are verified before anything is moved in place.
+func restoreScript(o *stanv1alpha1.NatsStreamingCluster, node string) string {
+	rs := o.Spec.RestoreFrom
+	storeDir, paths, _ := storePaths(o, node)
+	dir := path.Join(storeDir, paths[0])
+	work := path.Join(storeDir, fmt.Sprintf(".restore-%s", node))
+
+	archive := path.Join(work, rs.Archive)
+	if pvc := rs.Source.PersistentVolumeClaim; pvc != nil {
+		archive = path.Join(restoreMountPath, pvc.Path, rs.Archive)
+	}
+
+	lines := []string{
+		"set -e",
+		fmt.Sprintf("if [ -e %s ]; then echo 'Store already present, skipping restore'; exit 0; fi", shellQuote(dir)),
+		fmt.Sprintf("rm -rf %s && mkdir -p %s/data", shellQuote(work), shellQuote(work)),
+	}
+	if s3 := rs.Source.S3; s3 != nil {
+		mc := mcCommand(s3)
+		key := path.Join(s3.Bucket, s3.Prefix+rs.Archive)
+		lines = append(lines,
+			fmt.Sprintf(`%s alias set source "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY"`, mc),
+			fmt.Sprintf("%s cp %s %s", mc, shellQuote("source/"+key), shellQuote(archive)),
+		)
+	}
+	lines = append(lines,
+		fmt.Sprintf("tar -xzf %s -C %s/data", shellQuote(archive), shellQuote(work)),
+		fmt.Sprintf("if [ -e %s/data/SHA256SUMS ]; then", shellQuote(work)),
+		fmt.Sprintf("  (cd %s/data && sha256sum -c SHA256SUMS > /dev/null) || { echo 'Corrupted snapshot %s'; exit 1; }", shellQuote(work), rs.Archive),
+		fmt.Sprintf("  rm %s/data/SHA256SUMS", shellQuote(work)),
+		"fi",
+		fmt.Sprintf("src=$(ls %s/data | grep -v '^raft$' | head -n 1)", shellQuote(work)),
+		fmt.Sprintf(`if [ -z "$src" ]; then echo 'No store in snapshot %s'; exit 1; fi`, rs.Archive),
+		fmt.Sprintf(`if [ ! -e %s ]; then mv %s/data/"$src" %s; fi`, shellQuote(dir), shellQuote(work), shellQuote(dir)),
+	)
+	if isClustered(o) {
+		lines = append(lines, fmt.Sprintf("rm -rf %s", shellQuote(path.Join(storeDir, "raft", node))))
+	}
+	lines = append(lines, fmt.Sprintf("rm -rf %s", shellQuote(work)))
+	return strings.Join(lines, "\n")
+}
+
+// applyRestore adds the init container that restores the store
+// of the node from a snapshot before the server starts.  Only the
+// nodes created before the cluster is formed restore it, the ones
+// added to a Raft group later get the state from its leader.
+func applyRestore(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) {
+	rs := o.Spec.RestoreFrom
+	if rs == nil || o.Status.Bootstrapped {
+		return
+	}
+	storeDir, _, err := storePaths(o, pod.Name)
+	if err != nil {
+		return
+	}
+	_, mounts := storeVolumes(pod, storeDir)
+
+	image := rs.Image
+	if image == "" {
+		image = DefaultBackupImage
+	}
+	container := k8scorev1.Container{
+		Name:    "stan-restore",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", restoreScript(o, pod.Name)},
+		Env: []k8scorev1.EnvVar{
+			{Name: "HOME", Value: "/tmp"},
+		},
+		VolumeMounts: mounts,
+	}
+	if pvc := rs.Source.PersistentVolumeClaim; pvc != nil {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, k8scorev1.Volume{
+			Name: restoreVolumeName,
+			VolumeSource: k8scorev1.VolumeSource{
+				PersistentVolumeClaim: &k8scorev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvc.ClaimName,
+					ReadOnly:  true,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, k8scorev1.VolumeMount{
+			Name:      restoreVolumeName,
+			MountPath: restoreMountPath,
+			ReadOnly:  true,
+		})
+	}
+	if s3 := rs.Source.S3; s3 != nil {
+		container.Env = append(container.Env, s3EnvVars(s3)...)
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+)
+
+func TestRestoreFrom(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Spec.RestoreFrom = &stanv1alpha1.RestoreSource{
+		Source: stanv1alpha1.BackupTarget{
+			S3: &stanv1alpha1.S3BackupTarget{
+				Endpoint:          "http://minio:9000",
+				Bucket:            "backups",
+				Prefix:            "stan/",
+				CredentialsSecret: "minio-credentials",
+			},
+		},
+		Archive: "stan-backup.tar.gz",
+	}
+	if err := validateCluster(o); err != nil {
+		t.Fatal(err)
+	}
+
+	pod := newStanNodePod(o, "stan-2")
+	if len(pod.Spec.InitContainers) != 1 {
+		t.Fatalf("Expected restore init container, got: %+v", pod.Spec.InitContainers)
+	}
+	init := pod.Spec.InitContainers[0]
+	if len(init.VolumeMounts) != 1 || init.VolumeMounts[0].MountPath != "/pv" || init.VolumeMounts[0].ReadOnly {
+		t.Errorf("Expected store volume to be mounted, got: %+v", init.VolumeMounts)
+	}
+	script := init.Command[2]
+	for _, expected := range []string{
+		`if [ -e '/pv/stan/stan-2' ]; then`,
+		`mc cp 'source/backups/stan/stan-backup.tar.gz' '/pv/stan/.restore-stan-2/stan-backup.tar.gz'`,
+		`tar -xzf '/pv/stan/.restore-stan-2/stan-backup.tar.gz' -C '/pv/stan/.restore-stan-2'/data`,
+		`(cd '/pv/stan/.restore-stan-2'/data && sha256sum -c SHA256SUMS > /dev/null)`,
+		`mv '/pv/stan/.restore-stan-2'/data/"$src" '/pv/stan/stan-2'`,
+		`rm -rf '/pv/stan/raft/stan-2'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script, got:\n%s", expected, script)
+		}
+	}
+
+	// The snapshot is neither part of the spec hash nor restored
+	// once the cluster is formed.
+	hash := pod.Annotations[PodSpecHashAnnotation]
+	restore := o.Spec.RestoreFrom
+	o.Spec.RestoreFrom = nil
+	if newStanNodePod(o, "stan-2").Annotations[PodSpecHashAnnotation] != hash {
+		t.Errorf("Expected the restore not to be part of the spec hash")
+	}
+	o.Spec.RestoreFrom = restore
+	o.Status.Bootstrapped = true
+	if pod := newStanNodePod(o, "stan-2"); len(pod.Spec.InitContainers) != 0 || pod.Annotations[PodSpecHashAnnotation] != hash {
+		t.Errorf("Expected no restore once the cluster is formed, got: %+v", pod.Spec.InitContainers)
+	}
+	o.Status.Bootstrapped = false
+
+	o.Spec.RestoreFrom.Archive = "../stan-backup.tar.gz"
+	if err := validateCluster(o); err == nil {
+		t.Errorf("Expected invalid archive to fail validation")
+	}
+	o.Spec.RestoreFrom.Archive = "stan-backup.tar.gz"
+	o.Spec.Config.StoreDir = ""
+	if err := validateCluster(o); err == nil {
+		t.Errorf("Expected restore without a store directory to fail validation")
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// podUpdateTimeout is how long a step of the update of a pod can
+// take before moving on, same as it was when waiting in place.
+const podUpdateTimeout = 5 * time.Minute
+
+func updateStrategyType(o *stanv1alpha1.NatsStreamingCluster) stanv1alpha1.UpdateStrategyType {
+	if o.Spec.UpdateStrategy == nil || o.Spec.UpdateStrategy.Type == "" {
+		return stanv1alpha1.RollingUpdateStrategyType
+	}
+	return o.Spec.UpdateStrategy.Type
+}
+
+// updatePartition is the lowest ordinal of the pods to update,
+// counted from zero as in a StatefulSet, while the names of the
+// pods count from one.  A partition of 2 only updates the pods
+// from stan-3 on.
+func updatePartition(o *stanv1alpha1.NatsStreamingCluster) int {
+	if s := o.Spec.UpdateStrategy; s != nil && s.RollingUpdate != nil && s.RollingUpdate.Partition != nil {
+		return int(*s.RollingUpdate.Partition)
+	}
+	return 0
+}
+
+// maxUnavailable is how many pods can be unavailable at
+// once during an update, at least one.  In clustered mode it is
+// capped so that the nodes left keep the quorum of the Raft group,
+// since the pods are deleted directly rather than evicted, which
+// would be checked against the PodDisruptionBudget.
+func maxUnavailable(o *stanv1alpha1.NatsStreamingCluster, pods int) int {
+	if updateStrategyType(o) == stanv1alpha1.RecreateStrategyType {
+		return pods
+	}
+	s := o.Spec.UpdateStrategy
+	if s == nil || s.RollingUpdate == nil || s.RollingUpdate.MaxUnavailable == nil {
+		return 1
+	}
+	n, err := k8sintstr.GetValueFromIntOrPercent(s.RollingUpdate.MaxUnavailable, int(o.Spec.Size), false)
+	if err != nil {
+		return 1
+	}
+	if isClustered(o) {
+		if limit := int(o.Spec.Size - quorumSize(o.Spec.Size)); n > limit {
+			n = limit
+		}
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// reconcilePodTemplate updates the pods with an outdated spec
+// according to the update strategy of the cluster.  Rather than
+// waiting for each pod, the state of the updates is persisted in
+// the status of the cluster and advanced a step on each
+// reconciliation, so that other clusters are not held back and
+// updates are resumed after a restart of the operator.
+func (c *Controller) reconcilePodTemplate(o *stanv1alpha1.NatsStreamingCluster) error {
+	// The cached cluster may predate the last update of the status,
+	// which would forget the updates in progress, so always get the
+	// latest one.
+	current, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters(o.Namespace).Get(o.Name, k8smetav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var updates []stanv1alpha1.UpdateStatus
+	updating := make(map[string]bool)
+	for i := range current.Status.Updates {
+		next, err := c.advancePodUpdate(o, &current.Status.Updates[i])
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			updates = append(updates, *next)
+			updating[next.Pod] = true
+		}
+	}
+
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// Update the pods in order, starting from the highest ordinal.
+	sort.Slice(pods, func(i, j int) bool {
+		return podOrdinal(o, pods[i]) > podOrdinal(o, pods[j])
+	})
+
+	// In FT mode the standby servers are updated before the active
+	// one, so that it only fails over once, to an updated standby.
+	var active string
+	if ft := o.Status.FaultTolerance; ft != nil && isFTMode(o) {
+		active = ft.Active
+		sort.SliceStable(pods, func(i, j int) bool {
+			return pods[i].Name != active && pods[j].Name == active
+		})
+	}
+
+	// The nodes without a running pod are unavailable as well, be
+	// they stopped by a backup, being deleted or without a record
+	// of their update.
+	unavailable := len(updating)
+	running := make(map[string]bool)
+	for _, pod := range pods {
+		running[pod.Name] = true
+		if !updating[pod.Name] && !podIsReady(pod) {
+			unavailable++
+		}
+	}
+	for i := 1; i <= int(o.Spec.Size); i++ {
+		name := fmt.Sprintf("%s-%d", o.Name, i)
+		if !running[name] && !updating[name] {
+			unavailable++
+		}
+	}
+
+	strategy := updateStrategyType(o)
+	partition := updatePartition(o)
+	limit := maxUnavailable(o, len(pods))
+	for _, pod := range pods {
+		if updating[pod.Name] {
+			continue
+		}
+		desired := newStanNodePod(o, pod.Name)
+		desiredHash := desired.Annotations[PodSpecHashAnnotation]
+		currentHash, ok := pod.Annotations[PodSpecHashAnnotation]
+		if !ok {
+			// Pods created before the hash was recorded are adopted
+			// as they are unless their image has to be changed.
+			if pod.Spec.Containers[0].Image == desired.Spec.Containers[0].Image {
+				if err := c.adoptPod(pod, desiredHash); err != nil {
+					log.Errorf("Failed to record spec hash of pod '%s/%s': %v", o.Namespace, pod.Name, err)
+				}
+				continue
+			}
+		}
+		if currentHash == desiredHash {
+			continue
+		}
+
+		if strategy == stanv1alpha1.OnDeleteStrategyType {
+			log.Debugf("Pod '%s/%s' is outdated, waiting for it to be deleted", o.Namespace, pod.Name)
+			continue
+		}
+		if podOrdinal(o, pod)-1 < partition {
+			continue
+		}
+		if pod.Name == active && len(updates) > 0 {
+			log.Debugf("Waiting for the standbys of '%s/%s' cluster to be updated before the active pod %s", o.Namespace, o.Name, pod.Name)
+			continue
+		}
+
+		// Updating a pod that is not ready does not make the
+		// cluster any less available.
+		if podIsReady(pod) {
+			if unavailable >= limit {
+				continue
+			}
+			unavailable++
+		}
+
+		currentImage := pod.Spec.Containers[0].Image
+		desiredImage := desired.Spec.Containers[0].Image
+		if desiredImage != currentImage {
+			log.Infof("Reconciling image '%s' in pod '%s/%s' with '%s'", currentImage, o.Namespace, pod.Name, desiredImage)
+		} else {
+			log.Infof("Reconciling spec of pod '%s/%s' (hash=%s/%s)", o.Namespace, pod.Name, currentHash, desiredHash)
+		}
+		update, err := c.startPodUpdate(o, pod, desiredHash)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, *update)
+	}
+
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.Updates = updates
+	})
+}
+
+// startPodUpdate deletes an outdated pod and returns its update.
+func (c *Controller) startPodUpdate(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod, hash string) (*stanv1alpha1.UpdateStatus, error) {
+	err := c.kc.CoreV1().Pods(o.Namespace).Delete(pod.Name, k8sDeleteInBackground())
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	return &stanv1alpha1.UpdateStatus{
+		Pod:            pod.Name,
+		PodUID:         string(pod.UID),
+		Hash:           hash,
+		Phase:          stanv1alpha1.UpdatePhaseDeleting,
+		PhaseStartTime: k8smetav1.Now(),
+	}, nil
+}
+
+// advancePodUpdate moves the update of a pod a step forward once
+// the outdated pod is gone and once the recreated pod is ready.
+// It returns nil once the update of the pod is done.
+func (c *Controller) advancePodUpdate(o *stanv1alpha1.NatsStreamingCluster, update *stanv1alpha1.UpdateStatus) (*stanv1alpha1.UpdateStatus, error) {
+	pod, err := c.kc.CoreV1().Pods(o.Namespace).Get(update.Pod, k8smetav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	timedOut := time.Since(update.PhaseStartTime.Time) > podUpdateTimeout
+
+	switch update.Phase {
+	case stanv1alpha1.UpdatePhaseDeleting:
+		if exists && string(pod.UID) == update.PodUID {
+			if !timedOut {
+				log.Debugf("Waiting for deletion of pod '%s/%s'", o.Namespace, update.Pod)
+				return update, nil
+			}
+			log.Errorf("Problem waiting for deletion of pod '%s/%s': timed out", o.Namespace, update.Pod)
+			return nil, nil
+		}
+
+		// The pod may have been recreated already by the
+		// reconciliation of the size of the cluster.
+		if !exists {
+			if _, err := c.recreatePod(o, update.Pod); err != nil {
+				// Let size reconciliation fix it later.
+				return nil, nil
+			}
+		}
+		next := update.DeepCopy()
+		next.Phase = stanv1alpha1.UpdatePhaseWaitingReady
+		next.PhaseStartTime = k8smetav1.Now()
+		return next, nil
+
+	case stanv1alpha1.UpdatePhaseWaitingReady:
+		if exists && podIsReady(pod) {
+			log.Infof("Updated pod '%s/%s'", o.Namespace, update.Pod)
+			return nil, nil
+		}
+		if timedOut {
+			log.Warnf("Problem waiting for pod '%s/%s' to come back: timed out", o.Namespace, update.Pod)
+			return nil, nil
+		}
+		log.Debugf("Pod '%s/%s' not up yet", o.Namespace, update.Pod)
+		return update, nil
+	}
+
+	log.Warnf("Discarding update of pod '%s/%s' with unknown phase %q", o.Namespace, update.Pod, update.Phase)
+	return nil, nil
+}
+
+// podIsReady returns whether the NATS Streaming container of a pod is ready.
+func podIsReady(pod *k8scorev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != k8scorev1.PodRunning {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == "stan" {
+			return status.Ready
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestReconcilePodTemplateAdoptsPods(t *testing.T) {
+	o := newTestCluster("stan", 1, &stanv1alpha1.ServerConfig{})
+	legacy := newStanNodePod(o, "stan-1")
+	delete(legacy.Annotations, PodSpecHashAnnotation)
+	c := newTestController([]k8sruntime.Object{o}, legacy)
+
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	pod, err := c.kc.CoreV1().Pods("default").Get("stan-1", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Annotations[PodSpecHashAnnotation] != newStanNodePod(o, "stan-1").Annotations[PodSpecHashAnnotation] {
+		t.Errorf("Expected spec hash to be recorded on the existing pod, got: %v", pod.Annotations)
+	}
+}
+
+func TestReconcilePodTemplateRollingUpdate(t *testing.T) {
+	o := newTestCluster("stan", 1, &stanv1alpha1.ServerConfig{})
+	outdated := newStanNodePod(o, "stan-1")
+	outdated.UID = "outdated"
+	outdated.Annotations[PodSpecHashAnnotation] = "outdated"
+	c := newTestController([]k8sruntime.Object{o}, outdated)
+
+	getCluster := func() *stanv1alpha1.NatsStreamingCluster {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// Each reconciliation advances a single step without blocking.
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	o = getCluster()
+	if len(o.Status.Updates) != 1 || o.Status.Updates[0].Phase != stanv1alpha1.UpdatePhaseDeleting || o.Status.Updates[0].Pod != "stan-1" {
+		t.Fatalf("Expected pod to be deleted, got: %+v", o.Status.Updates)
+	}
+
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	o = getCluster()
+	if len(o.Status.Updates) != 1 || o.Status.Updates[0].Phase != stanv1alpha1.UpdatePhaseWaitingReady {
+		t.Fatalf("Expected pod to be recreated, got: %+v", o.Status.Updates)
+	}
+	pod, err := c.kc.CoreV1().Pods("default").Get("stan-1", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Annotations[PodSpecHashAnnotation] != o.Status.Updates[0].Hash {
+		t.Errorf("Expected pod to be recreated with the desired spec")
+	}
+
+	// Not ready yet.
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	if o = getCluster(); len(o.Status.Updates) != 1 {
+		t.Fatalf("Expected update to wait for the pod to be ready")
+	}
+
+	pod.Status.Phase = k8scorev1.PodRunning
+	pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{Name: "stan", Ready: true}}
+	if _, err := c.kc.CoreV1().Pods("default").Update(pod); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcilePodTemplate(o); err != nil {
+		t.Fatal(err)
+	}
+	if o = getCluster(); len(o.Status.Updates) != 0 {
+		t.Fatalf("Expected update to be done, got: %+v", o.Status.Updates)
+	}
+}
+
+func TestUpdateStrategies(t *testing.T) {
+	newOutdatedPods := func(o *stanv1alpha1.NatsStreamingCluster) []k8sruntime.Object {
+		var pods []k8sruntime.Object
+		for i := 1; i <= int(o.Spec.Size); i++ {
+			pod := newStanNodePod(o, fmt.Sprintf("%s-%d", o.Name, i))
+			pod.UID = k8stypes.UID(pod.Name)
+			pod.Annotations[PodSpecHashAnnotation] = "outdated"
+			pod.Status.Phase = k8scorev1.PodRunning
+			pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{Name: "stan", Ready: true}}
+			pods = append(pods, pod)
+		}
+		return pods
+	}
+	updatingPods := func(c *Controller) []string {
+		result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, u := range result.Status.Updates {
+			names = append(names, u.Pod)
+		}
+		return names
+	}
+	maxTwo := k8sintstr.FromInt(2)
+	maxFour := k8sintstr.FromInt(4)
+	partition := int32(4)
+
+	for _, tc := range []struct {
+		name     string
+		strategy *stanv1alpha1.UpdateStrategy
+		expected []string
+	}{
+		{"default", nil, []string{"stan-5"}},
+		{"on delete", &stanv1alpha1.UpdateStrategy{Type: stanv1alpha1.OnDeleteStrategyType}, nil},
+		{"recreate", &stanv1alpha1.UpdateStrategy{Type: stanv1alpha1.RecreateStrategyType}, []string{"stan-5", "stan-4", "stan-3", "stan-2", "stan-1"}},
+		{"max unavailable", &stanv1alpha1.UpdateStrategy{
+			RollingUpdate: &stanv1alpha1.RollingUpdateStrategy{MaxUnavailable: &maxTwo},
+		}, []string{"stan-5", "stan-4"}},
+		{"max unavailable above quorum", &stanv1alpha1.UpdateStrategy{
+			RollingUpdate: &stanv1alpha1.RollingUpdateStrategy{MaxUnavailable: &maxFour},
+		}, []string{"stan-5", "stan-4"}},
+		{"partition", &stanv1alpha1.UpdateStrategy{
+			RollingUpdate: &stanv1alpha1.RollingUpdateStrategy{MaxUnavailable: &maxTwo, Partition: &partition},
+		}, []string{"stan-5"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestCluster("stan", 5, &stanv1alpha1.ServerConfig{})
+			o.Spec.UpdateStrategy = tc.strategy
+			c := newTestController([]k8sruntime.Object{o}, newOutdatedPods(o)...)
+			if err := c.reconcilePodTemplate(o); err != nil {
+				t.Fatal(err)
+			}
+			if got := updatingPods(c); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v to be updated, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRollingUpdateCountsStoppedNodes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		prepare func(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) *k8scorev1.Pod
+	}{
+		{"stopped by a backup", func(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) *k8scorev1.Pod {
+			o.Status.BackupNodes = []stanv1alpha1.BackupNode{{Name: pod.Name, Backup: "daily"}}
+			return nil
+		}},
+		{"terminating", func(o *stanv1alpha1.NatsStreamingCluster, pod *k8scorev1.Pod) *k8scorev1.Pod {
+			now := k8smetav1.Now()
+			pod.DeletionTimestamp = &now
+			return pod
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+			var pods []k8sruntime.Object
+			for i := 1; i <= 3; i++ {
+				pod := newStanNodePod(o, fmt.Sprintf("stan-%d", i))
+				pod.UID = k8stypes.UID(pod.Name)
+				pod.Annotations[PodSpecHashAnnotation] = "outdated"
+				pod.Status.Phase = k8scorev1.PodRunning
+				pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{Name: "stan", Ready: true}}
+				if i == 2 {
+					if pod = tc.prepare(o, pod); pod == nil {
+						continue
+					}
+				}
+				pods = append(pods, pod)
+			}
+			c := newTestController([]k8sruntime.Object{o}, pods...)
+			if err := c.reconcilePodTemplate(o); err != nil {
+				t.Fatal(err)
+			}
+			result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Status.Updates) != 0 {
+				t.Errorf("Expected no other node to be stopped while stan-2 is, got: %+v", result.Status.Updates)
+			}
+		})
+	}
+}
+
+func TestReconcilePodTemplateStaleCluster(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	var pods []k8sruntime.Object
+	for i := 1; i <= 3; i++ {
+		pod := newStanNodePod(o, fmt.Sprintf("stan-%d", i))
+		pod.UID = k8stypes.UID(pod.Name)
+		pod.Annotations[PodSpecHashAnnotation] = "outdated"
+		pod.Status.Phase = k8scorev1.PodRunning
+		pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{{Name: "stan", Ready: true}}
+		if i == 3 {
+			now := k8smetav1.Now()
+			pod.DeletionTimestamp = &now
+		}
+		pods = append(pods, pod)
+	}
+	stale := o.DeepCopy()
+	// The last update of the status is not in the cache yet.
+	o.Status.Updates = []stanv1alpha1.UpdateStatus{{
+		Pod:            "stan-3",
+		PodUID:         "stan-3",
+		Phase:          stanv1alpha1.UpdatePhaseDeleting,
+		PhaseStartTime: k8smetav1.Now(),
+	}}
+	c := newTestController([]k8sruntime.Object{o}, pods...)
+
+	if err := c.reconcilePodTemplate(stale); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Status.Updates) != 1 || result.Status.Updates[0].Pod != "stan-3" {
+		t.Errorf("Expected the update of the terminating stan-3 to be kept, got: %+v", result.Status.Updates)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+	k8sretry "k8s.io/client-go/util/retry"
+)
+
+// scheduleLabel is the label of the backups and jobs of a
+// schedule, with the name of the schedule.
+const scheduleLabel = "stan_backup_schedule"
+
+func (c *Controller) processBackupSchedule(ctx context.Context, v interface{}) error {
+	s := v.(*stanv1alpha1.NatsStreamingBackupSchedule)
+	if s.DeletionTimestamp != nil {
+		c.deleteScheduleMetrics(s)
+		return nil
+	}
+	return c.reconcileBackupSchedule(s, time.Now().UTC())
+}
+
+func (c *Controller) processBackupScheduleDelete(ctx context.Context, v interface{}) error {
+	if s, ok := v.(*stanv1alpha1.NatsStreamingBackupSchedule); ok {
+		c.deleteScheduleMetrics(s)
+	}
+	return nil
+}
+
+func scheduleOwnerRef(s *stanv1alpha1.NatsStreamingBackupSchedule) k8smetav1.OwnerReference {
+	return *k8smetav1.NewControllerRef(s, k8sschema.GroupVersionKind{
+		Group:   stanv1alpha1.SchemeGroupVersion.Group,
+		Version: stanv1alpha1.SchemeGroupVersion.Version,
+		Kind:    "NatsStreamingBackupSchedule",
+	})
+}
+
+func scheduleMetricLabels(s *stanv1alpha1.NatsStreamingBackupSchedule) map[string]string {
+	return map[string]string{
+		"namespace": s.Namespace,
+		"schedule":  s.Name,
+		"cluster":   s.Spec.Backup.ClusterName,
+	}
+}
+
+func (c *Controller) deleteScheduleMetrics(s *stanv1alpha1.NatsStreamingBackupSchedule) {
+	labels := scheduleMetricLabels(s)
+	c.metrics.delete(metricBackupLastSuccess, labels)
+	c.metrics.delete(metricBackupLastFailure, labels)
+	c.metrics.delete(metricBackupNextRun, labels)
+}
+
+func validateBackupSchedule(s *stanv1alpha1.NatsStreamingBackupSchedule) (*cronSchedule, error) {
+	sched, err := parseCron(s.Spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("schedule: %s", err)
+	}
+	if s.Spec.Backup.ClusterName == "" {
+		return nil, fmt.Errorf("backup: clusterName is required")
+	}
+	if err := validateBackupTarget(&s.Spec.Backup.Target); err != nil {
+		return nil, fmt.Errorf("backup: %s", err)
+	}
+	if r := s.Spec.Retention; r != nil {
+		if r.KeepLast < 0 {
+			return nil, fmt.Errorf("retention: keepLast must not be negative, got %d", r.KeepLast)
+		}
+		if r.MaxAge != "" {
+			if d, err := time.ParseDuration(r.MaxAge); err != nil || d <= 0 {
+				return nil, fmt.Errorf("retention: invalid maxAge %q", r.MaxAge)
+			}
+		}
+	}
+	return sched, nil
+}
+
+// scheduledBackupName is the name of the backup scheduled at a
+// given time, so that a backup is never taken twice for a time.
+func scheduledBackupName(s *stanv1alpha1.NatsStreamingBackupSchedule, t time.Time) string {
+	return fmt.Sprintf("%s-%s", s.Name, t.UTC().Format("200601021504"))
+}
+
+func newScheduledBackup(s *stanv1alpha1.NatsStreamingBackupSchedule, t time.Time) *stanv1alpha1.NatsStreamingBackup {
+	return &stanv1alpha1.NatsStreamingBackup{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "NatsStreamingBackup",
+			APIVersion: stanv1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:            scheduledBackupName(s, t),
+			Namespace:       s.Namespace,
+			Labels:          map[string]string{scheduleLabel: s.Name},
+			OwnerReferences: []k8smetav1.OwnerReference{scheduleOwnerRef(s)},
+		},
+		Spec: *s.Spec.Backup.DeepCopy(),
+	}
+}
+
+// scheduledBackups returns the backups of a schedule, newest first.
+func (c *Controller) scheduledBackups(s *stanv1alpha1.NatsStreamingBackupSchedule) ([]stanv1alpha1.NatsStreamingBackup, error) {
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups(s.Namespace).List(k8smetav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(map[string]string{scheduleLabel: s.Name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	backups := result.Items
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+func backupFinished(b *stanv1alpha1.NatsStreamingBackup) bool {
+	return b.Status.Phase == stanv1alpha1.BackupCompleted || b.Status.Phase == stanv1alpha1.BackupFailed
+}
+
+// backupExpired returns whether a completed backup is past the
+// retention of its schedule, given the number of newer completed
+// ones.  The newest completed backup is always kept, so that there
+// is one to restore from even when the later ones failed.
+func backupExpired(r *stanv1alpha1.BackupRetention, b *stanv1alpha1.NatsStreamingBackup, newer int, now time.Time) bool {
+	if r == nil || newer == 0 {
+		return false
+	}
+	if r.KeepLast > 0 && newer >= int(r.KeepLast) {
+		return true
+	}
+	if r.MaxAge != "" && b.Status.CompletionTime != nil {
+		maxAge, _ := time.ParseDuration(r.MaxAge)
+		return now.Sub(b.Status.CompletionTime.Time) > maxAge
+	}
+	return false
+}
+
+// pruneScript deletes the archive of a backup from its target.
+func pruneScript(b *stanv1alpha1.NatsStreamingBackup) string {
+	target := b.Spec.Target
+	if pvc := target.PersistentVolumeClaim; pvc != nil {
+		return fmt.Sprintf("rm -f %s", shellQuote(path.Join(backupMountPath, pvc.Path, backupArchiveName(b))))
+	}
+	mc := mcCommand(target.S3)
+	key := path.Join(target.S3.Bucket, target.S3.Prefix+backupArchiveName(b))
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf(`%s alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY"`, mc),
+		fmt.Sprintf("%s rm %s", mc, shellQuote("target/"+key)),
+	}, "\n")
+}
+
+func pruneLabels(s *stanv1alpha1.NatsStreamingBackupSchedule, b *stanv1alpha1.NatsStreamingBackup) map[string]string {
+	return map[string]string{
+		"app":         "nats-streaming-prune",
+		"stan_backup": b.Name,
+		scheduleLabel: s.Name,
+	}
+}
+
+// pruneBackup deletes the archive of a backup with a job owned
+// by the schedule, then deletes the backup itself.
+func (c *Controller) pruneBackup(s *stanv1alpha1.NatsStreamingBackupSchedule, b *stanv1alpha1.NatsStreamingBackup) error {
+	log.Infof("Pruning backup '%s/%s' of schedule %s", b.Namespace, b.Name, s.Name)
+	if b.Status.Job != "" {
+		job := newTargetJob(k8smetav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-prune", b.Name),
+			Namespace:       b.Namespace,
+			Labels:          pruneLabels(s, b),
+			OwnerReferences: []k8smetav1.OwnerReference{scheduleOwnerRef(s)},
+		}, b.Spec.Image, &b.Spec.Target, pruneScript(b), nil, nil)
+		_, err := c.kc.BatchV1().Jobs(b.Namespace).Create(job)
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	err := c.ncr.StreamingV1alpha1().NatsStreamingBackups(b.Namespace).Delete(b.Name, &k8smetav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// cleanupPruneJobs deletes the prune jobs of a schedule that are
+// done, the ones that failed leave the archive of their backup in
+// place.
+func (c *Controller) cleanupPruneJobs(s *stanv1alpha1.NatsStreamingBackupSchedule) error {
+	jobs, err := c.kc.BatchV1().Jobs(s.Namespace).List(k8smetav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(map[string]string{
+			"app":         "nats-streaming-prune",
+			scheduleLabel: s.Name,
+		}).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs.Items {
+		failed, message := jobFailed(&job)
+		if job.Status.Succeeded == 0 && !failed {
+			continue
+		}
+		if failed {
+			log.Warnf("Prune job '%s/%s' of schedule %s failed, the archive of backup %s may be left in place: %s",
+				job.Namespace, job.Name, s.Name, job.Labels["stan_backup"], message)
+		}
+		err := c.kc.BatchV1().Jobs(s.Namespace).Delete(job.Name, k8sDeleteInBackground())
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileBackupSchedule takes the backup that is due, if any,
+// prunes the expired ones and records the results in the status.
+// Missed runs are not caught up on, only the latest one is taken.
+func (c *Controller) reconcileBackupSchedule(s *stanv1alpha1.NatsStreamingBackupSchedule, now time.Time) error {
+	sched, err := validateBackupSchedule(s)
+	if err != nil {
+		log.Errorf("Invalid spec for '%s/%s' backup schedule: %s", s.Namespace, s.Name, err)
+		return c.updateScheduleStatus(s, func(status *stanv1alpha1.NatsStreamingBackupScheduleStatus) {
+			status.Message = fmt.Sprintf("invalid spec: %s", err)
+		})
+	}
+
+	backups, err := c.scheduledBackups(s)
+	if err != nil {
+		return err
+	}
+	var lastSuccess, lastFailure *k8smetav1.Time
+	var completed, finished int
+	for i := range backups {
+		b := &backups[i]
+		if !backupFinished(b) {
+			continue
+		}
+		if t := b.Status.CompletionTime; t != nil {
+			if b.Status.Phase == stanv1alpha1.BackupCompleted && (lastSuccess == nil || lastSuccess.Before(t)) {
+				lastSuccess = t
+			}
+			if b.Status.Phase == stanv1alpha1.BackupFailed && (lastFailure == nil || lastFailure.Before(t)) {
+				lastFailure = t
+			}
+		}
+		// Only the newest failed backup is kept to tell why it
+		// failed, the failed ones do not count towards keepLast.
+		expired := finished > 0
+		if b.Status.Phase == stanv1alpha1.BackupCompleted {
+			expired = backupExpired(s.Spec.Retention, b, completed, now)
+			completed++
+		}
+		finished++
+		if expired {
+			if err := c.pruneBackup(s, b); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.cleanupPruneJobs(s); err != nil {
+		return err
+	}
+
+	// Find the latest run that is due since the last one.
+	last := s.CreationTimestamp.Time
+	if s.Status.LastScheduleTime != nil {
+		last = s.Status.LastScheduleTime.Time
+	}
+	var due time.Time
+	for t := sched.next(last); !t.IsZero() && !t.After(now); t = sched.next(t) {
+		due = t
+	}
+
+	var created string
+	if !due.IsZero() && !s.Spec.Suspend {
+		b := newScheduledBackup(s, due)
+		log.Infof("Creating scheduled backup '%s/%s'", b.Namespace, b.Name)
+		_, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups(s.Namespace).Create(b)
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+		created = b.Name
+	}
+
+	labels := scheduleMetricLabels(s)
+	if next := sched.next(now); !next.IsZero() {
+		c.metrics.set(metricBackupNextRun, labels, float64(next.Unix()))
+	}
+	if lastSuccess != nil {
+		c.metrics.set(metricBackupLastSuccess, labels, float64(lastSuccess.Unix()))
+	}
+	if lastFailure != nil {
+		c.metrics.set(metricBackupLastFailure, labels, float64(lastFailure.Unix()))
+	}
+
+	return c.updateScheduleStatus(s, func(status *stanv1alpha1.NatsStreamingBackupScheduleStatus) {
+		status.Message = ""
+		if !due.IsZero() {
+			// Runs are skipped while suspended, rather than
+			// being taken once the schedule is resumed.
+			status.LastScheduleTime = &k8smetav1.Time{Time: due}
+		}
+		if created != "" {
+			status.LastBackup = created
+		}
+		if lastSuccess != nil {
+			status.LastSuccessTime = lastSuccess
+		}
+		if lastFailure != nil {
+			status.LastFailureTime = lastFailure
+		}
+	})
+}
+
+// updateScheduleStatus applies the changes to the latest status of
+// the schedule, only sending an update in case there was any change.
+func (c *Controller) updateScheduleStatus(
+	s *stanv1alpha1.NatsStreamingBackupSchedule,
+	update func(status *stanv1alpha1.NatsStreamingBackupScheduleStatus),
+) error {
+	schedules := c.ncr.StreamingV1alpha1().NatsStreamingBackupSchedules(s.Namespace)
+	return k8sretry.RetryOnConflict(k8sretry.DefaultRetry, func() error {
+		current, err := schedules.Get(s.Name, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := current.DeepCopy()
+		update(&updated.Status)
+		if reflect.DeepEqual(current, updated) {
+			return nil
+		}
+		_, err = schedules.Update(updated)
+		return err
+	})
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestBackupExpired(t *testing.T) {
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	b := &stanv1alpha1.NatsStreamingBackup{
+		Status: stanv1alpha1.NatsStreamingBackupStatus{
+			Phase:          stanv1alpha1.BackupCompleted,
+			CompletionTime: &k8smetav1.Time{Time: now.Add(-48 * time.Hour)},
+		},
+	}
+	for _, tt := range []struct {
+		retention *stanv1alpha1.BackupRetention
+		newer     int
+		expired   bool
+	}{
+		{nil, 5, false},
+		{&stanv1alpha1.BackupRetention{KeepLast: 2}, 1, false},
+		{&stanv1alpha1.BackupRetention{KeepLast: 2}, 2, true},
+		{&stanv1alpha1.BackupRetention{MaxAge: "24h"}, 1, true},
+		{&stanv1alpha1.BackupRetention{MaxAge: "72h"}, 1, false},
+		// The newest completed backup is never pruned.
+		{&stanv1alpha1.BackupRetention{MaxAge: "24h"}, 0, false},
+	} {
+		if expired := backupExpired(tt.retention, b, tt.newer, now); expired != tt.expired {
+			t.Errorf("Expected expired=%v with %+v and %d newer, got: %v", tt.expired, tt.retention, tt.newer, expired)
+		}
+	}
+}
+
+func TestReconcileBackupSchedule(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 3, 0, 0, 0, time.UTC)
+	}
+	s := &stanv1alpha1.NatsStreamingBackupSchedule{
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:              "nightly",
+			Namespace:         "default",
+			CreationTimestamp: k8smetav1.Time{Time: day(1).Add(-time.Hour)},
+		},
+		Spec: stanv1alpha1.NatsStreamingBackupScheduleSpec{
+			Schedule:  "0 3 * * *",
+			Retention: &stanv1alpha1.BackupRetention{KeepLast: 2},
+			Backup: stanv1alpha1.NatsStreamingBackupSpec{
+				ClusterName: "stan",
+				Target: stanv1alpha1.BackupTarget{
+					S3: &stanv1alpha1.S3BackupTarget{
+						Endpoint:          "http://minio:9000",
+						Bucket:            "backups",
+						CredentialsSecret: "minio-credentials",
+					},
+				},
+			},
+		},
+		Status: stanv1alpha1.NatsStreamingBackupScheduleStatus{
+			LastScheduleTime: &k8smetav1.Time{Time: day(5)},
+		},
+	}
+	newBackup := func(d int, phase stanv1alpha1.BackupPhase) *stanv1alpha1.NatsStreamingBackup {
+		b := newScheduledBackup(s, day(d))
+		b.Status = stanv1alpha1.NatsStreamingBackupStatus{
+			Phase:          phase,
+			Job:            backupJobName(b),
+			CompletionTime: &k8smetav1.Time{Time: day(d).Add(5 * time.Minute)},
+		}
+		return b
+	}
+	c := newTestController([]k8sruntime.Object{
+		s,
+		newBackup(1, stanv1alpha1.BackupCompleted),
+		newBackup(2, stanv1alpha1.BackupCompleted),
+		newBackup(3, stanv1alpha1.BackupFailed),
+		newBackup(4, stanv1alpha1.BackupCompleted),
+		newBackup(5, stanv1alpha1.BackupFailed),
+	})
+
+	now := day(6).Add(30 * time.Minute)
+	if err := c.reconcileBackupSchedule(s, now); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := c.scheduledBackups(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	// Only the completed backups count towards keepLast, and only
+	// the newest failed one is kept.
+	expected := []string{"nightly-202001060300", "nightly-202001050300", "nightly-202001040300", "nightly-202001020300"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected backups %v, got: %v", expected, names)
+	}
+	if backups[0].Spec.ClusterName != "stan" || backups[0].OwnerReferences[0].Name != "nightly" {
+		t.Errorf("Expected backup of the cluster owned by the schedule, got: %+v", backups[0].ObjectMeta)
+	}
+
+	job, err := c.kc.BatchV1().Jobs("default").Get("nightly-202001010300-prune", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected prune job for the oldest backup: %s", err)
+	}
+	script := job.Spec.Template.Spec.Containers[0].Command[2]
+	if !strings.Contains(script, `mc rm 'target/backups/nightly-202001010300.tar.gz'`) {
+		t.Errorf("Expected archive to be removed, got:\n%s", script)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get("nightly-202001030300-prune", k8smetav1.GetOptions{}); err != nil {
+		t.Errorf("Expected prune job for the older failed backup: %s", err)
+	}
+
+	// Finished prune jobs are deleted, including the failed ones.
+	job.Status.Conditions = []k8sbatchv1.JobCondition{{Type: k8sbatchv1.JobFailed, Status: k8scorev1.ConditionTrue}}
+	if _, err := c.kc.BatchV1().Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.cleanupPruneJobs(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get(job.Name, k8smetav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("Expected failed prune job to be deleted, got: %v", err)
+	}
+	if _, err := c.kc.BatchV1().Jobs("default").Get("nightly-202001030300-prune", k8smetav1.GetOptions{}); err != nil {
+		t.Errorf("Expected running prune job to be kept: %s", err)
+	}
+
+	s, err = c.ncr.StreamingV1alpha1().NatsStreamingBackupSchedules("default").Get("nightly", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := s.Status
+	if !status.LastScheduleTime.Time.Equal(day(6)) || status.LastBackup != "nightly-202001060300" {
+		t.Errorf("Expected latest run to be recorded, got: %+v", status)
+	}
+	if !status.LastSuccessTime.Time.Equal(day(4).Add(5*time.Minute)) || !status.LastFailureTime.Time.Equal(day(5).Add(5*time.Minute)) {
+		t.Errorf("Expected latest success and failure to be recorded, got: %+v", status)
+	}
+
+	labels := scheduleMetricLabels(s)
+	for name, expected := range map[string]time.Time{
+		metricBackupNextRun:     day(7),
+		metricBackupLastSuccess: day(4).Add(5 * time.Minute),
+		metricBackupLastFailure: day(5).Add(5 * time.Minute),
+	} {
+		if v, ok := c.metrics.get(name, labels); !ok || int64(v) != expected.Unix() {
+			t.Errorf("Expected %s to be %d, got: %v", name, expected.Unix(), v)
+		}
+	}
+
+	// Nothing is due until the next day, nor while suspended.
+	if err := c.reconcileBackupSchedule(s, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	s.Spec.Suspend = true
+	if err := c.reconcileBackupSchedule(s, day(7).Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = c.scheduledBackups(s); len(backups) != 4 {
+		t.Errorf("Expected no new backup, got: %d", len(backups))
+	}
+
+	var out strings.Builder
+	c.metrics.write(&out)
+	if !strings.Contains(out.String(), `nats_streaming_backup_schedule_next_run_timestamp_seconds{cluster="stan",namespace="default",schedule="nightly"}`) {
+		t.Errorf("Expected next run metric, got:\n%s", out.String())
+	}
+	c.deleteScheduleMetrics(s)
+	if _, ok := c.metrics.get(metricBackupNextRun, labels); ok {
+		t.Errorf("Expected metrics of the schedule to be deleted")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"reflect"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// headlessServiceName is the name of the Service under which
+// each of the nodes has a DNS record.
+func headlessServiceName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-headless", o.Name)
+}
+
+// monitoringServiceName is the name of the Service
+// for the monitoring endpoint of the nodes.
+func monitoringServiceName(o *stanv1alpha1.NatsStreamingCluster) string {
+	return fmt.Sprintf("%s-monitoring", o.Name)
+}
+
+func serviceMonitoringPort(o *stanv1alpha1.NatsStreamingCluster) int32 {
+	if o.Spec.Service != nil && o.Spec.Service.MonitoringPort > 0 {
+		return o.Spec.Service.MonitoringPort
+	}
+	return MonitoringPort
+}
+
+func newStanServices(o *stanv1alpha1.NatsStreamingCluster) []*k8scorev1.Service {
+	var annotations, headlessAnnotations map[string]string
+	if o.Spec.Service != nil {
+		annotations = o.Spec.Service.Annotations
+		headlessAnnotations = o.Spec.Service.HeadlessAnnotations
+	}
+	ports := []k8scorev1.ServicePort{
+		{
+			Name:       "monitoring",
+			Protocol:   k8scorev1.ProtocolTCP,
+			Port:       serviceMonitoringPort(o),
+			TargetPort: k8sintstr.FromInt(MonitoringPort),
+		},
+	}
+
+	headless := &k8scorev1.Service{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:            headlessServiceName(o),
+			Namespace:       o.Namespace,
+			Labels:          clusterLabels(o.Name),
+			Annotations:     headlessAnnotations,
+			OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+		},
+		Spec: k8scorev1.ServiceSpec{
+			ClusterIP: k8scorev1.ClusterIPNone,
+			Selector:  clusterLabels(o.Name),
+			Ports:     ports,
+
+			// Make the records of the nodes available before
+			// they are ready so that they can find each other.
+			PublishNotReadyAddresses: true,
+		},
+	}
+
+	monitoring := &k8scorev1.Service{
+		TypeMeta: k8smetav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:            monitoringServiceName(o),
+			Namespace:       o.Namespace,
+			Labels:          clusterLabels(o.Name),
+			Annotations:     annotations,
+			OwnerReferences: []k8smetav1.OwnerReference{clusterOwnerRef(o)},
+		},
+		Spec: k8scorev1.ServiceSpec{
+			Type:     k8scorev1.ServiceTypeClusterIP,
+			Selector: clusterLabels(o.Name),
+			Ports:    ports,
+		},
+	}
+
+	return []*k8scorev1.Service{headless, monitoring}
+}
+
+// reconcileServices creates the Services of the cluster, and
+// updates them in case the ports or annotations changed.
+func (c *Controller) reconcileServices(o *stanv1alpha1.NatsStreamingCluster) error {
+	svcs := c.kc.CoreV1().Services(o.Namespace)
+	for _, desired := range newStanServices(o) {
+		current, err := svcs.Get(desired.Name, k8smetav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			log.Infof("Creating service '%s/%s'", o.Namespace, desired.Name)
+			_, err := svcs.Create(desired)
+			if err != nil && !k8serrors.IsAlreadyExists(err) {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// Only compare the fields managed by the operator, the rest
+		// of the spec such as the cluster IP is set by Kubernetes.
+		if reflect.DeepEqual(current.Annotations, desired.Annotations) &&
+			reflect.DeepEqual(current.Spec.Selector, desired.Spec.Selector) &&
+			servicePortsEqual(current.Spec.Ports, desired.Spec.Ports) {
+			continue
+		}
+		log.Infof("Updating service '%s/%s'", o.Namespace, desired.Name)
+		current.Annotations = desired.Annotations
+		current.Spec.Selector = desired.Spec.Selector
+		current.Spec.Ports = desired.Spec.Ports
+		if _, err := svcs.Update(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func servicePortsEqual(current, desired []k8scorev1.ServicePort) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	for i := range current {
+		if current[i].Name != desired[i].Name ||
+			current[i].Port != desired[i].Port ||
+			current[i].TargetPort != desired[i].TargetPort {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReconcileServices(t *testing.T) {
+	o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{})
+	c := newTestController([]k8sruntime.Object{o})
+
+	if err := c.reconcileServices(o); err != nil {
+		t.Fatal(err)
+	}
+	headless, err := c.kc.CoreV1().Services("default").Get("stan-headless", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headless.Spec.ClusterIP != k8scorev1.ClusterIPNone {
+		t.Errorf("Expected headless service, got cluster IP %q", headless.Spec.ClusterIP)
+	}
+	if headless.Spec.Selector["stan_cluster"] != "stan" || headless.Spec.Selector["app"] != "nats-streaming" {
+		t.Errorf("Unexpected selector: %v", headless.Spec.Selector)
+	}
+
+	o.Spec.Service = &stanv1alpha1.ServiceConfig{
+		MonitoringPort: 9222,
+		Annotations:    map[string]string{"prometheus.io/scrape": "true"},
+	}
+	if err := c.reconcileServices(o); err != nil {
+		t.Fatal(err)
+	}
+	monitoring, err := c.kc.CoreV1().Services("default").Get("stan-monitoring", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if monitoring.Spec.Ports[0].Port != 9222 || monitoring.Spec.Ports[0].TargetPort.IntValue() != MonitoringPort {
+		t.Errorf("Unexpected ports: %+v", monitoring.Spec.Ports)
+	}
+	if monitoring.Annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("Expected annotations to be updated, got: %v", monitoring.Annotations)
+	}
+
+	pod := newStanPod(o)
+	if pod.Spec.Subdomain != "stan-headless" {
+		t.Errorf("Expected pod under the headless service, got subdomain %q", pod.Spec.Subdomain)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runScraper periodically records the stats of the clusters from
+// the monitoring endpoints of their nodes, until the context is
+// canceled.
+func (c *Controller) runScraper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.scrapeClusters()
+		}
+	}
+}
+
+// scrapeInterval is how often the stats of the clusters are recorded.
+func (c *Controller) scrapeInterval() time.Duration {
+	if c.opts.StatsScrapeInterval > 0 {
+		return c.opts.StatsScrapeInterval
+	}
+	return StatsScrapeInterval
+}
+
+func (c *Controller) scrapeClusters() {
+	c.mu.Lock()
+	clusters := make([]*stanv1alpha1.NatsStreamingCluster, 0, len(c.clusters))
+	for _, o := range c.clusters {
+		clusters = append(clusters, o)
+	}
+	c.mu.Unlock()
+
+	for _, o := range clusters {
+		if err := c.scrapeCluster(o); err != nil {
+			log.Errorf("Error recording stats of '%s/%s' cluster: %v", o.Namespace, o.Name, err)
+		}
+	}
+}
+
+func (c *Controller) scrapeCluster(o *stanv1alpha1.NatsStreamingCluster) error {
+	stats, err := c.clusterStats(o)
+	if err != nil {
+		return err
+	}
+	now := k8smetav1.Now()
+	stats.LastScrapeTime = &now
+	return c.updateStatus(o, func(status *stanv1alpha1.NatsStreamingClusterStatus) {
+		status.Stats = stats
+	})
+}
+
+// servesClients returns whether a server is the one the clients
+// are served by, with the stats of the whole cluster.
+func servesClients(info *serverz) bool {
+	switch info.State {
+	case "CLUSTERED":
+		return info.Role == serverRoleLeader
+	case serverStateFTStandby:
+		return false
+	}
+	return true
+}
+
+// clusterStats summarizes the monitoring endpoints of the nodes.
+// The state of every node is recorded, and the totals are taken
+// from the node serving the clients, if any.
+func (c *Controller) clusterStats(o *stanv1alpha1.NatsStreamingCluster) (*stanv1alpha1.ClusterStats, error) {
+	pods, err := c.findRunningPods(o.Name, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return podOrdinal(o, pods[i]) < podOrdinal(o, pods[j])
+	})
+
+	stats := &stanv1alpha1.ClusterStats{}
+	var serving *serverz
+	servingPod := -1
+	for i, pod := range pods {
+		node := stanv1alpha1.NodeStats{Name: pod.Name}
+		info, err := c.serverInfo(pod)
+		if err != nil {
+			log.Debugf("Could not get the state of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+		} else {
+			node.State = info.State
+			node.Role = info.Role
+			node.Version = info.Version
+			node.Messages = int64(info.TotalMsgs)
+			if serving == nil && servesClients(info) {
+				serving, servingPod = info, i
+			}
+		}
+		stats.Nodes = append(stats.Nodes, node)
+	}
+	if serving == nil {
+		return stats, nil
+	}
+
+	stats.Channels = int32(serving.Channels)
+	stats.Clients = int32(serving.Clients)
+	stats.Subscriptions = int32(serving.Subscriptions)
+	stats.Messages = int64(serving.TotalMsgs)
+	stats.Bytes = int64(serving.TotalBytes)
+
+	pod := pods[servingPod]
+	store := &storez{}
+	if err := c.getMonitoring(pod, "/streaming/storez", store); err != nil {
+		log.Debugf("Could not get the store of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+	} else {
+		stats.StoreType = store.Type
+	}
+	channels := &channelsz{}
+	if err := c.getMonitoring(pod, "/streaming/channelsz?subs=1", channels); err != nil {
+		log.Debugf("Could not get the channels of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+	} else {
+		stats.Channels = int32(channels.Total)
+		for _, channel := range channels.Channels {
+			for _, sub := range channel.Subscriptions {
+				stats.PendingMessages += int64(sub.PendingCount)
+			}
+		}
+	}
+	clients := &clientsz{}
+	if err := c.getMonitoring(pod, "/streaming/clientsz", clients); err != nil {
+		log.Debugf("Could not get the clients of pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+	} else {
+		stats.Clients = int32(clients.Total)
+	}
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	stanfake "github.com/nats-io/nats-streaming-operator/pkg/client/v1alpha1/fake"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScrapeClusterStats(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	c := NewController(&Options{HTTPClient: fakeHTTPClient{
+		"10.0.0.1:8222/streaming/serverz":   `{"cluster_id":"stan","version":"0.18.0","state":"CLUSTERED","role":"Follower","channels":2}`,
+		"10.0.0.2:8222/streaming/serverz":   `{"cluster_id":"stan","version":"0.18.0","state":"CLUSTERED","role":"Leader","clients":4,"subscriptions":5,"channels":2,"total_msgs":100,"total_bytes":2048}`,
+		"10.0.0.2:8222/streaming/storez":    `{"cluster_id":"stan","type":"FILE"}`,
+		"10.0.0.2:8222/streaming/channelsz": `{"cluster_id":"stan","count":3,"total":3,"channels":[{"name":"foo","subscriptions":[{"pending_count":2},{"pending_count":5}]},{"name":"bar"},{"name":"baz","subscriptions":[{"pending_count":1}]}]}`,
+		"10.0.0.2:8222/streaming/clientsz":  `{"cluster_id":"stan","count":4,"total":4}`,
+	}})
+	c.kc = k8sfake.NewSimpleClientset(newTestStorePods(o)...)
+	c.ncr = stanfake.NewSimpleClientset(o)
+	c.clusters[o.UID] = o
+
+	c.scrapeClusters()
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := result.Status.Stats
+	if stats == nil || stats.LastScrapeTime == nil {
+		t.Fatalf("Expected stats in status, got: %+v", stats)
+	}
+	stats.LastScrapeTime = nil
+	expected := &stanv1alpha1.ClusterStats{
+		StoreType:       "FILE",
+		Channels:        3,
+		Clients:         4,
+		Subscriptions:   5,
+		Messages:        100,
+		Bytes:           2048,
+		PendingMessages: 8,
+		Nodes: []stanv1alpha1.NodeStats{
+			{Name: "stan-1", State: "CLUSTERED", Role: "Follower", Version: "0.18.0"},
+			{Name: "stan-2", State: "CLUSTERED", Role: "Leader", Version: "0.18.0", Messages: 100},
+			{Name: "stan-3"},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected stats %+v, got: %+v", expected, stats)
+	}
+}
+
+func TestDeletedClusterNotScraped(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	c := newTestController(nil, newTestStorePods(o)...)
+	c.clusters[o.UID] = o
+
+	// Deleted without the finalizer, so never seen as being deleted.
+	if err := c.processDelete(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.clusters) != 0 {
+		t.Errorf("Expected deleted cluster not to be scraped anymore, got: %v", c.clusters)
+	}
+}
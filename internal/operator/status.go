@@ -0,0 +1,99 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sretry "k8s.io/client-go/util/retry"
+)
+
+// setCondition sets a condition in the status, only moving the
+// transition time when the status of the condition changes.
+func setCondition(
+	status *stanv1alpha1.NatsStreamingClusterStatus,
+	ctype stanv1alpha1.ClusterConditionType,
+	cstatus k8scorev1.ConditionStatus,
+	reason, message string,
+) {
+	cond := stanv1alpha1.ClusterCondition{
+		Type:               ctype,
+		Status:             cstatus,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: k8smetav1.Now(),
+	}
+	for i, current := range status.Conditions {
+		if current.Type != ctype {
+			continue
+		}
+		if current.Status == cstatus {
+			cond.LastTransitionTime = current.LastTransitionTime
+		}
+		status.Conditions[i] = cond
+		return
+	}
+	status.Conditions = append(status.Conditions, cond)
+}
+
+// getCondition returns the condition of the given type, if present.
+func getCondition(
+	status *stanv1alpha1.NatsStreamingClusterStatus,
+	ctype stanv1alpha1.ClusterConditionType,
+) *stanv1alpha1.ClusterCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == ctype {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// updateStatus applies the changes to the latest status of the
+// cluster, only sending an update in case there was any change.
+func (c *Controller) updateStatus(
+	o *stanv1alpha1.NatsStreamingCluster,
+	update func(status *stanv1alpha1.NatsStreamingClusterStatus),
+) error {
+	return c.updateCluster(o, func(cluster *stanv1alpha1.NatsStreamingCluster) {
+		update(&cluster.Status)
+	})
+}
+
+// updateCluster applies the changes to the latest version of the
+// cluster, only sending an update in case there was any change.
+// The latest version is used since the cluster may be updated a
+// few times over a single reconciliation.
+func (c *Controller) updateCluster(
+	o *stanv1alpha1.NatsStreamingCluster,
+	update func(cluster *stanv1alpha1.NatsStreamingCluster),
+) error {
+	clusters := c.ncr.StreamingV1alpha1().NatsStreamingClusters(o.Namespace)
+	return k8sretry.RetryOnConflict(k8sretry.DefaultRetry, func() error {
+		current, err := clusters.Get(o.Name, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := current.DeepCopy()
+		update(updated)
+		if reflect.DeepEqual(current, updated) {
+			return nil
+		}
+		_, err = clusters.Update(updated)
+		return err
+	})
+}
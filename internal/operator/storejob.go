@@ -0,0 +1,97 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	k8sbatchv1 "k8s.io/api/batch/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// stopNodes deletes all the pods of a cluster before its stores are
+// changed by a job, returning whether they are all gone so that no
+// server has a store open while it is changed.  The nodes are only
+// stopped once no backup archives a store, which checks in turn that
+// no such change is in progress, see backupNode.
+func (c *Controller) stopNodes(o *stanv1alpha1.NatsStreamingCluster, purpose string) (bool, error) {
+	// The nodes may have been stopped by a backup since the cached
+	// cluster was last updated, so always get the latest one.
+	current, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters(o.Namespace).Get(o.Name, k8smetav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if err := c.releaseBackupNodes(current); err != nil {
+		return false, err
+	}
+	if nodes := current.Status.BackupNodes; len(nodes) > 0 {
+		log.Debugf("Waiting for backup %s of node %s of '%s/%s' cluster before stopping its nodes", nodes[0].Backup, nodes[0].Name, o.Namespace, o.Name)
+		return false, nil
+	}
+
+	pods, err := c.findPods(o.Name, o.Namespace)
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		log.Infof("Stopping pod '%s/%s' %s", pod.Namespace, pod.Name, purpose)
+		err := c.kc.CoreV1().Pods(o.Namespace).Delete(pod.Name, k8sDeleteInBackground())
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	return len(pods.Items) == 0, nil
+}
+
+// pollStoreJob returns the job that changes the stores of a cluster
+// once it succeeded, or why it failed, and nothing while it runs.
+// The job is created again in case it is gone.
+func (c *Controller) pollStoreJob(o *stanv1alpha1.NatsStreamingCluster, name string, create func() error) (*k8sbatchv1.Job, string, error) {
+	job, err := c.kc.BatchV1().Jobs(o.Namespace).Get(name, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, "", create()
+	} else if err != nil {
+		return nil, "", err
+	}
+	if failed, message := jobFailed(job); failed {
+		return nil, message, nil
+	}
+	if job.Status.Succeeded == 0 {
+		return nil, "", nil
+	}
+	return job, "", nil
+}
+
+// deleteStoreJob deletes a job once its result has been recorded.
+func (c *Controller) deleteStoreJob(o *stanv1alpha1.NatsStreamingCluster, name string) error {
+	err := c.kc.BatchV1().Jobs(o.Namespace).Delete(name, k8sDeleteInBackground())
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// storeJobDeleted returns whether a failed job has been deleted, so
+// that its step is retried.
+func (c *Controller) storeJobDeleted(o *stanv1alpha1.NatsStreamingCluster, name string) (bool, error) {
+	_, err := c.kc.BatchV1().Jobs(o.Namespace).Get(name, k8smetav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
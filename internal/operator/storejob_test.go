@@ -0,0 +1,59 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestStopNodesWaitsForBackups(t *testing.T) {
+	o := newTestStoreCluster("stan", 3)
+	o.Status.BackupNodes = []stanv1alpha1.BackupNode{{Name: "stan-2", Backup: "stan-backup"}}
+	b := &stanv1alpha1.NatsStreamingBackup{
+		ObjectMeta: k8smetav1.ObjectMeta{Name: "stan-backup", Namespace: "default"},
+		Spec:       stanv1alpha1.NatsStreamingBackupSpec{ClusterName: "stan"},
+		Status:     stanv1alpha1.NatsStreamingBackupStatus{Phase: stanv1alpha1.BackupRunning, Node: "stan-2"},
+	}
+	c := newTestController([]k8sruntime.Object{o, b}, newTestStorePods(o)...)
+
+	// The store of the backup node is still archived.
+	if stopped, err := c.stopNodes(o, "to test"); err != nil || stopped {
+		t.Fatalf("Expected the nodes not to be stopped during a backup, got: %v %v", stopped, err)
+	}
+	if pods, _ := c.findPods("stan", "default"); len(pods.Items) != 3 {
+		t.Fatalf("Expected pods to keep running, got: %d", len(pods.Items))
+	}
+
+	b.Status.Phase = stanv1alpha1.BackupCompleted
+	if _, err := c.ncr.StreamingV1alpha1().NatsStreamingBackups("default").Update(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.stopNodes(o, "to test"); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, err := c.stopNodes(o, "to test"); err != nil || !stopped {
+		t.Fatalf("Expected the nodes to be stopped once the backup is done, got: %v %v", stopped, err)
+	}
+	result, err := c.ncr.StreamingV1alpha1().NatsStreamingClusters("default").Get("stan", k8smetav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Status.BackupNodes) != 0 {
+		t.Errorf("Expected the backup node to be released, got: %+v", result.Status.BackupNodes)
+	}
+}
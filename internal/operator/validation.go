@@ -0,0 +1,358 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+	k8sintstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// sizeRegexp matches the sizes accepted by the server, such as "512", "64KB" or "1G".
+var sizeRegexp = regexp.MustCompile(`^(?i)[0-9]+\s*(k|kb|m|mb|g|gb|t|tb)?$`)
+
+// parseSize returns the number of bytes of a size accepted by
+// the server, where the units are powers of 1024.
+func parseSize(size string) (int64, error) {
+	m := sizeRegexp.FindStringSubmatch(size)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	digits := strings.TrimSpace(size[:len(size)-len(m[1])])
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	switch strings.ToLower(m[1]) {
+	case "k", "kb":
+		n <<= 10
+	case "m", "mb":
+		n <<= 20
+	case "g", "gb":
+		n <<= 30
+	case "t", "tb":
+		n <<= 40
+	}
+	return n, nil
+}
+
+// validateCluster checks that the spec of the cluster is within
+// the bounds accepted by the server before creating any pods.
+func validateCluster(o *stanv1alpha1.NatsStreamingCluster) error {
+	if pdb := o.Spec.PodDisruptionBudget; pdb != nil && pdb.MinAvailable != nil && pdb.MaxUnavailable != nil {
+		return fmt.Errorf("podDisruptionBudget: only one of minAvailable or maxUnavailable can be set")
+	}
+	if p := o.Spec.Placement; p != nil {
+		switch p.Preset {
+		case "", stanv1alpha1.PlacementNone, stanv1alpha1.PlacementPreferredNode,
+			stanv1alpha1.PlacementRequiredNode, stanv1alpha1.PlacementZoneSpread:
+		default:
+			return fmt.Errorf("placement: unknown preset %q", p.Preset)
+		}
+	}
+	switch o.Spec.ReclaimPolicy {
+	case "", stanv1alpha1.ReclaimRetain, stanv1alpha1.ReclaimDelete:
+	default:
+		return fmt.Errorf("reclaimPolicy must be either Retain or Delete, got %q", o.Spec.ReclaimPolicy)
+	}
+	if o.Spec.RestoreFrom != nil {
+		if err := validateRestoreSource(o); err != nil {
+			return err
+		}
+	}
+	if us := o.Spec.UpdateStrategy; us != nil {
+		switch us.Type {
+		case "", stanv1alpha1.RollingUpdateStrategyType, stanv1alpha1.OnDeleteStrategyType, stanv1alpha1.RecreateStrategyType:
+		default:
+			return fmt.Errorf("updateStrategy: unknown type %q", us.Type)
+		}
+		if ru := us.RollingUpdate; ru != nil {
+			if us.Type != "" && us.Type != stanv1alpha1.RollingUpdateStrategyType {
+				return fmt.Errorf("updateStrategy: rollingUpdate can only be set with the RollingUpdate type")
+			}
+			if ru.Partition != nil && *ru.Partition < 0 {
+				return fmt.Errorf("updateStrategy: partition must not be negative, got %d", *ru.Partition)
+			}
+			if ru.MaxUnavailable != nil {
+				n, err := k8sintstr.GetValueFromIntOrPercent(ru.MaxUnavailable, 100, false)
+				if err != nil || n < 0 {
+					return fmt.Errorf("updateStrategy: invalid maxUnavailable %q", ru.MaxUnavailable.String())
+				}
+			}
+		}
+	}
+	if err := validateMode(o); err != nil {
+		return err
+	}
+	if rh := o.Spec.RaftHealth; rh != nil {
+		if rh.MaxLag < 0 {
+			return fmt.Errorf("raftHealth: maxLag must not be negative, got %d", rh.MaxLag)
+		}
+		if rh.GracePeriod != "" {
+			if d, err := time.ParseDuration(rh.GracePeriod); err != nil || d < 0 {
+				return fmt.Errorf("raftHealth: invalid gracePeriod %q", rh.GracePeriod)
+			}
+		}
+	}
+	if as := o.Spec.Autoscaling; as != nil {
+		if !isClustered(o) {
+			return fmt.Errorf("autoscaling can only be used in clustered mode")
+		}
+		if err := validateAutoscalingConfig(as); err != nil {
+			return fmt.Errorf("autoscaling: %s", err)
+		}
+	}
+	if o.Spec.Config == nil {
+		return nil
+	}
+	if fs := o.Spec.Config.FileStore; fs != nil {
+		if o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" {
+			return fmt.Errorf("fileStore options cannot be used with %s store", o.Spec.StoreType)
+		}
+		if err := validateFileStoreConfig(fs); err != nil {
+			return fmt.Errorf("fileStore: %s", err)
+		}
+	}
+	if cc := o.Spec.Config.Cluster; cc != nil {
+		if o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY" || isFTMode(o) {
+			return fmt.Errorf("cluster options can only be used with clustered file store")
+		}
+		if err := validateClusterConfig(cc); err != nil {
+			return fmt.Errorf("cluster: %s", err)
+		}
+	}
+	if ec := o.Spec.Config.Encryption; ec != nil {
+		if err := validateEncryptionConfig(ec); err != nil {
+			return fmt.Errorf("encryption: %s", err)
+		}
+	}
+	if sl := o.Spec.Config.StoreLimits; sl != nil {
+		if err := validateStoreLimitsConfig(sl); err != nil {
+			return fmt.Errorf("storeLimits: %s", err)
+		}
+	}
+	if p := o.Spec.Config.Partitioning; p != nil {
+		if isClustered(o) {
+			return fmt.Errorf("partitioning cannot be used with clustering, set size to 1 or use FT mode")
+		}
+		if len(p.Channels) == 0 {
+			return fmt.Errorf("partitioning: at least one channel is required")
+		}
+		for _, channel := range p.Channels {
+			if !validChannel(channel) {
+				return fmt.Errorf("partitioning: invalid channel %q", channel)
+			}
+		}
+	}
+	if o.Spec.ConfigFile != "" && stanConfigFile(o) != "" {
+		return fmt.Errorf("configFile cannot be combined with options that require the generated configuration file")
+	}
+	return nil
+}
+
+func validateClusterConfig(cc *stanv1alpha1.ClusterConfig) error {
+	// Same defaults and bounds as the server and its Raft library.
+	timeouts := []struct {
+		name    string
+		value   string
+		def     time.Duration
+		minimum time.Duration
+		result  time.Duration
+	}{
+		{name: "raftHeartbeatTimeout", value: cc.HeartbeatTimeout, def: 2 * time.Second, minimum: 5 * time.Millisecond},
+		{name: "raftElectionTimeout", value: cc.ElectionTimeout, def: 2 * time.Second, minimum: 5 * time.Millisecond},
+		{name: "raftLeaseTimeout", value: cc.LeaseTimeout, def: time.Second, minimum: 5 * time.Millisecond},
+		{name: "raftCommitTimeout", value: cc.CommitTimeout, def: 100 * time.Millisecond, minimum: time.Millisecond},
+	}
+	for i, t := range timeouts {
+		timeouts[i].result = t.def
+		if t.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(t.value)
+		if err != nil {
+			return fmt.Errorf("%s has an invalid duration %q", t.name, t.value)
+		}
+		if d < t.minimum {
+			return fmt.Errorf("%s must be at least %s, got %q", t.name, t.minimum, t.value)
+		}
+		timeouts[i].result = d
+	}
+	heartbeat, election, lease := timeouts[0].result, timeouts[1].result, timeouts[2].result
+	if election < heartbeat {
+		return fmt.Errorf("raftElectionTimeout (%s) must not be lower than raftHeartbeatTimeout (%s)", election, heartbeat)
+	}
+	if lease > heartbeat {
+		return fmt.Errorf("raftLeaseTimeout (%s) must not be greater than raftHeartbeatTimeout (%s)", lease, heartbeat)
+	}
+
+	if cc.LogCacheSize < 0 {
+		return fmt.Errorf("logCacheSize must not be negative, got %d", cc.LogCacheSize)
+	}
+	if cc.LogSnapshots < 0 {
+		return fmt.Errorf("logSnapshots must not be negative, got %d", cc.LogSnapshots)
+	}
+	if cc.TrailingLogs < 0 {
+		return fmt.Errorf("trailingLogs must not be negative, got %d", cc.TrailingLogs)
+	}
+	return nil
+}
+
+func validateFileStoreConfig(fs *stanv1alpha1.FileStoreConfig) error {
+	if fs.CompactFragmentation < 0 || fs.CompactFragmentation > 100 {
+		return fmt.Errorf("compactFragmentation must be a percentage between 0 and 100, got %d", fs.CompactFragmentation)
+	}
+	if fs.CompactInterval < 0 {
+		return fmt.Errorf("compactInterval must not be negative, got %d", fs.CompactInterval)
+	}
+	if fs.CRCPolynomial < 0 || fs.CRCPolynomial > 0xFFFFFFFF {
+		return fmt.Errorf("crcPolynomial must be a 32 bit value, got %d", fs.CRCPolynomial)
+	}
+	if fs.SliceMaxMsgs < 0 {
+		return fmt.Errorf("sliceMaxMsgs must not be negative, got %d", fs.SliceMaxMsgs)
+	}
+	if fs.FileDescriptorsLimit < 0 {
+		return fmt.Errorf("fdsLimit must not be negative, got %d", fs.FileDescriptorsLimit)
+	}
+	if fs.ParallelRecovery < 0 {
+		return fmt.Errorf("parallelRecovery must not be negative, got %d", fs.ParallelRecovery)
+	}
+	for name, size := range map[string]string{
+		"compactMinSize": fs.CompactMinSize,
+		"bufferSize":     fs.BufferSize,
+		"sliceMaxBytes":  fs.SliceMaxBytes,
+	} {
+		if size != "" && !sizeRegexp.MatchString(size) {
+			return fmt.Errorf("%s has an invalid size %q", name, size)
+		}
+	}
+	if fs.SliceMaxAge != "" {
+		d, err := time.ParseDuration(fs.SliceMaxAge)
+		if err != nil {
+			return fmt.Errorf("sliceMaxAge has an invalid duration %q", fs.SliceMaxAge)
+		}
+		if d < 0 {
+			return fmt.Errorf("sliceMaxAge must not be negative, got %q", fs.SliceMaxAge)
+		}
+	}
+	return nil
+}
+
+func validateEncryptionConfig(ec *stanv1alpha1.EncryptionConfig) error {
+	switch ec.Cipher {
+	case "", "AES", "CHACHA":
+	default:
+		return fmt.Errorf("cipher must be either AES or CHACHA, got %q", ec.Cipher)
+	}
+	if ec.KeySecret == nil || ec.KeySecret.Name == "" || ec.KeySecret.Key == "" {
+		return fmt.Errorf("keySecret with the name and key of the Secret is required")
+	}
+	return nil
+}
+
+func validateMode(o *stanv1alpha1.NatsStreamingCluster) error {
+	mode := o.Spec.Mode
+	switch mode {
+	case "":
+		return nil
+	case stanv1alpha1.ModeStandalone, stanv1alpha1.ModeFaultTolerance, stanv1alpha1.ModeClustered:
+	default:
+		return fmt.Errorf("mode must be either standalone, ft or clustered, got %q", mode)
+	}
+	if mode != stanv1alpha1.ModeStandalone && (o.Spec.StoreType == "SQL" || o.Spec.StoreType == "MEMORY") {
+		return fmt.Errorf("mode %s can only be used with the file store", mode)
+	}
+	if mode == stanv1alpha1.ModeStandalone && o.Spec.Size > 1 {
+		return fmt.Errorf("mode standalone can only be used with a single node, got size %d", o.Spec.Size)
+	}
+	config := o.Spec.Config
+	if mode == stanv1alpha1.ModeFaultTolerance && (config == nil || config.StoreDir == "") {
+		return fmt.Errorf("mode ft requires config.storeDir to be on a volume shared by the nodes")
+	}
+	if mode == stanv1alpha1.ModeClustered && config == nil {
+		return fmt.Errorf("mode clustered requires the config of the nodes")
+	}
+	if config != nil && config.FTGroup != "" && mode != stanv1alpha1.ModeFaultTolerance {
+		return fmt.Errorf("config.ftGroup can only be set in ft mode, got mode %s", mode)
+	}
+	if config != nil && config.Clustered && mode != stanv1alpha1.ModeClustered {
+		return fmt.Errorf("config.clustered can only be set in clustered mode, got mode %s", mode)
+	}
+	return nil
+}
+
+func validateStoreLimitsConfig(sl *stanv1alpha1.StoreLimitsConfig) error {
+	if sl.MaxChannels < 0 {
+		return fmt.Errorf("maxChannels must not be negative, got %d", sl.MaxChannels)
+	}
+	if sl.MaxMsgs < 0 {
+		return fmt.Errorf("maxMsgs must not be negative, got %d", sl.MaxMsgs)
+	}
+	if sl.MaxSubs < 0 {
+		return fmt.Errorf("maxSubs must not be negative, got %d", sl.MaxSubs)
+	}
+	if sl.MaxBytes != "" && !sizeRegexp.MatchString(sl.MaxBytes) {
+		return fmt.Errorf("maxBytes has an invalid size %q", sl.MaxBytes)
+	}
+	if sl.MaxAge != "" {
+		if d, err := time.ParseDuration(sl.MaxAge); err != nil || d < 0 {
+			return fmt.Errorf("maxAge has an invalid duration %q", sl.MaxAge)
+		}
+	}
+	return nil
+}
+
+func validateAutoscalingConfig(as *stanv1alpha1.AutoscalingConfig) error {
+	if as.MinSize < 3 || as.MinSize%2 == 0 {
+		return fmt.Errorf("minSize must be odd and at least 3, got %d", as.MinSize)
+	}
+	if as.MaxSize < as.MinSize || as.MaxSize%2 == 0 {
+		return fmt.Errorf("maxSize must be odd and at least minSize, got %d", as.MaxSize)
+	}
+	if len(as.Metrics) == 0 {
+		return fmt.Errorf("at least one metric is required")
+	}
+	for _, m := range as.Metrics {
+		switch m.Type {
+		case stanv1alpha1.AutoscalingClients, stanv1alpha1.AutoscalingSubscriptions,
+			stanv1alpha1.AutoscalingChannels, stanv1alpha1.AutoscalingMessages,
+			stanv1alpha1.AutoscalingPendingMessages:
+		default:
+			return fmt.Errorf("unknown metric %q", m.Type)
+		}
+		if m.ScaleUpAbove < 0 || m.ScaleDownBelow < 0 {
+			return fmt.Errorf("thresholds of %s must not be negative", m.Type)
+		}
+		if m.ScaleUpAbove > 0 && m.ScaleDownBelow >= m.ScaleUpAbove {
+			return fmt.Errorf("scaleDownBelow of %s must be lower than its scaleUpAbove", m.Type)
+		}
+	}
+	for name, cooldown := range map[string]string{
+		"scaleUpCooldown":   as.ScaleUpCooldown,
+		"scaleDownCooldown": as.ScaleDownCooldown,
+	} {
+		if cooldown == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(cooldown); err != nil || d < 0 {
+			return fmt.Errorf("invalid %s %q", name, cooldown)
+		}
+	}
+	return nil
+}
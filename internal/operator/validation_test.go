@@ -0,0 +1,75 @@
+// Copyright 2020 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	stanv1alpha1 "github.com/nats-io/nats-streaming-operator/pkg/apis/streaming/v1alpha1"
+)
+
+func TestValidateFileStoreConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		store string
+		fs    *stanv1alpha1.FileStoreConfig
+		valid bool
+	}{
+		{"defaults", "", &stanv1alpha1.FileStoreConfig{}, true},
+		{"sizes", "", &stanv1alpha1.FileStoreConfig{BufferSize: "64kb", SliceMaxBytes: "1G", CompactMinSize: "1024"}, true},
+		{"fragmentation", "", &stanv1alpha1.FileStoreConfig{CompactFragmentation: 101}, false},
+		{"bad size", "", &stanv1alpha1.FileStoreConfig{BufferSize: "lots"}, false},
+		{"bad age", "", &stanv1alpha1.FileStoreConfig{SliceMaxAge: "1 day"}, false},
+		{"negative fds", "", &stanv1alpha1.FileStoreConfig{FileDescriptorsLimit: -1}, false},
+		{"memory store", "MEMORY", &stanv1alpha1.FileStoreConfig{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{FileStore: tc.fs})
+			o.Spec.StoreType = tc.store
+			err := validateCluster(o)
+			if tc.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestValidateClusterConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cc    *stanv1alpha1.ClusterConfig
+		valid bool
+	}{
+		{"defaults", &stanv1alpha1.ClusterConfig{}, true},
+		{"longer timeouts", &stanv1alpha1.ClusterConfig{HeartbeatTimeout: "10s", ElectionTimeout: "10s", LeaseTimeout: "5s"}, true},
+		{"election lower than heartbeat", &stanv1alpha1.ClusterConfig{HeartbeatTimeout: "10s"}, false},
+		{"lease greater than heartbeat", &stanv1alpha1.ClusterConfig{LeaseTimeout: "3s"}, false},
+		{"bad duration", &stanv1alpha1.ClusterConfig{CommitTimeout: "soon"}, false},
+		{"negative cache", &stanv1alpha1.ClusterConfig{LogCacheSize: -1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestCluster("stan", 3, &stanv1alpha1.ServerConfig{Cluster: tc.cc})
+			err := validateCluster(o)
+			if tc.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("Expected validation error")
+			}
+		})
+	}
+}
@@ -34,6 +34,12 @@ var (
 // addKnownTypes adds the set of types defined in this package to the supplied scheme.
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&NatsStreamingBackup{},
+		&NatsStreamingBackupList{},
+		&NatsStreamingBackupSchedule{},
+		&NatsStreamingBackupScheduleList{},
+		&NatsStreamingChannel{},
+		&NatsStreamingChannelList{},
 		&NatsStreamingCluster{},
 		&NatsStreamingClusterList{},
 	)
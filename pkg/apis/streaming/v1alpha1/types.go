@@ -16,6 +16,7 @@ package v1alpha1
 import (
 	k8scorev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // NatsStreamingClusterList
@@ -52,6 +53,11 @@ type NatsStreamingClusterSpec struct {
 	// same namespace as the NATS Operator.
 	NatsService string `json:"natsSvc"`
 
+	// Mode is how the nodes run: standalone, ft or clustered.  By
+	// default it follows from the size and the config, otherwise
+	// the cluster is switched over to it when it changes.
+	Mode ClusterMode `json:"mode,omitempty"`
+
 	// Config is the server configuration.
 	Config *ServerConfig `json:"config,omitempty"`
 
@@ -63,6 +69,248 @@ type NatsStreamingClusterSpec struct {
 
 	// PodTemplate is the optional template to use for the pods.
 	PodTemplate *k8scorev1.PodTemplateSpec `json:"template,omitempty"`
+
+	// Service is the optional configuration of the Services
+	// created for the cluster.
+	Service *ServiceConfig `json:"service,omitempty"`
+
+	// PodDisruptionBudget is the optional configuration of the
+	// PodDisruptionBudget of the cluster.  In clustered mode with
+	// at least 3 nodes one is created by default so that evictions
+	// do not break quorum.
+	PodDisruptionBudget *PodDisruptionBudgetConfig `json:"podDisruptionBudget,omitempty"`
+
+	// RaftHealth is the optional configuration of the detection
+	// of unhealthy Raft groups in clustered mode, and of their
+	// remediation which is disabled by default.
+	RaftHealth *RaftHealthConfig `json:"raftHealth,omitempty"`
+
+	// Autoscaling is the optional configuration of the adjustment
+	// of the size of a clustered cluster to the load of its nodes,
+	// always to an odd number of nodes.
+	Autoscaling *AutoscalingConfig `json:"autoscaling,omitempty"`
+
+	// Placement is the optional configuration of how the nodes
+	// are spread, by default preferring different hosts.
+	Placement *PlacementConfig `json:"placement,omitempty"`
+
+	// UpdateStrategy is how the pods are updated when their
+	// spec changes, by default one at a time.
+	UpdateStrategy *UpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// Paused stops the operator from making any changes to the
+	// pods and other resources of the cluster.
+	Paused bool `json:"paused,omitempty"`
+
+	// ReclaimPolicy is what happens to the data volumes of the
+	// cluster once it is deleted, by default Retain.
+	ReclaimPolicy ReclaimPolicy `json:"reclaimPolicy,omitempty"`
+
+	// RestoreFrom seeds the store of the nodes from a snapshot
+	// before they start, only when their store is still empty.
+	// Only the nodes that form the cluster restore it: the node
+	// that bootstraps the Raft group or its explicit peers, the
+	// other nodes get the state from the leader.
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+
+	// Resources are the compute resources of the NATS Streaming container.
+	Resources *k8scorev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector is the selector of the nodes for the pods.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations are the tolerations of the pods.
+	Tolerations []k8scorev1.Toleration `json:"tolerations,omitempty"`
+
+	// PriorityClassName is the priority class of the pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// ServiceAccountName is the service account of the pods.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// SecurityContext is the security context of the pods.
+	SecurityContext *k8scorev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// ImagePullSecrets are the secrets to pull the images of the pods.
+	ImagePullSecrets []k8scorev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// ClusterMode is the mode in which the nodes of a cluster run.
+type ClusterMode string
+
+const (
+	// ModeStandalone runs a single node.
+	ModeStandalone ClusterMode = "standalone"
+
+	// ModeFaultTolerance runs an active node and standby nodes
+	// sharing the same store.
+	ModeFaultTolerance ClusterMode = "ft"
+
+	// ModeClustered runs the nodes as a Raft group, each one
+	// with its own store.
+	ModeClustered ClusterMode = "clustered"
+)
+
+// PlacementPreset is a preset of rules to spread the nodes.
+type PlacementPreset string
+
+const (
+	// PlacementNone does not spread the nodes.
+	PlacementNone PlacementPreset = "none"
+
+	// PlacementPreferredNode prefers scheduling the nodes on different hosts.
+	PlacementPreferredNode PlacementPreset = "preferred-node"
+
+	// PlacementRequiredNode requires scheduling the nodes on different hosts.
+	PlacementRequiredNode PlacementPreset = "required-node"
+
+	// PlacementZoneSpread requires scheduling the nodes on different
+	// hosts, and prefers scheduling them in different zones.
+	PlacementZoneSpread PlacementPreset = "zone-spread"
+)
+
+// PlacementConfig is the configuration of how the nodes are spread.
+// An explicit pod anti-affinity in the template takes precedence.
+type PlacementConfig struct {
+	// Preset is the preset of rules to spread the nodes.
+	Preset PlacementPreset `json:"preset"`
+}
+
+// AutoscalingConfig is the configuration of the adjustment of the
+// size of a cluster to the stats scraped from its nodes.  The size
+// is changed two nodes at a time so that it stays odd.  It is only
+// scaled down with AllowAddRemoveNode set in the cluster config, so
+// that the departing nodes are removed from the Raft group.
+type AutoscalingConfig struct {
+	// MinSize is the minimum number of nodes, odd and at least 3.
+	MinSize int32 `json:"minSize"`
+
+	// MaxSize is the maximum number of nodes, odd and at least MinSize.
+	// A larger size is scaled down to it like when autoscaled, two
+	// nodes at a time, though regardless of the cooldown.
+	MaxSize int32 `json:"maxSize"`
+
+	// Metrics are the thresholds of the stats of the cluster.  It
+	// is scaled up once any of them is above its threshold, and
+	// down once all of those with a threshold to scale down are
+	// below it.
+	Metrics []AutoscalingMetric `json:"metrics"`
+
+	// ScaleUpCooldown is how long to wait after the size changed
+	// before scaling up, by default 3m.
+	ScaleUpCooldown string `json:"scaleUpCooldown,omitempty"`
+
+	// ScaleDownCooldown is how long to wait after the size changed
+	// before scaling down, by default 15m.
+	ScaleDownCooldown string `json:"scaleDownCooldown,omitempty"`
+}
+
+// AutoscalingMetricType is a stat of the cluster used to scale it.
+type AutoscalingMetricType string
+
+const (
+	// AutoscalingClients is the number of connected clients.
+	AutoscalingClients AutoscalingMetricType = "Clients"
+
+	// AutoscalingSubscriptions is the number of subscriptions.
+	AutoscalingSubscriptions AutoscalingMetricType = "Subscriptions"
+
+	// AutoscalingChannels is the number of channels.
+	AutoscalingChannels AutoscalingMetricType = "Channels"
+
+	// AutoscalingMessages is the number of messages in the store.
+	AutoscalingMessages AutoscalingMetricType = "Messages"
+
+	// AutoscalingPendingMessages is the number of messages not yet
+	// acknowledged by the subscriptions.
+	AutoscalingPendingMessages AutoscalingMetricType = "PendingMessages"
+)
+
+// AutoscalingMetric are the thresholds of a stat of the cluster,
+// compared to its value averaged over the nodes.
+type AutoscalingMetric struct {
+	// Type is the stat of the cluster.
+	Type AutoscalingMetricType `json:"type"`
+
+	// ScaleUpAbove is the value per node above which the cluster
+	// is scaled up, zero to never scale up on this stat.
+	ScaleUpAbove int64 `json:"scaleUpAbove,omitempty"`
+
+	// ScaleDownBelow is the value per node below which the cluster
+	// can be scaled down, zero to ignore this stat to scale down.
+	ScaleDownBelow int64 `json:"scaleDownBelow,omitempty"`
+}
+
+// RaftHealthConfig is the configuration of the detection and
+// remediation of unhealthy Raft groups.
+type RaftHealthConfig struct {
+	// MaxLag is how many messages a follower can be behind the
+	// leader before it is lagging, by default 1000.
+	MaxLag int64 `json:"maxLag,omitempty"`
+
+	// GracePeriod is how long a node has to be unhealthy before
+	// it is remediated, by default 5m.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+
+	// RestartLaggingFollowers restarts the followers that lag
+	// behind the leader for longer than the grace period.
+	RestartLaggingFollowers bool `json:"restartLaggingFollowers,omitempty"`
+
+	// RejoinNodes wipes the store and Raft log of the nodes that
+	// report that they have not joined the group for longer than
+	// the grace period, or that lead a group split from the one
+	// with the most messages, so that they join it again from its
+	// leader.  The nodes that cannot be reached or remain a
+	// candidate are only restarted, since neither means that their
+	// state is lost.
+	RejoinNodes bool `json:"rejoinNodes,omitempty"`
+}
+
+// PodDisruptionBudgetConfig is the configuration of the
+// PodDisruptionBudget of the cluster.
+type PodDisruptionBudgetConfig struct {
+	// Enabled creates the PodDisruptionBudget, by default
+	// only in clustered mode.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// MinAvailable is the number or percentage of nodes that
+	// have to be available after an eviction.
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of nodes that
+	// can be unavailable after an eviction.  By default as many
+	// as possible while keeping the quorum of the cluster.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ServiceConfig is the configuration of the headless Service
+// with the DNS records of the nodes, and of the ClusterIP
+// Service for the monitoring endpoint.
+type ServiceConfig struct {
+	// MonitoringPort is the port of the monitoring endpoint
+	// exposed by the Services, by default 8222.
+	MonitoringPort int32 `json:"monitoringPort,omitempty"`
+
+	// Annotations are the annotations of the monitoring Service.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// HeadlessAnnotations are the annotations of the headless Service.
+	HeadlessAnnotations map[string]string `json:"headlessAnnotations,omitempty"`
+}
+
+// RestoreSource is a snapshot taken by a NatsStreamingBackup.
+type RestoreSource struct {
+	// Source is where the snapshot is stored, same as
+	// the target of the backup that took it.
+	Source BackupTarget `json:"source"`
+
+	// Archive is the name of the snapshot, which is
+	// <backup>.tar.gz for the snapshot of a backup.
+	Archive string `json:"archive"`
+
+	// Image is the image of the restore init container, which
+	// needs a shell, tar and the MinIO client for S3 sources.
+	Image string `json:"image,omitempty"`
 }
 
 // ServerConfig is the configuration for the server.
@@ -85,7 +333,899 @@ type ServerConfig struct {
 
 	// Clustered enables explicitly in the cluster
 	Clustered bool `json:"clustered"`
+
+	// FileStore is the optional tuning of the file store.
+	FileStore *FileStoreConfig `json:"fileStore,omitempty"`
+
+	// Cluster is the optional tuning of the Raft clustering.
+	Cluster *ClusterConfig `json:"cluster,omitempty"`
+
+	// Encryption enables the encryption at rest of the messages
+	// in the store.
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
+
+	// Partitioning makes the cluster own only a subset of the
+	// channels, other clusters owning the rest.
+	Partitioning *PartitioningConfig `json:"partitioning,omitempty"`
+
+	// StoreLimits are the optional global limits of the store,
+	// which the limits of the channels cannot exceed.
+	StoreLimits *StoreLimitsConfig `json:"storeLimits,omitempty"`
+}
+
+// StoreLimitsConfig is the configuration of the global limits of
+// the store, any unset field keeps the default from the server.
+type StoreLimitsConfig struct {
+	// MaxChannels is the maximum number of channels.
+	MaxChannels int32 `json:"maxChannels,omitempty"`
+
+	// MaxMsgs is the maximum number of messages per channel.
+	MaxMsgs int64 `json:"maxMsgs,omitempty"`
+
+	// MaxBytes is the maximum size of the messages per channel,
+	// for example "1GB".
+	MaxBytes string `json:"maxBytes,omitempty"`
+
+	// MaxAge is how long messages are kept, for example "24h".
+	MaxAge string `json:"maxAge,omitempty"`
+
+	// MaxSubs is the maximum number of subscriptions per channel.
+	MaxSubs int32 `json:"maxSubs,omitempty"`
+}
+
+// ChannelLimits are the limits of a channel, or of the channels
+// matching a wildcard pattern.  Any unset field keeps the global
+// limit of the store.
+type ChannelLimits struct {
+	// Channel is the name of the channel or a wildcard pattern.
+	Channel string `json:"channel"`
+
+	// MaxMsgs is the maximum number of messages.
+	MaxMsgs int64 `json:"maxMsgs,omitempty"`
+
+	// MaxBytes is the maximum size of the messages, for example "512MB".
+	MaxBytes string `json:"maxBytes,omitempty"`
+
+	// MaxAge is how long messages are kept, for example "24h".
+	MaxAge string `json:"maxAge,omitempty"`
+
+	// MaxSubs is the maximum number of subscriptions.
+	MaxSubs int32 `json:"maxSubs,omitempty"`
+}
+
+// PartitioningConfig is the configuration of the partition
+// of the channels owned by a cluster.
+type PartitioningConfig struct {
+	// ClusterID is the cluster ID shared by all the partitions,
+	// by default the name of the cluster.
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// Channels are the names or wildcard patterns of the
+	// channels owned by the cluster.
+	Channels []string `json:"channels"`
+}
+
+// EncryptionConfig is the configuration of the store encryption.
+type EncryptionConfig struct {
+	// Cipher is the cipher used for the encryption, either
+	// AES or CHACHA.  By default the server picks one.
+	Cipher string `json:"cipher,omitempty"`
+
+	// KeySecret is the key of the Secret with the encryption key.
+	// It is injected in the container as an environment variable.
+	KeySecret *k8scorev1.SecretKeySelector `json:"keySecret"`
+}
+
+// ClusterConfig is the tuning of the Raft clustering, any unset
+// field keeps the default from the server.
+type ClusterConfig struct {
+	// HeartbeatTimeout is the time in follower state without
+	// contact from a leader before attempting an election, for example "2s".
+	HeartbeatTimeout string `json:"raftHeartbeatTimeout,omitempty"`
+
+	// ElectionTimeout is the time in candidate state without
+	// contact from a leader before attempting an election, for example "2s".
+	ElectionTimeout string `json:"raftElectionTimeout,omitempty"`
+
+	// LeaseTimeout is how long a leader can go without being able
+	// to contact a quorum of nodes before stepping down, for example "1s".
+	LeaseTimeout string `json:"raftLeaseTimeout,omitempty"`
+
+	// CommitTimeout is the time without an Apply operation before
+	// the leader sends a heartbeat, for example "100ms".
+	CommitTimeout string `json:"raftCommitTimeout,omitempty"`
+
+	// LogCacheSize is the number of log entries to cache in memory.
+	LogCacheSize int32 `json:"logCacheSize,omitempty"`
+
+	// LogSnapshots is the number of log snapshots to retain.
+	LogSnapshots int32 `json:"logSnapshots,omitempty"`
+
+	// TrailingLogs is the number of log entries to leave
+	// after a snapshot and compaction.
+	TrailingLogs int64 `json:"trailingLogs,omitempty"`
+
+	// Sync enables a file sync after every write to the
+	// replication log and message store.
+	Sync bool `json:"sync,omitempty"`
+
+	// ProceedOnRestoreFailure allows a node to start even if it
+	// fails to restore a snapshot.
+	ProceedOnRestoreFailure bool `json:"proceedOnRestoreFailure,omitempty"`
+
+	// AllowAddRemoveNode enables adding and removing nodes
+	// with requests sent to the leader, which the autoscaling
+	// requires to scale down.
+	AllowAddRemoveNode bool `json:"allowAddRemoveNode,omitempty"`
+
+	// ExplicitPeers forms the cluster by setting the full list of
+	// node IDs, derived from the name of the pods, as the peers of
+	// each node instead of bootstrapping it from the first pod.
+	//
+	// The list is not updated when the cluster is scaled.  A server
+	// only reads its peers when it has no Raft state yet, and then
+	// forms a new group with them rather than joining the existing
+	// one, so a node added later given the updated list would never
+	// join the group of the others.  Only the nodes that formed the
+	// cluster keep the list, recorded in status.initialPeers, and
+	// the nodes added later join the group through its leader.
+	ExplicitPeers bool `json:"explicitPeers,omitempty"`
+}
+
+// FileStoreConfig is the tuning of the file store, any unset
+// field keeps the default from the server.
+type FileStoreConfig struct {
+	// CompactEnabled enables file compaction.
+	CompactEnabled *bool `json:"compactEnabled,omitempty"`
+
+	// CompactFragmentation is the fragmentation threshold
+	// (percentage) for compaction.
+	CompactFragmentation int32 `json:"compactFragmentation,omitempty"`
+
+	// CompactInterval is the minimum interval in seconds
+	// between file compactions.
+	CompactInterval int32 `json:"compactInterval,omitempty"`
+
+	// CompactMinSize is the minimum file size for compaction,
+	// for example "1MB".
+	CompactMinSize string `json:"compactMinSize,omitempty"`
+
+	// BufferSize is the size of the file buffer, for example "2MB".
+	BufferSize string `json:"bufferSize,omitempty"`
+
+	// CRC enables the CRC-32 checksum of the files.
+	CRC *bool `json:"crc,omitempty"`
+
+	// CRCPolynomial is the polynomial used to make the table
+	// for the CRC-32 checksum.
+	CRCPolynomial int64 `json:"crcPolynomial,omitempty"`
+
+	// SyncOnFlush enables File.Sync on flush.
+	SyncOnFlush *bool `json:"syncOnFlush,omitempty"`
+
+	// SliceMaxMsgs is the maximum number of messages per file slice.
+	SliceMaxMsgs int32 `json:"sliceMaxMsgs,omitempty"`
+
+	// SliceMaxBytes is the maximum size of a file slice, for example "64MB".
+	SliceMaxBytes string `json:"sliceMaxBytes,omitempty"`
+
+	// SliceMaxAge is the maximum age of a file slice, for example "24h".
+	SliceMaxAge string `json:"sliceMaxAge,omitempty"`
+
+	// FileDescriptorsLimit is the number of file descriptors
+	// that the store will try not to exceed.
+	FileDescriptorsLimit int32 `json:"fdsLimit,omitempty"`
+
+	// ParallelRecovery is the number of channels that can be
+	// recovered in parallel on startup.
+	ParallelRecovery int32 `json:"parallelRecovery,omitempty"`
 }
 
 type NatsStreamingClusterStatus struct {
+	// Bootstrapped is whether the Raft group of the cluster has
+	// been bootstrapped, after which it is never bootstrapped
+	// again unless explicitly requested.  It is also set when Raft
+	// logs are found on the store volume of a cluster without pods
+	// that was never recorded as bootstrapped.  Outside of
+	// clustered mode it is whether the nodes have been created.
+	Bootstrapped bool `json:"bootstrapped,omitempty"`
+
+	// BootstrapNode is the pod that bootstrapped the cluster.
+	BootstrapNode string `json:"bootstrapNode,omitempty"`
+
+	// BootstrapTime is when the cluster was bootstrapped.
+	BootstrapTime *metav1.Time `json:"bootstrapTime,omitempty"`
+
+	// InitialPeers are the nodes that formed the Raft group with
+	// explicit peers.  Only they are started with the list of peers,
+	// which is never changed since it is only read by a server
+	// without Raft state, the nodes added later join the group
+	// through its leader.
+	InitialPeers []string `json:"initialPeers,omitempty"`
+
+	// RaftPeers are the voters of the Raft group as far as they are
+	// known, the nodes that were reported as members of the group
+	// until their removal is confirmed by its leader.  A node whose
+	// pod is deleted without being removed remains a voter.
+	RaftPeers []string `json:"raftPeers,omitempty"`
+
+	// Mode is the mode in which the nodes currently run, it is
+	// only changed once the switch to a new mode is done.
+	Mode ClusterMode `json:"mode,omitempty"`
+
+	// ModeTransition is the progress of the switch to a new mode.
+	ModeTransition *ModeTransition `json:"modeTransition,omitempty"`
+
+	// QuorumRecovery is the progress of the recovery of a Raft
+	// group that lost its quorum.
+	QuorumRecovery *QuorumRecovery `json:"quorumRecovery,omitempty"`
+
+	// FaultTolerance is the active and standby nodes in FT mode.
+	FaultTolerance *FaultToleranceStatus `json:"faultTolerance,omitempty"`
+
+	// RaftHealth is the health of the Raft group in clustered mode.
+	RaftHealth *RaftHealthStatus `json:"raftHealth,omitempty"`
+
+	// Autoscaling is the state of the autoscaling of the cluster.
+	Autoscaling *AutoscalingStatus `json:"autoscaling,omitempty"`
+
+	// BackupNodes are the nodes kept stopped while their store
+	// is archived by a backup.
+	BackupNodes []BackupNode `json:"backupNodes,omitempty"`
+
+	// ChannelLimits are the limits of the NatsStreamingChannels of
+	// the cluster that are part of its generated configuration.
+	ChannelLimits []ChannelLimits `json:"channelLimits,omitempty"`
+
+	// Stats is the summary of the monitoring endpoints of the nodes.
+	Stats *ClusterStats `json:"stats,omitempty"`
+
+	// StoreEncrypted is whether the store of the cluster was
+	// created with encryption, it is only changed on migration.
+	StoreEncrypted *bool `json:"storeEncrypted,omitempty"`
+
+	// Conditions are the latest observations of the state of the cluster.
+	Conditions []ClusterCondition `json:"conditions,omitempty"`
+
+	// Updates are the states of the updates of the pods in progress.
+	Updates []UpdateStatus `json:"updates,omitempty"`
+}
+
+// FaultToleranceStatus is the state of the nodes in FT mode, as
+// reported by their monitoring endpoint.
+type FaultToleranceStatus struct {
+	// Active is the node running the active server.
+	Active string `json:"active,omitempty"`
+
+	// Standbys are the nodes running a standby server.
+	Standbys []string `json:"standbys,omitempty"`
+}
+
+// AutoscalingStatus is the state of the autoscaling of a cluster.
+type AutoscalingStatus struct {
+	// LastScaleTime is when the size was last changed, or when a
+	// scale down last failed.
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+
+	// Message is why the size was last changed, or why it is kept.
+	Message string `json:"message,omitempty"`
+
+	// ScaleDown is the scale down in progress, during which the
+	// departing nodes are removed from the Raft group.
+	ScaleDown *ScaleDown `json:"scaleDown,omitempty"`
+}
+
+// ScaleDown is a scale down of a cluster, which is only done once the
+// leader of the Raft group confirmed the removal of the nodes that
+// depart from it.
+type ScaleDown struct {
+	// From is the size of the cluster that is scaled down.
+	From int32 `json:"from"`
+
+	// To is the size the cluster is scaled down to.
+	To int32 `json:"to"`
+
+	// Reason is why the cluster is scaled down.
+	Reason string `json:"reason,omitempty"`
+
+	// Nodes are the nodes removed from the Raft group.
+	Nodes []string `json:"nodes"`
+
+	// Job is the job that sends the removals to the leader.
+	Job string `json:"job"`
+
+	// StartTime is when the scale down started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+}
+
+// RaftHealthStatus is the health of the Raft group of a cluster,
+// as reported by the monitoring endpoints of the nodes.
+type RaftHealthStatus struct {
+	// Leaders are the nodes that claim to be the leader.
+	Leaders []string `json:"leaders,omitempty"`
+
+	// UnhealthyNodes are the nodes that have not joined the
+	// group or that lag behind the leader.
+	UnhealthyNodes []UnhealthyNode `json:"unhealthyNodes,omitempty"`
+
+	// Rejoining are the nodes whose store and Raft log are wiped
+	// once they are recreated.
+	Rejoining []RejoiningNode `json:"rejoining,omitempty"`
+}
+
+// NodeHealthReason is why a node of a Raft group is unhealthy.
+type NodeHealthReason string
+
+const (
+	// NodeNotJoined is set when a node reports that it is not a
+	// member of the group.
+	NodeNotJoined NodeHealthReason = "NotJoined"
+
+	// NodeUnreachable is set when the monitoring endpoint of a
+	// running node cannot be reached.
+	NodeUnreachable NodeHealthReason = "Unreachable"
+
+	// NodeCandidate is set when a node is a candidate in an
+	// election of the group.
+	NodeCandidate NodeHealthReason = "Candidate"
+
+	// NodeLagging is set when a follower lags behind the leader.
+	NodeLagging NodeHealthReason = "Lagging"
+
+	// NodeSplitLeader is set when a node leads a group split from
+	// the one with the most messages.
+	NodeSplitLeader NodeHealthReason = "SplitLeader"
+)
+
+// UnhealthyNode is a node of a Raft group that is unhealthy.
+type UnhealthyNode struct {
+	// Name is the name of the pod of the node.
+	Name string `json:"name"`
+
+	// Reason is why the node is unhealthy.
+	Reason NodeHealthReason `json:"reason"`
+
+	// Lag is how many messages a lagging node is behind the leader.
+	Lag int64 `json:"lag,omitempty"`
+
+	// Since is when the node was first seen unhealthy.
+	Since metav1.Time `json:"since"`
+}
+
+// RejoiningNode is a node that rejoins its Raft group.
+type RejoiningNode struct {
+	// Name is the name of the pod of the node.
+	Name string `json:"name"`
+
+	// PodUID is the UID of the pod that was deleted, the node has
+	// rejoined once it has been recreated.
+	PodUID string `json:"podUID,omitempty"`
+}
+
+// BackupNode is a node kept stopped while a backup archives its
+// store, it is recreated once the backup is done.
+type BackupNode struct {
+	// Name is the name of the pod of the node.
+	Name string `json:"name"`
+
+	// Backup is the name of the NatsStreamingBackup.
+	Backup string `json:"backup"`
+}
+
+// ClusterStats is the summary of the monitoring endpoints of the
+// nodes, periodically scraped by the operator.  The totals are the
+// ones of the node serving the clients: the leader in clustered
+// mode, or the active server in FT mode.
+type ClusterStats struct {
+	// StoreType is the type of the store as reported by the server.
+	StoreType string `json:"storeType,omitempty"`
+
+	// Channels is the number of channels.
+	Channels int32 `json:"channels"`
+
+	// Clients is the number of connected clients.
+	Clients int32 `json:"clients"`
+
+	// Subscriptions is the number of subscriptions.
+	Subscriptions int32 `json:"subscriptions"`
+
+	// Messages is the total number of messages in the store.
+	Messages int64 `json:"messages"`
+
+	// Bytes is the total size of the messages in the store.
+	Bytes int64 `json:"bytes"`
+
+	// PendingMessages is the number of messages not yet
+	// acknowledged by the subscriptions.
+	PendingMessages int64 `json:"pendingMessages"`
+
+	// Nodes are the state of each of the nodes.
+	Nodes []NodeStats `json:"nodes,omitempty"`
+
+	// LastScrapeTime is when the endpoints were last scraped.
+	LastScrapeTime *metav1.Time `json:"lastScrapeTime,omitempty"`
+}
+
+// NodeStats is the state of a node as reported by the server.
+type NodeStats struct {
+	// Name is the name of the pod of the node.
+	Name string `json:"name"`
+
+	// State is the state of the server, such as CLUSTERED or FT_ACTIVE.
+	State string `json:"state,omitempty"`
+
+	// Role is the Raft role of the node in clustered mode.
+	Role string `json:"role,omitempty"`
+
+	// Version is the version of the server.
+	Version string `json:"version,omitempty"`
+
+	// Messages is the number of messages in the store of the
+	// node, which tells how far a follower lags behind.
+	Messages int64 `json:"messages,omitempty"`
+}
+
+// ReclaimPolicy is the policy for the data volumes of a deleted cluster.
+type ReclaimPolicy string
+
+const (
+	// ReclaimRetain releases the PersistentVolumeClaims of the
+	// cluster so that a later cluster can adopt them again.
+	ReclaimRetain ReclaimPolicy = "Retain"
+
+	// ReclaimDelete deletes the PersistentVolumeClaims of the cluster.
+	ReclaimDelete ReclaimPolicy = "Delete"
+)
+
+// UpdateStrategyType is the type of strategy to update the pods.
+type UpdateStrategyType string
+
+const (
+	// RollingUpdateStrategyType recreates the outdated pods in
+	// order from the highest ordinal, a few at a time.
+	RollingUpdateStrategyType UpdateStrategyType = "RollingUpdate"
+
+	// OnDeleteStrategyType only updates the pods once they
+	// have been deleted manually.
+	OnDeleteStrategyType UpdateStrategyType = "OnDelete"
+
+	// RecreateStrategyType deletes all the outdated pods at once,
+	// meant for the MEMORY store where downtime is acceptable.
+	RecreateStrategyType UpdateStrategyType = "Recreate"
+)
+
+// UpdateStrategy is the strategy to update the pods, modelled
+// after the update strategy of a StatefulSet.
+type UpdateStrategy struct {
+	// Type is the type of strategy, by default RollingUpdate.
+	Type UpdateStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate is the configuration of the RollingUpdate strategy.
+	RollingUpdate *RollingUpdateStrategy `json:"rollingUpdate,omitempty"`
+}
+
+// RollingUpdateStrategy is the configuration of a rolling update.
+type RollingUpdateStrategy struct {
+	// MaxUnavailable is the number or percentage of pods that can
+	// be unavailable during the update, by default 1.  In clustered
+	// mode it is capped to keep the quorum of the Raft group.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// Partition is the ordinal from which the pods are updated,
+	// pods with a lower ordinal keep their current spec.  As in
+	// a StatefulSet ordinals count from zero, while the names of
+	// the pods count from one, so a partition of 2 on 3 nodes
+	// only updates the third one.  This allows updating the
+	// highest numbered nodes first to canary a change, by default
+	// all the pods are updated.
+	Partition *int32 `json:"partition,omitempty"`
+}
+
+// UpdatePhase is the step of the rolling update of a pod.
+type UpdatePhase string
+
+const (
+	// UpdatePhaseDeleting waits for the outdated pod to be deleted.
+	UpdatePhaseDeleting UpdatePhase = "Deleting"
+
+	// UpdatePhaseWaitingReady waits for the recreated pod to be ready.
+	UpdatePhaseWaitingReady UpdatePhase = "WaitingReady"
+)
+
+// UpdateStatus is the state of the rolling update of a pod,
+// which is advanced one step on each reconciliation.
+type UpdateStatus struct {
+	// Pod is the name of the pod being updated.
+	Pod string `json:"pod"`
+
+	// PodUID is the UID of the outdated pod.
+	PodUID string `json:"podUID,omitempty"`
+
+	// Hash is the spec hash the pod is being updated to.
+	Hash string `json:"hash"`
+
+	// Phase is the current step of the update of the pod.
+	Phase UpdatePhase `json:"phase"`
+
+	// PhaseStartTime is when the current step started.
+	PhaseStartTime metav1.Time `json:"phaseStartTime"`
+}
+
+// ModeTransitionPhase is the step of the switch to a new mode.
+type ModeTransitionPhase string
+
+const (
+	// ModeTransitionStopping waits for all the nodes to be stopped.
+	ModeTransitionStopping ModeTransitionPhase = "Stopping"
+
+	// ModeTransitionMovingData waits for the job that moves the
+	// store to the layout of the new mode.
+	ModeTransitionMovingData ModeTransitionPhase = "MovingData"
+
+	// ModeTransitionStarting waits for the nodes to be ready in
+	// the new mode.
+	ModeTransitionStarting ModeTransitionPhase = "Starting"
+
+	// ModeTransitionFailed is set when the store could not be
+	// moved, the nodes are left stopped until it is retried.
+	ModeTransitionFailed ModeTransitionPhase = "Failed"
+)
+
+// ModeTransition is the state of the switch of a cluster to a new
+// mode, which is advanced one step on each reconciliation.
+type ModeTransition struct {
+	// From is the mode the cluster is switched from.
+	From ClusterMode `json:"from"`
+
+	// To is the mode the cluster is switched to.
+	To ClusterMode `json:"to"`
+
+	// Phase is the current step of the switch.
+	Phase ModeTransitionPhase `json:"phase"`
+
+	// Source is the node whose store is kept for the new mode.
+	Source string `json:"source,omitempty"`
+
+	// Nodes are the nodes that were running before the switch.
+	Nodes []string `json:"nodes,omitempty"`
+
+	// Job is the name of the job that moves the store.
+	Job string `json:"job,omitempty"`
+
+	// Message is the human readable detail of the current step.
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the switch started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+}
+
+// QuorumRecoveryPhase is the step of the recovery of a Raft group.
+type QuorumRecoveryPhase string
+
+const (
+	// QuorumRecoveryStopping is set while the nodes are stopped.
+	QuorumRecoveryStopping QuorumRecoveryPhase = "Stopping"
+
+	// QuorumRecoverySelecting is set while a job reads the Raft
+	// logs of the stopped nodes to select the survivor, when none
+	// was named.
+	QuorumRecoverySelecting QuorumRecoveryPhase = "Selecting"
+
+	// QuorumRecoveryRecovering is set while a job makes the store
+	// of the survivor the store of the first node, setting aside the
+	// stores of the others.
+	QuorumRecoveryRecovering QuorumRecoveryPhase = "Recovering"
+
+	// QuorumRecoveryStarting is set while the first node is
+	// bootstrapped alone and fresh peers are added to it.
+	QuorumRecoveryStarting QuorumRecoveryPhase = "Starting"
+
+	// QuorumRecoveryCleaning is set while a job removes the stores
+	// set aside, once all the nodes are ready.
+	QuorumRecoveryCleaning QuorumRecoveryPhase = "Cleaning"
+
+	// QuorumRecoveryFailed is set when a job of the recovery failed.
+	QuorumRecoveryFailed QuorumRecoveryPhase = "Failed"
+)
+
+// QuorumRecovery is the state of the recovery of a Raft group that
+// lost its quorum, from the store of a single surviving node.
+type QuorumRecovery struct {
+	// Phase is the current step of the recovery.
+	Phase QuorumRecoveryPhase `json:"phase"`
+
+	// Survivor is the node whose store is kept, as requested or
+	// as selected for the last entry of its Raft log.
+	Survivor string `json:"survivor,omitempty"`
+
+	// Job is the name of the job of the current step.
+	Job string `json:"job,omitempty"`
+
+	// Message is the human readable detail of the current step.
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the recovery started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+}
+
+// ClusterConditionType is the type of a condition of the cluster.
+type ClusterConditionType string
+
+const (
+	// ClusterPartitionsOverlap is set when the channels of the
+	// cluster overlap with the partition of another cluster.
+	ClusterPartitionsOverlap ClusterConditionType = "PartitionsOverlap"
+
+	// ClusterPaused is set when the reconciliation of the
+	// cluster has been paused.
+	ClusterPaused ClusterConditionType = "Paused"
+
+	// ClusterModeTransition is set while the cluster is switched
+	// to a new mode, and when a switch is refused as unsafe.
+	ClusterModeTransition ClusterConditionType = "ModeTransition"
+
+	// ClusterDegraded is set when the Raft group has no leader,
+	// more than one, or nodes that are not part of it or lag.
+	ClusterDegraded ClusterConditionType = "Degraded"
+
+	// ClusterQuorumRecovery is set while a Raft group that lost
+	// its quorum is recovered, and when a recovery is refused.
+	ClusterQuorumRecovery ClusterConditionType = "QuorumRecovery"
+
+	// ClusterStoreNotShared is set in FT mode when the store may not
+	// be shared by nodes on different hosts.
+	ClusterStoreNotShared ClusterConditionType = "StoreNotShared"
+)
+
+// ClusterCondition is the state of an aspect of the cluster.
+type ClusterCondition struct {
+	// Type is the type of the condition.
+	Type ClusterConditionType `json:"type"`
+
+	// Status is either True, False or Unknown.
+	Status k8scorev1.ConditionStatus `json:"status"`
+
+	// Reason is the reason of the last transition of the condition.
+	Reason string `json:"reason,omitempty"`
+
+	// Message is the human readable detail of the condition.
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is when the condition last changed its status.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// NatsStreamingBackupList
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []NatsStreamingBackup `json:"items"`
+}
+
+// NatsStreamingBackup is a snapshot of the file store of a
+// NatsStreamingCluster, taken from one of its followers.
+//
+// In clustered mode the follower is stopped while its store is
+// archived, as long as the other nodes keep the quorum, so the
+// snapshot is the state it had when it stopped.  The store of a
+// standalone or FT cluster is copied while it is running, and the
+// backup fails when the files keep changing during the copy.  The
+// archive has a SHA256SUMS manifest of the files, which is verified
+// when a cluster is restored from it.
+//
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              NatsStreamingBackupSpec   `json:"spec"`
+	Status            NatsStreamingBackupStatus `json:"status,omitempty"`
+}
+
+type NatsStreamingBackupSpec struct {
+	// ClusterName is the name of the NatsStreamingCluster to back
+	// up, which has to be in the same namespace.
+	ClusterName string `json:"clusterName"`
+
+	// Image is the image of the backup job, which needs a shell,
+	// tar, sha256sum and the MinIO client (mc) for S3 targets.
+	Image string `json:"image,omitempty"`
+
+	// Target is where the snapshot is stored.
+	Target BackupTarget `json:"target"`
+}
+
+// BackupTarget is where a snapshot is stored, only one of the
+// targets can be set.
+type BackupTarget struct {
+	// PersistentVolumeClaim stores the snapshot in a volume.
+	PersistentVolumeClaim *PVCBackupTarget `json:"persistentVolumeClaim,omitempty"`
+
+	// S3 stores the snapshot in an S3 compatible bucket.
+	S3 *S3BackupTarget `json:"s3,omitempty"`
+}
+
+// PVCBackupTarget is a directory in a PersistentVolumeClaim.
+type PVCBackupTarget struct {
+	// ClaimName is the name of the PersistentVolumeClaim.
+	ClaimName string `json:"claimName"`
+
+	// Path is the directory within the volume, by default its root.
+	Path string `json:"path,omitempty"`
+}
+
+// S3BackupTarget is a prefix in an S3 compatible bucket.
+type S3BackupTarget struct {
+	// Endpoint is the URL of the S3 API, for example
+	// https://s3.amazonaws.com or http://minio:9000.
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the name of the bucket.
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to the name of the snapshot.
+	Prefix string `json:"prefix,omitempty"`
+
+	// CredentialsSecret is the name of the secret with the
+	// accessKey and secretKey to the bucket.
+	CredentialsSecret string `json:"credentialsSecret"`
+
+	// Insecure skips the verification of the TLS certificate.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+type NatsStreamingBackupStatus struct {
+	// Phase is the progress of the backup.
+	Phase BackupPhase `json:"phase,omitempty"`
+
+	// Message is the detail of the phase, such as the reason
+	// of the failure.
+	Message string `json:"message,omitempty"`
+
+	// Node is the pod whose store is backed up.
+	Node string `json:"node,omitempty"`
+
+	// Job is the name of the job taking the snapshot.
+	Job string `json:"job,omitempty"`
+
+	// Location is the URL of the snapshot, either
+	// pvc://<claim>/<path> or s3://<bucket>/<key>.
+	Location string `json:"location,omitempty"`
+
+	// Size is the size in bytes of the snapshot.
+	Size int64 `json:"size,omitempty"`
+
+	// StartTime is when the backup job was created.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the backup completed or failed.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// BackupPhase is the progress of a backup.
+type BackupPhase string
+
+const (
+	// BackupPending is a backup waiting for a node to back up.
+	BackupPending BackupPhase = "Pending"
+
+	// BackupRunning is a backup with its job running.
+	BackupRunning BackupPhase = "Running"
+
+	// BackupCompleted is a backup with its snapshot stored.
+	BackupCompleted BackupPhase = "Completed"
+
+	// BackupFailed is a backup that will not be retried.
+	BackupFailed BackupPhase = "Failed"
+)
+
+// NatsStreamingBackupScheduleList
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []NatsStreamingBackupSchedule `json:"items"`
+}
+
+// NatsStreamingBackupSchedule creates NatsStreamingBackups of
+// a cluster on a schedule, and prunes the old ones.
+//
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              NatsStreamingBackupScheduleSpec   `json:"spec"`
+	Status            NatsStreamingBackupScheduleStatus `json:"status,omitempty"`
+}
+
+type NatsStreamingBackupScheduleSpec struct {
+	// Schedule is when to take the backups in cron format,
+	// for example "0 */6 * * *" or "@daily", in UTC.
+	Schedule string `json:"schedule"`
+
+	// Suspend stops taking new backups, without pruning
+	// the existing ones.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Retention is how long the completed backups are kept, by default
+	// they are kept until deleted.
+	Retention *BackupRetention `json:"retention,omitempty"`
+
+	// Backup is the spec of the backups that are taken.
+	Backup NatsStreamingBackupSpec `json:"backup"`
+}
+
+// BackupRetention is how long the completed backups of a schedule
+// are kept, backups are pruned when they exceed any of the limits.
+// The newest completed backup is always kept.  Failed backups are
+// pruned once a newer backup finished, regardless of the retention.
+type BackupRetention struct {
+	// KeepLast is the number of latest completed backups to keep.
+	KeepLast int32 `json:"keepLast,omitempty"`
+
+	// MaxAge is how long to keep a backup, for example "168h".
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+type NatsStreamingBackupScheduleStatus struct {
+	// LastScheduleTime is when the latest backup was scheduled.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastBackup is the name of the latest backup.
+	LastBackup string `json:"lastBackup,omitempty"`
+
+	// LastSuccessTime is when the latest successful backup completed.
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// LastFailureTime is when the latest failed backup failed.
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// Message is the reason the schedule cannot be run, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// NatsStreamingChannelList is a list of NatsStreamingChannels.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingChannelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []NatsStreamingChannel `json:"items"`
+}
+
+// NatsStreamingChannel declares the limits of a channel of a
+// NatsStreamingCluster, which are added to the store limits of
+// its generated configuration.
+//
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NatsStreamingChannel struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              NatsStreamingChannelSpec   `json:"spec"`
+	Status            NatsStreamingChannelStatus `json:"status,omitempty"`
+}
+
+type NatsStreamingChannelSpec struct {
+	// ClusterName is the name of the NatsStreamingCluster of the
+	// channel, which has to be in the same namespace.
+	ClusterName string `json:"clusterName"`
+
+	ChannelLimits `json:",inline"`
+}
+
+type NatsStreamingChannelStatus struct {
+	// Applied is whether the limits are part of the generated
+	// configuration of the cluster.
+	Applied bool `json:"applied"`
+
+	// Message is the reason the limits are not applied, if any.
+	Message string `json:"message,omitempty"`
 }
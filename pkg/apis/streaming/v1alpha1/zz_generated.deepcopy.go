@@ -21,30 +21,323 @@ package v1alpha1
 import (
 	v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NatsStreamingCluster) DeepCopyInto(out *NatsStreamingCluster) {
+func (in *AutoscalingConfig) DeepCopyInto(out *AutoscalingConfig) {
+	*out = *in
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]AutoscalingMetric, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingConfig.
+func (in *AutoscalingConfig) DeepCopy() *AutoscalingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingMetric) DeepCopyInto(out *AutoscalingMetric) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingMetric.
+func (in *AutoscalingMetric) DeepCopy() *AutoscalingMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingStatus) DeepCopyInto(out *AutoscalingStatus) {
+	*out = *in
+	if in.LastScaleTime != nil {
+		in, out := &in.LastScaleTime, &out.LastScaleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ScaleDown != nil {
+		in, out := &in.ScaleDown, &out.ScaleDown
+		*out = new(ScaleDown)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingStatus.
+func (in *AutoscalingStatus) DeepCopy() *AutoscalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupNode) DeepCopyInto(out *BackupNode) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupNode.
+func (in *BackupNode) DeepCopy() *BackupNode {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupRetention) DeepCopyInto(out *BackupRetention) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupRetention.
+func (in *BackupRetention) DeepCopy() *BackupRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupTarget) DeepCopyInto(out *BackupTarget) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(PVCBackupTarget)
+		**out = **in
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3BackupTarget)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupTarget.
+func (in *BackupTarget) DeepCopy() *BackupTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChannelLimits) DeepCopyInto(out *ChannelLimits) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChannelLimits.
+func (in *ChannelLimits) DeepCopy() *ChannelLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(ChannelLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCondition) DeepCopyInto(out *ClusterCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCondition.
+func (in *ClusterCondition) DeepCopy() *ClusterCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterConfig) DeepCopyInto(out *ClusterConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfig.
+func (in *ClusterConfig) DeepCopy() *ClusterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStats) DeepCopyInto(out *ClusterStats) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScrapeTime != nil {
+		in, out := &in.LastScrapeTime, &out.LastScrapeTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStats.
+func (in *ClusterStats) DeepCopy() *ClusterStats {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionConfig) DeepCopyInto(out *EncryptionConfig) {
+	*out = *in
+	if in.KeySecret != nil {
+		in, out := &in.KeySecret, &out.KeySecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionConfig.
+func (in *EncryptionConfig) DeepCopy() *EncryptionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultToleranceStatus) DeepCopyInto(out *FaultToleranceStatus) {
+	*out = *in
+	if in.Standbys != nil {
+		in, out := &in.Standbys, &out.Standbys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultToleranceStatus.
+func (in *FaultToleranceStatus) DeepCopy() *FaultToleranceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultToleranceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileStoreConfig) DeepCopyInto(out *FileStoreConfig) {
+	*out = *in
+	if in.CompactEnabled != nil {
+		in, out := &in.CompactEnabled, &out.CompactEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CRC != nil {
+		in, out := &in.CRC, &out.CRC
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SyncOnFlush != nil {
+		in, out := &in.SyncOnFlush, &out.SyncOnFlush
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileStoreConfig.
+func (in *FileStoreConfig) DeepCopy() *FileStoreConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FileStoreConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModeTransition) DeepCopyInto(out *ModeTransition) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModeTransition.
+func (in *ModeTransition) DeepCopy() *ModeTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(ModeTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingBackup) DeepCopyInto(out *NatsStreamingBackup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingCluster.
-func (in *NatsStreamingCluster) DeepCopy() *NatsStreamingCluster {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackup.
+func (in *NatsStreamingBackup) DeepCopy() *NatsStreamingBackup {
 	if in == nil {
 		return nil
 	}
-	out := new(NatsStreamingCluster)
+	out := new(NatsStreamingBackup)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *NatsStreamingCluster) DeepCopyObject() runtime.Object {
+func (in *NatsStreamingBackup) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -52,13 +345,13 @@ func (in *NatsStreamingCluster) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NatsStreamingClusterList) DeepCopyInto(out *NatsStreamingClusterList) {
+func (in *NatsStreamingBackupList) DeepCopyInto(out *NatsStreamingBackupList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	out.ListMeta = in.ListMeta
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]NatsStreamingCluster, len(*in))
+		*out = make([]NatsStreamingBackup, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -66,18 +359,18 @@ func (in *NatsStreamingClusterList) DeepCopyInto(out *NatsStreamingClusterList)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterList.
-func (in *NatsStreamingClusterList) DeepCopy() *NatsStreamingClusterList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupList.
+func (in *NatsStreamingBackupList) DeepCopy() *NatsStreamingBackupList {
 	if in == nil {
 		return nil
 	}
-	out := new(NatsStreamingClusterList)
+	out := new(NatsStreamingBackupList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *NatsStreamingClusterList) DeepCopyObject() runtime.Object {
+func (in *NatsStreamingBackupList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -85,59 +378,898 @@ func (in *NatsStreamingClusterList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NatsStreamingClusterSpec) DeepCopyInto(out *NatsStreamingClusterSpec) {
+func (in *NatsStreamingBackupSchedule) DeepCopyInto(out *NatsStreamingBackupSchedule) {
 	*out = *in
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = new(ServerConfig)
-		**out = **in
-	}
-	if in.PodTemplate != nil {
-		in, out := &in.PodTemplate, &out.PodTemplate
-		*out = new(v1.PodTemplateSpec)
-		(*in).DeepCopyInto(*out)
-	}
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterSpec.
-func (in *NatsStreamingClusterSpec) DeepCopy() *NatsStreamingClusterSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupSchedule.
+func (in *NatsStreamingBackupSchedule) DeepCopy() *NatsStreamingBackupSchedule {
 	if in == nil {
 		return nil
 	}
-	out := new(NatsStreamingClusterSpec)
+	out := new(NatsStreamingBackupSchedule)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingBackupSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NatsStreamingClusterStatus) DeepCopyInto(out *NatsStreamingClusterStatus) {
+func (in *NatsStreamingBackupScheduleList) DeepCopyInto(out *NatsStreamingBackupScheduleList) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NatsStreamingBackupSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterStatus.
-func (in *NatsStreamingClusterStatus) DeepCopy() *NatsStreamingClusterStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupScheduleList.
+func (in *NatsStreamingBackupScheduleList) DeepCopy() *NatsStreamingBackupScheduleList {
 	if in == nil {
 		return nil
 	}
-	out := new(NatsStreamingClusterStatus)
+	out := new(NatsStreamingBackupScheduleList)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingBackupScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ServerConfig) DeepCopyInto(out *ServerConfig) {
+func (in *NatsStreamingBackupScheduleSpec) DeepCopyInto(out *NatsStreamingBackupScheduleSpec) {
 	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(BackupRetention)
+		**out = **in
+	}
+	in.Backup.DeepCopyInto(&out.Backup)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerConfig.
-func (in *ServerConfig) DeepCopy() *ServerConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupScheduleSpec.
+func (in *NatsStreamingBackupScheduleSpec) DeepCopy() *NatsStreamingBackupScheduleSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(ServerConfig)
+	out := new(NatsStreamingBackupScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingBackupScheduleStatus) DeepCopyInto(out *NatsStreamingBackupScheduleStatus) {
+	*out = *in
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessTime != nil {
+		in, out := &in.LastSuccessTime, &out.LastSuccessTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupScheduleStatus.
+func (in *NatsStreamingBackupScheduleStatus) DeepCopy() *NatsStreamingBackupScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingBackupScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingBackupSpec) DeepCopyInto(out *NatsStreamingBackupSpec) {
+	*out = *in
+	in.Target.DeepCopyInto(&out.Target)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupSpec.
+func (in *NatsStreamingBackupSpec) DeepCopy() *NatsStreamingBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingBackupStatus) DeepCopyInto(out *NatsStreamingBackupStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingBackupStatus.
+func (in *NatsStreamingBackupStatus) DeepCopy() *NatsStreamingBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingChannel) DeepCopyInto(out *NatsStreamingChannel) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingChannel.
+func (in *NatsStreamingChannel) DeepCopy() *NatsStreamingChannel {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingChannel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingChannel) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingChannelList) DeepCopyInto(out *NatsStreamingChannelList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NatsStreamingChannel, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingChannelList.
+func (in *NatsStreamingChannelList) DeepCopy() *NatsStreamingChannelList {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingChannelList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingChannelList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingChannelSpec) DeepCopyInto(out *NatsStreamingChannelSpec) {
+	*out = *in
+	out.ChannelLimits = in.ChannelLimits
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingChannelSpec.
+func (in *NatsStreamingChannelSpec) DeepCopy() *NatsStreamingChannelSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingChannelSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingChannelStatus) DeepCopyInto(out *NatsStreamingChannelStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingChannelStatus.
+func (in *NatsStreamingChannelStatus) DeepCopy() *NatsStreamingChannelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingChannelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingCluster) DeepCopyInto(out *NatsStreamingCluster) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingCluster.
+func (in *NatsStreamingCluster) DeepCopy() *NatsStreamingCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingClusterList) DeepCopyInto(out *NatsStreamingClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NatsStreamingCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterList.
+func (in *NatsStreamingClusterList) DeepCopy() *NatsStreamingClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NatsStreamingClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingClusterSpec) DeepCopyInto(out *NatsStreamingClusterSpec) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(ServerConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(v1.PodTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(ServiceConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(PodDisruptionBudgetConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RaftHealth != nil {
+		in, out := &in.RaftHealth, &out.RaftHealth
+		*out = new(RaftHealthConfig)
+		**out = **in
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(PlacementConfig)
+		**out = **in
+	}
+	if in.UpdateStrategy != nil {
+		in, out := &in.UpdateStrategy, &out.UpdateStrategy
+		*out = new(UpdateStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RestoreFrom != nil {
+		in, out := &in.RestoreFrom, &out.RestoreFrom
+		*out = new(RestoreSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterSpec.
+func (in *NatsStreamingClusterSpec) DeepCopy() *NatsStreamingClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NatsStreamingClusterStatus) DeepCopyInto(out *NatsStreamingClusterStatus) {
+	*out = *in
+	if in.BootstrapTime != nil {
+		in, out := &in.BootstrapTime, &out.BootstrapTime
+		*out = (*in).DeepCopy()
+	}
+	if in.InitialPeers != nil {
+		in, out := &in.InitialPeers, &out.InitialPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RaftPeers != nil {
+		in, out := &in.RaftPeers, &out.RaftPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ModeTransition != nil {
+		in, out := &in.ModeTransition, &out.ModeTransition
+		*out = new(ModeTransition)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.QuorumRecovery != nil {
+		in, out := &in.QuorumRecovery, &out.QuorumRecovery
+		*out = new(QuorumRecovery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FaultTolerance != nil {
+		in, out := &in.FaultTolerance, &out.FaultTolerance
+		*out = new(FaultToleranceStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RaftHealth != nil {
+		in, out := &in.RaftHealth, &out.RaftHealth
+		*out = new(RaftHealthStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BackupNodes != nil {
+		in, out := &in.BackupNodes, &out.BackupNodes
+		*out = make([]BackupNode, len(*in))
+		copy(*out, *in)
+	}
+	if in.ChannelLimits != nil {
+		in, out := &in.ChannelLimits, &out.ChannelLimits
+		*out = make([]ChannelLimits, len(*in))
+		copy(*out, *in)
+	}
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		*out = new(ClusterStats)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StoreEncrypted != nil {
+		in, out := &in.StoreEncrypted, &out.StoreEncrypted
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ClusterCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Updates != nil {
+		in, out := &in.Updates, &out.Updates
+		*out = make([]UpdateStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NatsStreamingClusterStatus.
+func (in *NatsStreamingClusterStatus) DeepCopy() *NatsStreamingClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NatsStreamingClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeStats) DeepCopyInto(out *NodeStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStats.
+func (in *NodeStats) DeepCopy() *NodeStats {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PVCBackupTarget) DeepCopyInto(out *PVCBackupTarget) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PVCBackupTarget.
+func (in *PVCBackupTarget) DeepCopy() *PVCBackupTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(PVCBackupTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PartitioningConfig) DeepCopyInto(out *PartitioningConfig) {
+	*out = *in
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PartitioningConfig.
+func (in *PartitioningConfig) DeepCopy() *PartitioningConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PartitioningConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlacementConfig) DeepCopyInto(out *PlacementConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlacementConfig.
+func (in *PlacementConfig) DeepCopy() *PlacementConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PlacementConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDisruptionBudgetConfig) DeepCopyInto(out *PodDisruptionBudgetConfig) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDisruptionBudgetConfig.
+func (in *PodDisruptionBudgetConfig) DeepCopy() *PodDisruptionBudgetConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDisruptionBudgetConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuorumRecovery) DeepCopyInto(out *QuorumRecovery) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuorumRecovery.
+func (in *QuorumRecovery) DeepCopy() *QuorumRecovery {
+	if in == nil {
+		return nil
+	}
+	out := new(QuorumRecovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RaftHealthConfig) DeepCopyInto(out *RaftHealthConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RaftHealthConfig.
+func (in *RaftHealthConfig) DeepCopy() *RaftHealthConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RaftHealthConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RaftHealthStatus) DeepCopyInto(out *RaftHealthStatus) {
+	*out = *in
+	if in.Leaders != nil {
+		in, out := &in.Leaders, &out.Leaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnhealthyNodes != nil {
+		in, out := &in.UnhealthyNodes, &out.UnhealthyNodes
+		*out = make([]UnhealthyNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rejoining != nil {
+		in, out := &in.Rejoining, &out.Rejoining
+		*out = make([]RejoiningNode, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RaftHealthStatus.
+func (in *RaftHealthStatus) DeepCopy() *RaftHealthStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RaftHealthStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RejoiningNode) DeepCopyInto(out *RejoiningNode) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RejoiningNode.
+func (in *RejoiningNode) DeepCopy() *RejoiningNode {
+	if in == nil {
+		return nil
+	}
+	out := new(RejoiningNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreSource) DeepCopyInto(out *RestoreSource) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreSource.
+func (in *RestoreSource) DeepCopy() *RestoreSource {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpdateStrategy) DeepCopyInto(out *RollingUpdateStrategy) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.Partition != nil {
+		in, out := &in.Partition, &out.Partition
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpdateStrategy.
+func (in *RollingUpdateStrategy) DeepCopy() *RollingUpdateStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpdateStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3BackupTarget) DeepCopyInto(out *S3BackupTarget) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3BackupTarget.
+func (in *S3BackupTarget) DeepCopy() *S3BackupTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(S3BackupTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleDown) DeepCopyInto(out *ScaleDown) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleDown.
+func (in *ScaleDown) DeepCopy() *ScaleDown {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleDown)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerConfig) DeepCopyInto(out *ServerConfig) {
+	*out = *in
+	if in.FileStore != nil {
+		in, out := &in.FileStore, &out.FileStore
+		*out = new(FileStoreConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Cluster != nil {
+		in, out := &in.Cluster, &out.Cluster
+		*out = new(ClusterConfig)
+		**out = **in
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(EncryptionConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Partitioning != nil {
+		in, out := &in.Partitioning, &out.Partitioning
+		*out = new(PartitioningConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StoreLimits != nil {
+		in, out := &in.StoreLimits, &out.StoreLimits
+		*out = new(StoreLimitsConfig)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerConfig.
+func (in *ServerConfig) DeepCopy() *ServerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceConfig) DeepCopyInto(out *ServiceConfig) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HeadlessAnnotations != nil {
+		in, out := &in.HeadlessAnnotations, &out.HeadlessAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceConfig.
+func (in *ServiceConfig) DeepCopy() *ServiceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StoreLimitsConfig) DeepCopyInto(out *StoreLimitsConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StoreLimitsConfig.
+func (in *StoreLimitsConfig) DeepCopy() *StoreLimitsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StoreLimitsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnhealthyNode) DeepCopyInto(out *UnhealthyNode) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnhealthyNode.
+func (in *UnhealthyNode) DeepCopy() *UnhealthyNode {
+	if in == nil {
+		return nil
+	}
+	out := new(UnhealthyNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpdateStatus) DeepCopyInto(out *UpdateStatus) {
+	*out = *in
+	in.PhaseStartTime.DeepCopyInto(&out.PhaseStartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpdateStatus.
+func (in *UpdateStatus) DeepCopy() *UpdateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UpdateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpdateStrategy) DeepCopyInto(out *UpdateStrategy) {
+	*out = *in
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdateStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpdateStrategy.
+func (in *UpdateStrategy) DeepCopy() *UpdateStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(UpdateStrategy)
 	in.DeepCopyInto(out)
 	return out
 }
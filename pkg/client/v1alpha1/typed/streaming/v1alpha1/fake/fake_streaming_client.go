@@ -26,6 +26,18 @@ type FakeStreamingV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeStreamingV1alpha1) NatsStreamingBackups(namespace string) v1alpha1.NatsStreamingBackupInterface {
+	return &FakeNatsStreamingBackups{c, namespace}
+}
+
+func (c *FakeStreamingV1alpha1) NatsStreamingBackupSchedules(namespace string) v1alpha1.NatsStreamingBackupScheduleInterface {
+	return &FakeNatsStreamingBackupSchedules{c, namespace}
+}
+
+func (c *FakeStreamingV1alpha1) NatsStreamingChannels(namespace string) v1alpha1.NatsStreamingChannelInterface {
+	return &FakeNatsStreamingChannels{c, namespace}
+}
+
 func (c *FakeStreamingV1alpha1) NatsStreamingClusters(namespace string) v1alpha1.NatsStreamingClusterInterface {
 	return &FakeNatsStreamingClusters{c, namespace}
 }
@@ -16,4 +16,10 @@
 
 package v1alpha1
 
+type NatsStreamingBackupExpansion interface{}
+
+type NatsStreamingBackupScheduleExpansion interface{}
+
+type NatsStreamingChannelExpansion interface{}
+
 type NatsStreamingClusterExpansion interface{}
@@ -25,6 +25,9 @@ import (
 
 type StreamingV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	NatsStreamingBackupsGetter
+	NatsStreamingBackupSchedulesGetter
+	NatsStreamingChannelsGetter
 	NatsStreamingClustersGetter
 }
 
@@ -33,6 +36,18 @@ type StreamingV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *StreamingV1alpha1Client) NatsStreamingBackups(namespace string) NatsStreamingBackupInterface {
+	return newNatsStreamingBackups(c, namespace)
+}
+
+func (c *StreamingV1alpha1Client) NatsStreamingBackupSchedules(namespace string) NatsStreamingBackupScheduleInterface {
+	return newNatsStreamingBackupSchedules(c, namespace)
+}
+
+func (c *StreamingV1alpha1Client) NatsStreamingChannels(namespace string) NatsStreamingChannelInterface {
+	return newNatsStreamingChannels(c, namespace)
+}
+
 func (c *StreamingV1alpha1Client) NatsStreamingClusters(namespace string) NatsStreamingClusterInterface {
 	return newNatsStreamingClusters(c, namespace)
 }